@@ -0,0 +1,97 @@
+// Command createadmin bootstraps the first admin account. It creates the user
+// if the email is not registered yet, otherwise it promotes the existing user.
+// It refuses to run once an admin exists; use PUT /admin/users/{userID}/role
+// from then on.
+package main
+
+import (
+	"chirpy/internal/auth"
+	"chirpy/internal/config"
+	"chirpy/internal/database"
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/joho/godotenv"
+	_ "github.com/lib/pq"
+)
+
+func main() {
+	email := flag.String("email", "", "email of the admin account")
+	password := flag.String("password", "", "password for the admin account, required when the user does not exist yet")
+	flag.Parse()
+
+	if *email == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	err := godotenv.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	db, err := sql.Open("postgres", os.Getenv("DB_URL"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	dbQueries := database.New(db)
+
+	admins, err := dbQueries.CountUsersByRole(ctx, string(auth.RoleAdmin))
+	if err != nil {
+		log.Fatalf("failed to count admins: %v", err)
+	}
+	if admins > 0 {
+		log.Fatal("an admin already exists, promote users through PUT /admin/users/{userID}/role instead")
+	}
+
+	user, err := dbQueries.GetUser(ctx, *email)
+	if errors.Is(err, sql.ErrNoRows) {
+		if *password == "" {
+			log.Fatal("-password is required to create a new user")
+		}
+
+		// The password is held to the same policy and hashed with the same
+		// parameters as passwords chosen through the API.
+		policy, policyErr := config.PasswordPolicyFromEnv()
+		if policyErr != nil {
+			log.Fatal(policyErr)
+		}
+		if policyErr = policy.Validate(*password); policyErr != nil {
+			log.Fatalf("-password is not allowed: %v", policyErr)
+		}
+		params, paramsErr := config.PasswordParamsFromEnv()
+		if paramsErr != nil {
+			log.Fatal(paramsErr)
+		}
+
+		hashedPassword, hashErr := auth.HashPasswordWithParams(*password, params)
+		if hashErr != nil {
+			log.Fatalf("failed to hash password: %v", hashErr)
+		}
+
+		user, err = dbQueries.CreateUser(ctx, database.CreateUserParams{
+			Email:          *email,
+			HashedPassword: hashedPassword,
+		})
+	}
+	if err != nil {
+		log.Fatalf("failed to get or create user: %v", err)
+	}
+
+	_, err = dbQueries.SetUserRole(ctx, database.SetUserRoleParams{
+		ID:   user.ID,
+		Role: string(auth.RoleAdmin),
+	})
+	if err != nil {
+		log.Fatalf("failed to promote user: %v", err)
+	}
+
+	log.Printf("user %s (%s) is now an admin", user.Email, user.ID)
+}
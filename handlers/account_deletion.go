@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"chirpy/internal/auth"
+	"chirpy/internal/database"
+	"chirpy/internal/mailer"
+	"chirpy/utils"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+type DeleteAccountParams struct {
+	Password string `json:"password"`
+}
+
+type DeleteAccountResponse struct {
+	DeleteAfter time.Time `json:"delete_after"`
+}
+
+// DeleteAccount schedules the signed-in user's account for deletion once the
+// grace period is over and signs them out everywhere. Logging in again before
+// then cancels it. The background job in worker.PurgeDeletedAccounts does the
+// actual deletion.
+func (a *APIHandlerStruct) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var params DeleteAccountParams
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&params)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	user, err := a.DBQueries.GetUserByID(r.Context(), principal.UserID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get user", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if !auth.HasUsablePassword(user.HashedPassword) {
+		utils.RespondError(w, http.StatusBadRequest, "Set a password through a password reset before deleting the account")
+		return
+	}
+
+	// The password check is a login in all but name, so it shares the login
+	// throttle.
+	clientIP := utils.ClientIP(r, a.APIConfig.TrustProxyHeaders)
+	if !a.checkLoginThrottle(w, r, user.Email, clientIP) {
+		return
+	}
+
+	authenticated, err := auth.CheckPassword(params.Password, user.HashedPassword)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to check password", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if !authenticated {
+		a.recordLoginAttempt(r, user.Email, clientIP, false)
+		utils.RespondError(w, http.StatusForbidden, "Incorrect password")
+		return
+	}
+
+	tx, err := a.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to begin transaction", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	qtx := a.DBQueries.InTx(tx)
+
+	user, err = qtx.ScheduleUserDeletion(r.Context(), database.ScheduleUserDeletionParams{
+		ID:          user.ID,
+		DeleteAfter: sql.NullTime{Time: time.Now().Add(a.APIConfig.AccountDeletionGracePeriod), Valid: true},
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to schedule account deletion", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = qtx.RevokeAllUserRefreshTokens(r.Context(), user.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to revoke refresh tokens", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to commit account deletion", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	go a.sendAccountDeletionNotice(context.WithoutCancel(r.Context()), user.Email, user.DeleteAfter.Time)
+
+	utils.RespondJSON(w, http.StatusAccepted, DeleteAccountResponse{DeleteAfter: user.DeleteAfter.Time})
+}
+
+func (a *APIHandlerStruct) sendAccountDeletionNotice(ctx context.Context, email string, deleteAfter time.Time) {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	err := a.Mailer.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Your Chirpy account will be deleted",
+		Body: fmt.Sprintf("Your Chirpy account and all of its chirps will be deleted after %s.\n\n"+
+			"Changed your mind? Log in before then to keep your account.", deleteAfter.UTC().Format("January 2, 2006 15:04 MST")),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to send account deletion notice", "error", err)
+	}
+}
@@ -0,0 +1,123 @@
+package handlers_test
+
+import (
+	"chirpy/handlers"
+	"chirpy/internal/auth"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+)
+
+var refreshTokenColumns = []string{"token", "created_at", "updated_at", "user_id", "expires_at", "revoked_at", "session_id", "client_id", "scopes"}
+
+func deleteAccount(h *handlers.APIHandlerStruct, userID uuid.UUID, password string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodDelete, "/api/users/me", strings.NewReader(`{"password":"`+password+`"}`))
+	req = req.WithContext(auth.WithPrincipal(req.Context(), &auth.Principal{UserID: userID, SessionID: "session-1"}))
+	rec := httptest.NewRecorder()
+	h.DeleteAccount(rec, req)
+	return rec
+}
+
+func TestDeleteAccountSchedulesDeletion(t *testing.T) {
+	h, mock := newTestHandlers(t)
+	h.APIConfig.PasswordParams = fastPasswordParams
+	h.APIConfig.AccountDeletionGracePeriod = 14 * 24 * time.Hour
+	mail := make(sentMail, 1)
+	h.Mailer = mail
+
+	hash, err := auth.HashPasswordWithParams("correct password", fastPasswordParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID := uuid.New()
+	now := time.Now()
+	deleteAfter := now.Add(h.APIConfig.AccountDeletionGracePeriod)
+
+	mock.ExpectQuery("GetUserByID").WithArgs(userID.String()).WillReturnRows(
+		sqlmock.NewRows(userColumns).AddRow(userID.String(), "user@example.com", now, now, hash, false, "user", nil, nil),
+	)
+	expectLoginThrottle(mock, "user@example.com")
+	mock.ExpectBegin()
+	mock.ExpectQuery("ScheduleUserDeletion").WithArgs(userID.String(), sqlmock.AnyArg()).WillReturnRows(
+		sqlmock.NewRows(userColumns).AddRow(userID.String(), "user@example.com", now, now, hash, false, "user", nil, deleteAfter),
+	)
+	mock.ExpectExec("RevokeAllUserRefreshTokens").WithArgs(userID.String()).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	rec := deleteAccount(h, userID, "correct password")
+	if rec.Code != http.StatusAccepted || !strings.Contains(rec.Body.String(), `"delete_after"`) {
+		t.Fatalf("Expected the deletion to be scheduled with 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	msg := receiveMail(t, mail)
+	if msg.To != "user@example.com" || !strings.Contains(msg.Body, "Log in before then") {
+		t.Fatalf("Expected a deletion notice, got %+v", msg)
+	}
+}
+
+func TestDeleteAccountRequiresPassword(t *testing.T) {
+	h, mock := newTestHandlers(t)
+	h.APIConfig.PasswordParams = fastPasswordParams
+
+	hash, err := auth.HashPasswordWithParams("correct password", fastPasswordParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID := uuid.New()
+	now := time.Now()
+
+	// A wrong password counts against the login throttle and schedules
+	// nothing.
+	mock.ExpectQuery("GetUserByID").WithArgs(userID.String()).WillReturnRows(
+		sqlmock.NewRows(userColumns).AddRow(userID.String(), "user@example.com", now, now, hash, false, "user", nil, nil),
+	)
+	expectLoginThrottle(mock, "user@example.com")
+	mock.ExpectExec("RecordLoginAttempt").WithArgs("user@example.com", sqlmock.AnyArg(), false).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	rec := deleteAccount(h, userID, "wrong password")
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("Expected a wrong password to get 403, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestLoginCancelsAccountDeletion(t *testing.T) {
+	h, mock := newTestHandlers(t)
+	h.APIConfig.PasswordParams = fastPasswordParams
+
+	hash, err := auth.HashPasswordWithParams("correct password", fastPasswordParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID := uuid.New()
+	now := time.Now()
+
+	expectLoginThrottle(mock, "user@example.com")
+	mock.ExpectQuery("GetUser").WithArgs("user@example.com").WillReturnRows(
+		sqlmock.NewRows(userColumns).AddRow(userID.String(), "user@example.com", now, now, hash, false, "user", nil, now.Add(time.Hour)),
+	)
+	mock.ExpectQuery("GetTOTP").WithArgs(userID.String()).WillReturnRows(sqlmock.NewRows(nil))
+	mock.ExpectExec("RecordLoginAttempt").WithArgs("user@example.com", sqlmock.AnyArg(), true).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("CancelUserDeletion").WithArgs(userID.String()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("CreateRefreshToken").WillReturnRows(
+		sqlmock.NewRows(refreshTokenColumns).AddRow("refresh-token", now, now, userID.String(), now.Add(time.Hour), nil, uuid.NewString(), nil, nil),
+	)
+
+	rec, _ := login(h, "user@example.com", "correct password")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected the login to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var response handlers.LoginResponse
+	err = json.Unmarshal(rec.Body.Bytes(), &response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.DeleteAfter.Valid {
+		t.Fatalf("Expected the response to show the deletion cancelled, got %s", rec.Body.String())
+	}
+}
@@ -1,23 +1,33 @@
 package handlers
 
 import (
+	"chirpy/internal/auth"
 	"chirpy/internal/database"
+	"chirpy/internal/webhooks"
 	"chirpy/metrics"
+	"chirpy/utils"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+
+	"github.com/google/uuid"
 )
 
 type AdminHandlerStruct struct {
 	Env        string
 	APIMetrics *metrics.API
+	DB         *sql.DB
 	DBQueries  *database.Queries
 }
 
-func NewAdminHandlers(env string, apiMetrics *metrics.API, dbQueries *database.Queries) *AdminHandlerStruct {
+func NewAdminHandlers(env string, apiMetrics *metrics.API, db *sql.DB, dbQueries *database.Queries) *AdminHandlerStruct {
 	return &AdminHandlerStruct{
 		Env:        env,
 		APIMetrics: apiMetrics,
+		DB:         db,
 		DBQueries:  dbQueries,
 	}
 }
@@ -37,10 +47,17 @@ func (a *AdminHandlerStruct) GetMetrics(w http.ResponseWriter, r *http.Request)
       `, hits,
 	)))
 	if err != nil {
-		log.Fatal(err)
+		slog.ErrorContext(r.Context(), "failed to write response", "error", err)
 	}
 }
 
+// PrometheusMetrics serves every metric in the Prometheus text format.
+func (a *AdminHandlerStruct) PrometheusMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", metrics.PrometheusContentType)
+	w.WriteHeader(http.StatusOK)
+	a.APIMetrics.WritePrometheus(w, a.DB.Stats())
+}
+
 func (a *AdminHandlerStruct) Reset(w http.ResponseWriter, r *http.Request) {
 	if a.Env != "dev" {
 		w.WriteHeader(http.StatusForbidden)
@@ -49,7 +66,7 @@ func (a *AdminHandlerStruct) Reset(w http.ResponseWriter, r *http.Request) {
 
 	err := a.DBQueries.DeleteUsers(r.Context())
 	if err != nil {
-		log.Println(err)
+		slog.ErrorContext(r.Context(), "failed to delete users", "error", err)
 	}
 
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
@@ -57,6 +74,97 @@ func (a *AdminHandlerStruct) Reset(w http.ResponseWriter, r *http.Request) {
 	_ = a.APIMetrics.ResetMetrics()
 	_, err = w.Write([]byte("OK"))
 	if err != nil {
-		log.Fatal(err)
+		slog.ErrorContext(r.Context(), "failed to write response", "error", err)
+	}
+}
+
+func (a *AdminHandlerStruct) ModerateDeleteChirp(w http.ResponseWriter, r *http.Request) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid chirp ID")
+		return
+	}
+
+	tx, err := a.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to begin transaction", "error", err)
+		utils.RespondError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+	defer tx.Rollback()
+
+	qtx := a.DBQueries.InTx(tx)
+
+	chirp, err := qtx.ModerateDeleteChirp(r.Context(), chirpID)
+	if errors.Is(err, sql.ErrNoRows) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to delete chirp", "error", err)
+		utils.RespondError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	err = webhooks.Enqueue(r.Context(), qtx, webhooks.EventChirpDeleted, chirp.UserID, ChirpDeletedEvent{ID: chirp.ID, UserID: chirp.UserID})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to queue chirp.deleted webhooks", "error", err)
+		utils.RespondError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to commit chirp deletion", "error", err)
+		utils.RespondError(w, http.StatusInternalServerError, "Something went wrong")
+		return
 	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type UpdateUserRoleParams struct {
+	Role string `json:"role"`
+}
+
+func (a *AdminHandlerStruct) UpdateUserRole(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	var params UpdateUserRoleParams
+	decoder := json.NewDecoder(r.Body)
+	err = decoder.Decode(&params)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	role, ok := auth.ParseRole(params.Role)
+	if !ok {
+		utils.RespondError(w, http.StatusBadRequest, "Unknown role")
+		return
+	}
+
+	user, err := a.DBQueries.SetUserRole(r.Context(), database.SetUserRoleParams{
+		ID:   userID,
+		Role: string(role),
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		slog.ErrorContext(r.Context(), "failed to set user role", "error", err)
+		utils.RespondError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	user.HashedPassword = ""
+	utils.RespondJSON(w, http.StatusOK, user)
 }
@@ -3,7 +3,12 @@ package handlers
 import (
 	"chirpy/internal/config"
 	"chirpy/internal/database"
-	"log"
+	"chirpy/internal/health"
+	"chirpy/internal/mailer"
+	"chirpy/internal/passkey"
+	"chirpy/metrics"
+	"chirpy/utils"
+	"database/sql"
 	"net/http"
 )
 
@@ -12,22 +17,43 @@ type Chirp struct {
 }
 
 type APIHandlerStruct struct {
-	APIConfig *config.APIConfig
-	DBQueries *database.Queries
+	APIConfig  *config.APIConfig
+	APIMetrics *metrics.API
+	DB         *sql.DB
+	DBQueries  *database.Queries
+	Mailer     mailer.Mailer
+	Passkeys   *passkey.Service
+	Readiness  *health.Readiness
 }
 
-func NewAPIHandler(apiConfig *config.APIConfig, dbQueries *database.Queries) *APIHandlerStruct {
+func NewAPIHandler(apiConfig *config.APIConfig, apiMetrics *metrics.API, db *sql.DB, dbQueries *database.Queries, mail mailer.Mailer, passkeys *passkey.Service, readiness *health.Readiness) *APIHandlerStruct {
 	return &APIHandlerStruct{
-		APIConfig: apiConfig,
-		DBQueries: dbQueries,
+		APIConfig:  apiConfig,
+		APIMetrics: apiMetrics,
+		DB:         db,
+		DBQueries:  dbQueries,
+		Mailer:     mail,
+		Passkeys:   passkeys,
+		Readiness:  readiness,
 	}
 }
 
 func (a *APIHandlerStruct) HealthCheck(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-	w.WriteHeader(http.StatusOK)
-	_, err := w.Write([]byte("OK"))
-	if err != nil {
-		log.Fatal(err)
+	w.Header().Set("Cache-Control", "no-store")
+	utils.RespondJSON(w, http.StatusOK, health.Report{Status: health.StatusOK})
+}
+
+// ReadinessCheck tells load balancers whether to send traffic here: it runs
+// the readiness checks and fails while the server drains before shutting down.
+// HealthCheck only says the process is up, since restarting it would not fix
+// a database outage.
+func (a *APIHandlerStruct) ReadinessCheck(w http.ResponseWriter, r *http.Request) {
+	report := a.Readiness.Check(r.Context())
+
+	status := http.StatusOK
+	if !report.Ready() {
+		status = http.StatusServiceUnavailable
 	}
+	w.Header().Set("Cache-Control", "no-store")
+	utils.RespondJSON(w, status, report)
 }
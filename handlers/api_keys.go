@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"chirpy/internal/auth"
+	"chirpy/internal/database"
+	"chirpy/utils"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type CreateAPIKeyParams struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days"`
+}
+
+type APIKeyResponse struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	// Token is only set in the response to CreateAPIKey.
+	Token string `json:"token,omitempty"`
+}
+
+func newAPIKeyResponse(apiKey database.ApiKey) APIKeyResponse {
+	response := APIKeyResponse{
+		ID:        apiKey.ID,
+		Name:      apiKey.Name,
+		Prefix:    apiKey.Prefix,
+		Scopes:    apiKey.Scopes,
+		CreatedAt: apiKey.CreatedAt,
+	}
+	if apiKey.ExpiresAt.Valid {
+		response.ExpiresAt = &apiKey.ExpiresAt.Time
+	}
+	if apiKey.LastUsedAt.Valid {
+		response.LastUsedAt = &apiKey.LastUsedAt.Time
+	}
+	return response
+}
+
+// CreateAPIKey issues a named personal access token. The key is returned
+// once; only its hash and display prefix are stored.
+func (a *APIHandlerStruct) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var params CreateAPIKeyParams
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&params)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if params.Name == "" {
+		utils.RespondError(w, http.StatusBadRequest, "Name is required")
+		return
+	}
+
+	if len(params.Scopes) == 0 {
+		utils.RespondError(w, http.StatusBadRequest, "At least one scope is required")
+		return
+	}
+
+	for _, scope := range params.Scopes {
+		if !auth.IsValidScope(scope) {
+			utils.RespondError(w, http.StatusBadRequest, "Unknown scope: "+scope)
+			return
+		}
+	}
+
+	if params.ExpiresInDays < 0 {
+		utils.RespondError(w, http.StatusBadRequest, "expires_in_days must be positive")
+		return
+	}
+
+	var expiresAt sql.NullTime
+	if params.ExpiresInDays > 0 {
+		expiresAt = sql.NullTime{Time: time.Now().AddDate(0, 0, params.ExpiresInDays), Valid: true}
+	}
+
+	key, prefix, err := auth.MakeAPIKey()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to generate API key", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	apiKey, err := a.DBQueries.CreateAPIKey(r.Context(), database.CreateAPIKeyParams{
+		UserID:    principal.UserID,
+		Name:      params.Name,
+		Prefix:    prefix,
+		KeyHash:   auth.HashToken(key),
+		Scopes:    params.Scopes,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to create API key", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response := newAPIKeyResponse(apiKey)
+	response.Token = key
+	utils.RespondJSON(w, http.StatusCreated, response)
+}
+
+func (a *APIHandlerStruct) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	apiKeys, err := a.DBQueries.ListAPIKeys(r.Context(), principal.UserID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to list API keys", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]APIKeyResponse, 0, len(apiKeys))
+	for _, apiKey := range apiKeys {
+		response = append(response, newAPIKeyResponse(apiKey))
+	}
+
+	utils.RespondJSON(w, http.StatusOK, response)
+}
+
+func (a *APIHandlerStruct) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	tokenID, err := uuid.Parse(r.PathValue("tokenID"))
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid token ID")
+		return
+	}
+
+	revoked, err := a.DBQueries.RevokeAPIKey(r.Context(), database.RevokeAPIKeyParams{
+		ID:     tokenID,
+		UserID: principal.UserID,
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to revoke API key", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if revoked == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,25 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHealthCheck(t *testing.T) {
+	h, _ := newTestHandlers(t)
+
+	rec := httptest.NewRecorder()
+	h.HealthCheck(rec, httptest.NewRequest(http.MethodGet, "/api/healthz", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("Content-Type"); !strings.HasPrefix(got, "application/json") {
+		t.Fatalf("Expected a JSON response, got %q", got)
+	}
+	if got := strings.TrimSpace(rec.Body.String()); got != `{"status":"ok"}` {
+		t.Fatalf(`Expected {"status":"ok"}, got %s`, got)
+	}
+}
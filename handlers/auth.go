@@ -7,8 +7,10 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
-	"log"
+	"log/slog"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 )
 
@@ -30,60 +32,184 @@ func (a *APIHandlerStruct) Login(w http.ResponseWriter, r *http.Request) {
 	decoder := json.NewDecoder(r.Body)
 	err := decoder.Decode(&loginParams)
 	if err != nil {
-		log.Println("failed to decode data", err)
+		slog.ErrorContext(r.Context(), "failed to decode data", "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
+	clientIP := utils.ClientIP(r, a.APIConfig.TrustProxyHeaders)
+	if !a.checkLoginThrottle(w, r, loginParams.Email, clientIP) {
+		return
+	}
+
 	retrievedUser, err := a.DBQueries.GetUser(r.Context(), loginParams.Email)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			w.WriteHeader(http.StatusNotFound)
+			// Same work and same answer as a wrong password, so the
+			// response does not reveal whether the email is registered.
+			auth.CheckDummyPassword(loginParams.Password, a.APIConfig.PasswordParams)
+			a.recordLoginAttempt(r, loginParams.Email, clientIP, false)
+			utils.RespondError(w, http.StatusUnauthorized, "Incorrect email or password")
 			return
 		}
 
-		log.Println("failed to get user", err)
+		slog.ErrorContext(r.Context(), "failed to get user", "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	authenticated, err := auth.CheckPassword(loginParams.Password, retrievedUser.HashedPassword)
+	var authenticated bool
+	if auth.HasUsablePassword(retrievedUser.HashedPassword) {
+		authenticated, err = auth.CheckPassword(loginParams.Password, retrievedUser.HashedPassword)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to check password", "error", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	} else {
+		// Passwordless accounts can only log in through a magic link.
+		auth.CheckDummyPassword(loginParams.Password, a.APIConfig.PasswordParams)
+	}
+
+	if !authenticated {
+		a.recordLoginAttempt(r, loginParams.Email, clientIP, false)
+		utils.RespondError(w, http.StatusUnauthorized, "Incorrect email or password")
+		return
+	}
+
+	a.upgradePasswordHash(r.Context(), retrievedUser, loginParams.Password)
+	a.completeLogin(w, r, retrievedUser, clientIP)
+}
+
+// checkLoginThrottle answers 429 with Retry-After and returns false when the
+// email or the client IP has failed too many logins recently. Attempts
+// rejected here are not recorded, so waiting out the delay always works.
+func (a *APIHandlerStruct) checkLoginThrottle(w http.ResponseWriter, r *http.Request, email, clientIP string) bool {
+	now := time.Now()
+	accountThrottle := a.APIConfig.AccountLoginThrottle
+	ipThrottle := a.APIConfig.IPLoginThrottle
+
+	accountFailures, err := a.DBQueries.GetLoginFailuresByEmail(r.Context(), database.GetLoginFailuresByEmailParams{
+		Email: email,
+		Since: now.Add(-accountThrottle.Window),
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to count login failures by email", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return false
+	}
+
+	ipFailures, err := a.DBQueries.GetLoginFailuresByIP(r.Context(), database.GetLoginFailuresByIPParams{
+		IpAddress: clientIP,
+		Since:     now.Add(-ipThrottle.Window),
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to count login failures by IP", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return false
+	}
+
+	retryAfter := max(
+		accountThrottle.RetryAfter(int(accountFailures.Failures), accountFailures.LastFailure, now),
+		ipThrottle.RetryAfter(int(ipFailures.Failures), ipFailures.LastFailure, now),
+	)
+	if retryAfter <= 0 {
+		return true
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	utils.RespondError(w, http.StatusTooManyRequests, "Too many login attempts, try again later")
+	return false
+}
+
+func (a *APIHandlerStruct) recordLoginAttempt(r *http.Request, email, clientIP string, succeeded bool) {
+	a.APIMetrics.LoginAttempt(succeeded)
+
+	err := a.DBQueries.RecordLoginAttempt(r.Context(), database.RecordLoginAttemptParams{
+		Email:     email,
+		IpAddress: clientIP,
+		Succeeded: succeeded,
+	})
 	if err != nil {
-		log.Println("failed to check password", loginParams.Password, err)
+		slog.ErrorContext(r.Context(), "failed to record login attempt", "error", err)
+	}
+}
+
+// completeLogin runs once the first factor has been verified. Users with
+// two-factor authentication get a challenge token to finish the login through
+// POST /api/login/2fa, everyone else gets a session right away. The login only
+// counts as successful, and resets the throttle, once a session is issued.
+func (a *APIHandlerStruct) completeLogin(w http.ResponseWriter, r *http.Request, user database.User, clientIP string) {
+	totp, err := a.DBQueries.GetTOTP(r.Context(), user.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		slog.ErrorContext(r.Context(), "failed to get TOTP settings", "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	if !authenticated {
-		utils.RespondError(w, http.StatusUnauthorized, "Incorrect email or password")
+	if err == nil && totp.ConfirmedAt.Valid {
+		challengeToken, err := auth.MakeChallengeToken(user.ID, a.APIConfig.JWTSecret, twoFactorChallengeTTL)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to create challenge token", "error", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		utils.RespondJSON(w, http.StatusOK, &TwoFactorChallengeResponse{
+			TwoFactorRequired: true,
+			ChallengeToken:    challengeToken,
+		})
 		return
 	}
 
+	a.recordLoginAttempt(r, user.Email, clientIP, true)
+	a.issueSession(w, r, user)
+}
+
+// issueSession creates a refresh token and an access token for user and
+// writes them as a LoginResponse. It also cancels a pending account deletion.
+func (a *APIHandlerStruct) issueSession(w http.ResponseWriter, r *http.Request, user database.User) {
+	if user.DeleteAfter.Valid {
+		// Logging in during the grace period keeps the account.
+		err := a.DBQueries.CancelUserDeletion(r.Context(), user.ID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to cancel account deletion", "error", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		user.DeleteAfter = sql.NullTime{}
+	}
+
 	token, err := auth.MakeRefreshToken()
 	if err != nil {
-		log.Println("failed to create refreshToken", err)
+		slog.ErrorContext(r.Context(), "failed to create refreshToken", "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	refreshToken, err := a.DBQueries.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{Token: token, UserID: retrievedUser.ID})
+	refreshToken, err := a.DBQueries.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{Token: token, UserID: user.ID})
 	if err != nil {
-		log.Println("failed to insert refresh token", err)
+		slog.ErrorContext(r.Context(), "failed to insert refresh token", "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
 	expirationInSeconds := 3600
-	jwtToken, err := auth.MakeJWT(retrievedUser.ID, a.APIConfig.JWTSecret, time.Second*time.Duration(expirationInSeconds))
+	jwtToken, err := auth.MakeJWTWithClaims(user.ID, a.APIConfig.JWTSecret, time.Second*time.Duration(expirationInSeconds), auth.Claims{
+		SessionID: refreshToken.SessionID.String(),
+		Tier:      userTier(user),
+		Role:      user.Role,
+	})
 	if err != nil {
-		log.Println("failed to create JWT", err)
+		slog.ErrorContext(r.Context(), "failed to create JWT", "error", err)
 		utils.RespondError(w, http.StatusInternalServerError, "failed to create JWT")
+		return
 	}
 
-	retrievedUser.HashedPassword = ""
+	user.HashedPassword = ""
 
 	utils.RespondJSON(w, http.StatusOK, &LoginResponse{
-		User:         retrievedUser,
+		User:         user,
 		Token:        jwtToken,
 		RefreshToken: refreshToken.Token,
 	})
@@ -92,14 +218,14 @@ func (a *APIHandlerStruct) Login(w http.ResponseWriter, r *http.Request) {
 func (a *APIHandlerStruct) RefreshAccessToken(w http.ResponseWriter, r *http.Request) {
 	refreshToken, err := auth.GetRefreshTokenHeader(r.Header)
 	if err != nil {
-		log.Printf("failed to get refresh token header: %v", err)
+		slog.ErrorContext(r.Context(), "failed to get refresh token header", "error", err)
 		w.WriteHeader(http.StatusUnauthorized)
 		return
 	}
 
 	token, err := a.DBQueries.GetRefreshToken(r.Context(), refreshToken)
 	if err != nil {
-		log.Printf("failed to get refresh token from db: %v, %s", err, refreshToken)
+		slog.ErrorContext(r.Context(), "failed to get refresh token from db", "error", err)
 		if errors.Is(err, sql.ErrNoRows) {
 			w.WriteHeader(http.StatusUnauthorized)
 			return
@@ -109,13 +235,25 @@ func (a *APIHandlerStruct) RefreshAccessToken(w http.ResponseWriter, r *http.Req
 	}
 
 	// check if revoked_at is not empty or
-	// if the current time and date is after the token expiration
-	if !token.RevokedAt.Time.IsZero() || time.Now().After(token.ExpiresAt) {
+	// if the current time and date is after the token expiration.
+	// Refresh tokens of OAuth clients go through POST /api/oauth/token.
+	if !token.RevokedAt.Time.IsZero() || time.Now().After(token.ExpiresAt) || token.ClientID.Valid {
 		w.WriteHeader(http.StatusUnauthorized)
 		return
 	}
 
-	authToken, err := auth.MakeJWT(token.UserID, a.APIConfig.JWTSecret, time.Second*3600)
+	user, err := a.DBQueries.GetUserByID(r.Context(), token.UserID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get user for refresh token", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	authToken, err := auth.MakeJWTWithClaims(token.UserID, a.APIConfig.JWTSecret, time.Second*3600, auth.Claims{
+		SessionID: token.SessionID.String(),
+		Tier:      userTier(user),
+		Role:      user.Role,
+	})
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
@@ -131,14 +269,14 @@ func (a *APIHandlerStruct) RefreshAccessToken(w http.ResponseWriter, r *http.Req
 func (a *APIHandlerStruct) RevokeRefreshToken(w http.ResponseWriter, r *http.Request) {
 	refreshToken, err := auth.GetRefreshTokenHeader(r.Header)
 	if err != nil {
-		log.Printf("failed to get refresh token header: %v", err)
+		slog.ErrorContext(r.Context(), "failed to get refresh token header", "error", err)
 		w.WriteHeader(http.StatusUnauthorized)
 		return
 	}
 
 	_, err = a.DBQueries.RevokeRefreskToken(r.Context(), refreshToken)
 	if err != nil {
-		log.Printf("failed to revoke refresh token from db: %v, %s", err, refreshToken)
+		slog.ErrorContext(r.Context(), "failed to revoke refresh token from db", "error", err)
 		if errors.Is(err, sql.ErrNoRows) {
 			w.WriteHeader(http.StatusUnauthorized)
 			return
@@ -149,3 +287,10 @@ func (a *APIHandlerStruct) RevokeRefreshToken(w http.ResponseWriter, r *http.Req
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+func userTier(user database.User) string {
+	if user.IsChirpyRed {
+		return auth.TierChirpyRed
+	}
+	return auth.TierFree
+}
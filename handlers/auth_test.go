@@ -0,0 +1,79 @@
+package handlers_test
+
+import (
+	"chirpy/handlers"
+	"chirpy/internal/auth"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/alexedwards/argon2id"
+	"github.com/google/uuid"
+)
+
+// slowPasswordParams make a password check slow enough to be measured.
+var slowPasswordParams = &argon2id.Params{Memory: 8 * 1024, Iterations: 16, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func login(h *handlers.APIHandlerStruct, email, password string) (*httptest.ResponseRecorder, time.Duration) {
+	body := `{"email":"` + email + `","password":"` + password + `"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+
+	start := time.Now()
+	h.Login(rec, req)
+	return rec, time.Since(start)
+}
+
+// expectLoginThrottle expects the throttle to find no recent failures.
+func expectLoginThrottle(mock sqlmock.Sqlmock, email string) {
+	noFailures := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"failures", "last_failure"}).AddRow(0, time.Unix(0, 0))
+	}
+	mock.ExpectQuery("GetLoginFailuresByEmail").WithArgs(email, sqlmock.AnyArg()).WillReturnRows(noFailures())
+	mock.ExpectQuery("GetLoginFailuresByIP").WillReturnRows(noFailures())
+}
+
+func TestLoginDoesNotRevealRegisteredEmails(t *testing.T) {
+	h, mock := newTestHandlers(t)
+	h.APIConfig.PasswordParams = slowPasswordParams
+
+	hash, err := auth.HashPasswordWithParams("correct password", slowPasswordParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Warm the cache of dummy hashes, so the unknown email below pays for a
+	// password check only, like the wrong password does.
+	auth.CheckDummyPassword("", slowPasswordParams)
+
+	now := time.Now()
+	expectLoginThrottle(mock, "user@example.com")
+	mock.ExpectQuery("GetUser").WithArgs("user@example.com").WillReturnRows(
+		sqlmock.NewRows(userColumns).AddRow(uuid.NewString(), "user@example.com", now, now, hash, false, "user", nil, nil),
+	)
+	mock.ExpectExec("RecordLoginAttempt").WithArgs("user@example.com", sqlmock.AnyArg(), false).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	wrongPassword, wrongPasswordTook := login(h, "user@example.com", "wrong password")
+
+	expectLoginThrottle(mock, "nobody@example.com")
+	mock.ExpectQuery("GetUser").WithArgs("nobody@example.com").WillReturnError(sql.ErrNoRows)
+	mock.ExpectExec("RecordLoginAttempt").WithArgs("nobody@example.com", sqlmock.AnyArg(), false).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	unknownEmail, unknownEmailTook := login(h, "nobody@example.com", "wrong password")
+
+	if wrongPassword.Code != http.StatusUnauthorized || unknownEmail.Code != wrongPassword.Code {
+		t.Fatalf("Expected both logins to get 401, got %d and %d", wrongPassword.Code, unknownEmail.Code)
+	}
+	if unknownEmail.Body.String() != wrongPassword.Body.String() {
+		t.Fatalf("Expected the same body for both logins, got %s and %s", wrongPassword.Body.String(), unknownEmail.Body.String())
+	}
+
+	// Skipping the dummy check would answer the unknown email in a fraction
+	// of the time a wrong password takes.
+	if unknownEmailTook < wrongPasswordTook/2 {
+		t.Fatalf("Expected an unknown email to take as long as a wrong password, took %s against %s", unknownEmailTook, wrongPasswordTook)
+	}
+}
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"chirpy/internal/billing"
+	"chirpy/internal/database"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const maxWebhookBodySize = 1 << 20
+
+var errWebhookUserNotFound = errors.New("user not found")
+
+// BillingWebhook takes a webhook from the payment provider named in the path.
+// Providers that are not configured do not exist as far as callers can tell.
+func (a *APIHandlerStruct) BillingWebhook(w http.ResponseWriter, r *http.Request) {
+	a.billingWebhook(w, r, r.PathValue("provider"))
+}
+
+// Webhook is the original Polka webhook URL, kept for Polka accounts that
+// still deliver there.
+func (a *APIHandlerStruct) Webhook(w http.ResponseWriter, r *http.Request) {
+	a.billingWebhook(w, r, "polka")
+}
+
+func (a *APIHandlerStruct) billingWebhook(w http.ResponseWriter, r *http.Request, name string) {
+	defer r.Body.Close()
+
+	provider, ok := a.APIConfig.BillingProviders[name]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	// Signatures cover the exact bytes the provider sent, so the body is
+	// read whole before it is decoded.
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBodySize))
+	if err != nil {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	err = provider.Verify(r.Header, body, time.Now())
+	if err != nil {
+		slog.WarnContext(r.Context(), "rejected webhook", "provider", name, "error", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	notification, parseErr := provider.Parse(body)
+	eventID := webhookEventID(provider, r.Header, notification, body)
+
+	// Providers retry deliveries until they get a 2xx. Retries of an event
+	// that was already processed are acknowledged without running it again.
+	claimed, err := a.DBQueries.ClaimWebhookEvent(r.Context(), database.ClaimWebhookEventParams{
+		Provider:  name,
+		EventID:   eventID,
+		EventType: notification.Type,
+		Payload:   string(body),
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		a.APIMetrics.WebhookProcessed(name, "duplicate")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to record webhook event", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = parseErr
+	if err == nil {
+		err = a.processBillingEvent(r.Context(), name, eventID, claimed.ReceivedAt, notification)
+	}
+	if err != nil {
+		a.failWebhookEvent(r.Context(), name, eventID, err)
+		a.APIMetrics.WebhookProcessed(name, "failed")
+
+		if errors.Is(err, errWebhookUserNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	a.APIMetrics.WebhookProcessed(name, "processed")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// webhookEventID identifies an event in the log: the provider's own ID when
+// the payload has one. Otherwise the body alone cannot tell events apart,
+// since an upgrade after a downgrade resends the same body, so the key also
+// covers the delivery's signed stamp. Without a stamp each delivery is its
+// own event, and a retry applies the same change again.
+func webhookEventID(provider billing.Provider, header http.Header, notification billing.Notification, body []byte) string {
+	if notification.ID != "" {
+		return notification.ID
+	}
+
+	var stamp string
+	if stamper, ok := provider.(billing.DeliveryStamper); ok {
+		stamp = stamper.DeliveryStamp(header)
+	}
+	if stamp == "" {
+		return "delivery:" + uuid.NewString()
+	}
+
+	hash := sha256.New()
+	hash.Write([]byte(stamp + "."))
+	hash.Write(body)
+	return "sha256:" + hex.EncodeToString(hash.Sum(nil))
+}
+
+// processBillingEvent applies an event and marks it processed in the same
+// transaction, so an event is never recorded as done without its effects.
+// Events that do not say when they happened are placed at receivedAt.
+func (a *APIHandlerStruct) processBillingEvent(ctx context.Context, provider, eventID string, receivedAt time.Time, notification billing.Notification) error {
+	tx, err := a.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	qtx := a.DBQueries.InTx(tx)
+
+	event := notification.Event
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = receivedAt
+	}
+
+	if event.Handles() {
+		userID, err := uuid.Parse(notification.UserID)
+		if err != nil {
+			return fmt.Errorf("invalid user ID: %w", err)
+		}
+
+		err = applySubscriptionEvent(ctx, qtx, provider, userID, event)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = qtx.CompleteWebhookEvent(ctx, database.CompleteWebhookEventParams{
+		Provider: provider,
+		EventID:  eventID,
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (a *APIHandlerStruct) failWebhookEvent(ctx context.Context, provider, eventID string, cause error) {
+	// The request context may be what failed, so only its values are kept.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+
+	slog.ErrorContext(ctx, "failed to process webhook event", "provider", provider, "event_id", eventID, "error", cause)
+
+	err := a.DBQueries.FailWebhookEvent(ctx, database.FailWebhookEventParams{
+		Provider: provider,
+		EventID:  eventID,
+		Error:    sql.NullString{String: cause.Error(), Valid: true},
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to mark webhook event as failed", "provider", provider, "event_id", eventID, "error", err)
+	}
+}
@@ -0,0 +1,239 @@
+package handlers_test
+
+import (
+	"chirpy/handlers"
+	"chirpy/internal/auth"
+	"chirpy/internal/billing"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+)
+
+const testPolkaKey = "polka-key"
+
+var (
+	webhookEventColumns = []string{"provider", "event_id", "event_type", "payload", "status", "error", "attempts", "received_at", "updated_at", "processed_at"}
+	userColumns         = []string{"id", "email", "created_at", "updated_at", "hashed_password", "is_chirpy_red", "role", "email_verified_at", "delete_after"}
+	subscriptionColumns = []string{"user_id", "provider", "plan", "status", "current_period_start", "current_period_end", "cancel_at_period_end", "last_event_at", "created_at", "updated_at"}
+)
+
+// newBillingTestHandlers returns handlers that accept Polka webhooks sent with
+// testPolkaKey.
+func newBillingTestHandlers(t *testing.T) (*handlers.APIHandlerStruct, sqlmock.Sqlmock) {
+	t.Helper()
+
+	h, mock := newTestHandlers(t)
+	h.APIConfig.BillingProviders = map[string]billing.Provider{
+		"polka": &billing.Polka{AuthMode: billing.PolkaAuthAPIKey, APIKey: testPolkaKey},
+	}
+	return h, mock
+}
+
+func polkaUpgrade(eventID string, userID uuid.UUID) string {
+	return fmt.Sprintf(`{"id":%q,"event":"user.upgraded","occurred_at":"2026-10-01T12:00:00Z","data":{"user_id":%q,"plan":"red"}}`, eventID, userID)
+}
+
+func deliverPolkaWebhook(h *handlers.APIHandlerStruct, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/billing/polka/webhooks", strings.NewReader(body))
+	req.SetPathValue("provider", "polka")
+	req.Header.Set("Authorization", "ApiKey "+testPolkaKey)
+	rec := httptest.NewRecorder()
+	h.BillingWebhook(rec, req)
+	return rec
+}
+
+func webhookEventRow(status, payload string, attempts int) *sqlmock.Rows {
+	now := time.Now()
+	return sqlmock.NewRows(webhookEventColumns).
+		AddRow("polka", "evt-1", "user.upgraded", payload, status, nil, attempts, now, now, nil)
+}
+
+// expectUpgrade expects the queries an upgrade of a user without a
+// subscription makes, up to its commit.
+func expectUpgrade(mock sqlmock.Sqlmock, userID uuid.UUID) {
+	expectSubscriptionEvent(mock, userID, "", time.Time{}, billing.StatusActive)
+}
+
+// expectSubscriptionEvent expects the queries of an event that moves
+// userID's subscription from currentStatus, or from none when it is empty,
+// to wantStatus, up to its commit.
+func expectSubscriptionEvent(mock sqlmock.Sqlmock, userID uuid.UUID, currentStatus billing.Status, lastEventAt time.Time, wantStatus billing.Status) {
+	now := time.Now()
+	mock.ExpectBegin()
+	mock.ExpectQuery("GetUserByID").WithArgs(userID.String()).WillReturnRows(
+		sqlmock.NewRows(userColumns).AddRow(userID.String(), "user@example.com", now, now, "hash", currentStatus == billing.StatusActive, "user", nil, nil),
+	)
+	if currentStatus == "" {
+		mock.ExpectQuery("GetSubscriptionForUpdate").WillReturnError(sql.ErrNoRows)
+	} else {
+		mock.ExpectQuery("GetSubscriptionForUpdate").WithArgs(userID.String()).WillReturnRows(
+			sqlmock.NewRows(subscriptionColumns).AddRow(userID.String(), "polka", "red", string(currentStatus), nil, nil, false, lastEventAt, now, now),
+		)
+	}
+	mock.ExpectQuery("UpsertSubscription").
+		WithArgs(userID.String(), "polka", sqlmock.AnyArg(), string(wantStatus), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(
+			sqlmock.NewRows(subscriptionColumns).AddRow(userID.String(), "polka", "red", string(wantStatus), nil, nil, false, now, now, now),
+		)
+	if wantStatus == billing.StatusActive {
+		mock.ExpectQuery("EnableUserChirpyRed").WithArgs(userID.String()).WillReturnRows(
+			sqlmock.NewRows(userColumns).AddRow(userID.String(), "user@example.com", now, now, "hash", true, "user", nil, nil),
+		)
+	} else {
+		mock.ExpectQuery("DisableUserChirpyRed").WithArgs(userID.String()).WillReturnRows(
+			sqlmock.NewRows(userColumns).AddRow(userID.String(), "user@example.com", now, now, "hash", false, "user", nil, nil),
+		)
+	}
+	mock.ExpectExec("CompleteWebhookEvent").WithArgs("polka", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+}
+
+func TestBillingWebhookAcknowledgesDuplicates(t *testing.T) {
+	h, mock := newBillingTestHandlers(t)
+
+	// The event was already processed, so it cannot be claimed, and nothing
+	// else may run.
+	mock.ExpectQuery("ClaimWebhookEvent").WillReturnError(sql.ErrNoRows)
+
+	rec := deliverPolkaWebhook(h, polkaUpgrade("evt-1", uuid.New()))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected a duplicate to be acknowledged with 204, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestBillingWebhookRetriesFailedEvents(t *testing.T) {
+	h, mock := newBillingTestHandlers(t)
+	userID := uuid.New()
+	body := polkaUpgrade("evt-1", userID)
+
+	// The first delivery fails part-way: it is rolled back, recorded as
+	// failed, and answered with a 5xx so Polka sends it again.
+	mock.ExpectQuery("ClaimWebhookEvent").WithArgs("polka", "evt-1", "user.upgraded", body).
+		WillReturnRows(webhookEventRow("processing", body, 1))
+	mock.ExpectBegin()
+	mock.ExpectQuery("GetUserByID").WillReturnError(errors.New("connection reset"))
+	mock.ExpectRollback()
+	mock.ExpectExec("FailWebhookEvent").WithArgs("polka", "evt-1", "connection reset").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	rec := deliverPolkaWebhook(h, body)
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected a failed event to get 500, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// The retry claims the failed event again and processes it.
+	mock.ExpectQuery("ClaimWebhookEvent").WithArgs("polka", "evt-1", "user.upgraded", body).
+		WillReturnRows(webhookEventRow("processing", body, 2))
+	expectUpgrade(mock, userID)
+
+	rec = deliverPolkaWebhook(h, body)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected the retry to be processed with 204, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestReplayWebhookEvent(t *testing.T) {
+	h, mock := newBillingTestHandlers(t)
+	userID := uuid.New()
+	body := polkaUpgrade("evt-1", userID)
+
+	mock.ExpectQuery("ClaimFailedWebhookEvent").WithArgs("polka", "evt-1").
+		WillReturnRows(webhookEventRow("processing", body, 2))
+	expectUpgrade(mock, userID)
+	mock.ExpectQuery("GetWebhookEvent").WithArgs("polka", "evt-1").
+		WillReturnRows(webhookEventRow("processed", body, 2))
+
+	rec := replayWebhookEvent(h, "polka", "evt-1")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"status":"processed"`) {
+		t.Fatalf("Expected the replayed event to be processed, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestReplayWebhookEventOnlyReplaysFailedEvents(t *testing.T) {
+	h, mock := newBillingTestHandlers(t)
+
+	mock.ExpectQuery("ClaimFailedWebhookEvent").WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery("GetWebhookEvent").WithArgs("polka", "evt-1").
+		WillReturnRows(webhookEventRow("processed", "{}", 1))
+
+	rec := replayWebhookEvent(h, "polka", "evt-1")
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("Expected 409 for an event that did not fail, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func replayWebhookEvent(h *handlers.APIHandlerStruct, provider, eventID string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/admin/webhooks/events/"+provider+"/"+eventID+"/replay", nil)
+	req.SetPathValue("provider", provider)
+	req.SetPathValue("eventID", eventID)
+	rec := httptest.NewRecorder()
+	h.ReplayWebhookEvent(rec, req)
+	return rec
+}
+
+// eventIDs records the event IDs deliveries are claimed under.
+type eventIDs map[string]bool
+
+func (ids eventIDs) Match(v driver.Value) bool {
+	id, ok := v.(string)
+	ids[id] = true
+	return ok
+}
+
+func TestBillingWebhookAppliesRepeatedEventsWithoutIDs(t *testing.T) {
+	h, mock := newTestHandlers(t)
+	h.APIConfig.BillingProviders = map[string]billing.Provider{
+		"polka": &billing.Polka{AuthMode: billing.PolkaAuthHMAC, Secrets: []string{"polka-secret"}, Tolerance: time.Hour},
+	}
+	userID := uuid.New()
+	upgrade := fmt.Sprintf(`{"event":"user.upgraded","data":{"user_id":%q}}`, userID)
+	downgrade := fmt.Sprintf(`{"event":"user.downgraded","data":{"user_id":%q}}`, userID)
+
+	// Polka sends no IDs, so the second upgrade has the same body as the
+	// first and only its signed timestamp tells them apart.
+	start := time.Now().Add(-time.Minute)
+	deliveries := []struct {
+		body      string
+		eventType string
+		from      billing.Status
+		to        billing.Status
+	}{
+		{upgrade, "user.upgraded", "", billing.StatusActive},
+		{downgrade, "user.downgraded", billing.StatusActive, billing.StatusExpired},
+		{upgrade, "user.upgraded", billing.StatusExpired, billing.StatusActive},
+	}
+
+	ids := eventIDs{}
+	for i, delivery := range deliveries {
+		sentAt := start.Add(time.Duration(i) * time.Second)
+		mock.ExpectQuery("ClaimWebhookEvent").WithArgs("polka", ids, delivery.eventType, delivery.body).WillReturnRows(
+			sqlmock.NewRows(webhookEventColumns).AddRow("polka", "", delivery.eventType, delivery.body, "processing", nil, 1, sentAt, sentAt, nil),
+		)
+		expectSubscriptionEvent(mock, userID, delivery.from, sentAt.Add(-time.Second), delivery.to)
+
+		req := httptest.NewRequest(http.MethodPost, "/api/billing/polka/webhooks", strings.NewReader(delivery.body))
+		req.SetPathValue("provider", "polka")
+		req.Header.Set(billing.PolkaTimestampHeader, strconv.FormatInt(sentAt.Unix(), 10))
+		req.Header.Set(billing.PolkaSignatureHeader, auth.SignWebhook("polka-secret", sentAt, []byte(delivery.body)))
+		rec := httptest.NewRecorder()
+		h.BillingWebhook(rec, req)
+
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("Expected delivery %d to be processed with 204, got %d: %s", i+1, rec.Code, rec.Body.String())
+		}
+	}
+
+	if len(ids) != len(deliveries) {
+		t.Fatalf("Expected each delivery to be its own event, got event IDs %v", ids)
+	}
+}
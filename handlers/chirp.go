@@ -2,65 +2,70 @@ package handlers
 
 import (
 	"chirpy/internal/auth"
+	"chirpy/internal/config"
 	"chirpy/internal/database"
+	"chirpy/internal/webhooks"
 	"chirpy/utils"
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
-	"log"
+	"log/slog"
 	"net/http"
 
 	"github.com/google/uuid"
 )
 
+const maxChirpLength = 140
+
+var errChirpTooLong = errors.New("chirp is too long")
+
+// validateChirp checks a chirp body against the rules every chirp follows,
+// however it is created.
+func validateChirp(body string) error {
+	if len(body) > maxChirpLength {
+		return errChirpTooLong
+	}
+	return nil
+}
+
 func (a *APIHandlerStruct) CreateChirp(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		log.Printf("GetBearerToken error: %v", err)
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
 		w.WriteHeader(http.StatusUnauthorized)
 		return
 	}
 
-	userUUID, err := auth.ValidateJWT(token, a.APIConfig.JWTSecret)
-	if err != nil {
-		log.Printf("failed to validate JWT: %v", err)
-		w.WriteHeader(http.StatusUnauthorized)
+	if !a.requireVerifiedEmail(w, r, principal.UserID, config.ActionPostChirps) {
 		return
 	}
 
 	var chirpStr Chirp
 	decode := json.NewDecoder(r.Body)
-	err = decode.Decode(&chirpStr)
+	err := decode.Decode(&chirpStr)
 	if err != nil {
-		log.Printf("failed to decode data: %v", err)
+		slog.ErrorContext(r.Context(), "failed to decode data", "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		utils.RespondError(w, http.StatusInternalServerError, "Something went wrong")
 		return
 	}
 
-	if len(chirpStr.Body) > 140 {
+	if validateChirp(chirpStr.Body) != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		utils.RespondError(w, http.StatusInternalServerError, "Chirp is too long")
 		return
 	}
 
-	userID, err := uuid.Parse(userUUID)
-	if err != nil {
-		log.Printf("failed to parse user UUID: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-
 	params := database.CreateChirpParams{
 		Body:   chirpStr.Body,
-		UserID: userID,
+		UserID: principal.UserID,
 	}
 
-	chirp, err := a.DBQueries.CreateChirp(r.Context(), params)
+	chirp, err := a.createChirp(r.Context(), params)
 	if err != nil {
-		log.Printf("failed to create chrip: %v", err)
+		slog.ErrorContext(r.Context(), "failed to create chrip", "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		utils.RespondError(w, http.StatusInternalServerError, "Something went wrong")
 		return
@@ -95,7 +100,7 @@ func (a *APIHandlerStruct) ListChirps(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err != nil {
-		log.Printf("failed to list chrip: %v", err)
+		slog.ErrorContext(r.Context(), "failed to list chrip", "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		utils.RespondError(w, http.StatusInternalServerError, "Something went wrong")
 		return
@@ -109,7 +114,8 @@ func (a *APIHandlerStruct) GetChirp(w http.ResponseWriter, r *http.Request) {
 	chirpID := r.PathValue("chirpID")
 	u, err := uuid.Parse(chirpID)
 	if err != nil {
-		log.Fatalf("failed to parse UUID: %v", err)
+		utils.RespondError(w, http.StatusBadRequest, "Invalid chirp ID")
+		return
 	}
 	chirp, err := a.DBQueries.GetChirp(r.Context(), u)
 	if err != nil {
@@ -117,7 +123,7 @@ func (a *APIHandlerStruct) GetChirp(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusNotFound)
 			return
 		}
-		log.Printf("failed to get chrip: %v", err)
+		slog.ErrorContext(r.Context(), "failed to get chrip", "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		utils.RespondError(w, http.StatusInternalServerError, "Something went wrong")
 		return
@@ -128,28 +134,17 @@ func (a *APIHandlerStruct) GetChirp(w http.ResponseWriter, r *http.Request) {
 }
 
 func (a *APIHandlerStruct) DeleteChirp(w http.ResponseWriter, r *http.Request) {
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		log.Printf("GetBearerToken error: %v", err)
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
 		w.WriteHeader(http.StatusUnauthorized)
 		return
 	}
-
-	userUUID, err := auth.ValidateJWT(token, a.APIConfig.JWTSecret)
-	if err != nil {
-		log.Printf("failed to validate JWT: %v", err)
-		w.WriteHeader(http.StatusUnauthorized)
-		return
-	}
-
-	userID, err := uuid.Parse(userUUID)
-	if err != nil {
-		log.Fatalf("failed to parse user UUID: %v", err)
-	}
+	userID := principal.UserID
 
 	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
 	if err != nil {
-		log.Fatalf("failed to parse chirp UUID: %v", err)
+		utils.RespondError(w, http.StatusBadRequest, "Invalid chirp ID")
+		return
 	}
 
 	chirp, err := a.DBQueries.GetChirp(r.Context(), chirpID)
@@ -159,7 +154,7 @@ func (a *APIHandlerStruct) DeleteChirp(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		log.Printf("failed to get chrip: %v", err)
+		slog.ErrorContext(r.Context(), "failed to get chrip", "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		utils.RespondError(w, http.StatusInternalServerError, "Something went wrong")
 		return
@@ -170,13 +165,13 @@ func (a *APIHandlerStruct) DeleteChirp(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = a.DBQueries.DeleteChirp(r.Context(), database.DeleteChirpParams{ID: chirpID, UserID: userID})
+	err = a.deleteChirp(r.Context(), chirp)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			w.WriteHeader(http.StatusNotFound)
 			return
 		}
-		log.Printf("failed to get chrip: %v", err)
+		slog.ErrorContext(r.Context(), "failed to get chrip", "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		utils.RespondError(w, http.StatusInternalServerError, "Something went wrong")
 		return
@@ -185,3 +180,60 @@ func (a *APIHandlerStruct) DeleteChirp(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 	utils.RespondJSON(w, http.StatusOK, chirp)
 }
+
+// ChirpDeletedEvent is the data of a chirp.deleted webhook.
+type ChirpDeletedEvent struct {
+	ID     uuid.UUID `json:"id"`
+	UserID uuid.UUID `json:"user_id"`
+}
+
+// createChirp stores a chirp and queues its chirp.created webhooks together.
+func (a *APIHandlerStruct) createChirp(ctx context.Context, params database.CreateChirpParams) (database.Chirp, error) {
+	tx, err := a.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return database.Chirp{}, err
+	}
+	defer tx.Rollback()
+
+	qtx := a.DBQueries.InTx(tx)
+
+	chirp, err := qtx.CreateChirp(ctx, params)
+	if err != nil {
+		return database.Chirp{}, err
+	}
+
+	err = webhooks.Enqueue(ctx, qtx, webhooks.EventChirpCreated, chirp.UserID, chirp)
+	if err != nil {
+		return database.Chirp{}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return database.Chirp{}, err
+	}
+
+	a.APIMetrics.ChirpsCreatedBy("api", 1)
+	return chirp, nil
+}
+
+func (a *APIHandlerStruct) deleteChirp(ctx context.Context, chirp database.Chirp) error {
+	tx, err := a.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	qtx := a.DBQueries.InTx(tx)
+
+	err = qtx.DeleteChirp(ctx, database.DeleteChirpParams{ID: chirp.ID, UserID: chirp.UserID})
+	if err != nil {
+		return err
+	}
+
+	err = webhooks.Enqueue(ctx, qtx, webhooks.EventChirpDeleted, chirp.UserID, ChirpDeletedEvent{ID: chirp.ID, UserID: chirp.UserID})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"chirpy/internal/auth"
+	"chirpy/internal/config"
+	"chirpy/internal/database"
+	"chirpy/internal/importer"
+	"chirpy/internal/webhooks"
+	"chirpy/utils"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"time"
+)
+
+const (
+	maxImportSize      = 10 << 20
+	maxImportRecords   = 10000
+	chirpImportBatch   = 500
+	importTimestampFmt = "2006-01-02 15:04:05.999999"
+)
+
+type ImportChirpsResponse struct {
+	Accepted int                `json:"accepted"`
+	Rejected int                `json:"rejected"`
+	Lines    []ImportLineResult `json:"lines"`
+}
+
+type ImportLineResult struct {
+	Line     int    `json:"line"`
+	Accepted bool   `json:"accepted"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ImportChirps creates chirps from an uploaded archive, either as the raw
+// request body or as the "archive" field of a multipart form. The format comes
+// from the format query parameter, the file name or the Content-Type. Every
+// record goes through the same checks as CreateChirp, and the accepted ones
+// are inserted together: either all of them are imported or none are.
+func (a *APIHandlerStruct) ImportChirps(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	if !a.requireVerifiedEmail(w, r, principal.UserID, config.ActionPostChirps) {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+
+	archive, formatHint, err := importArchive(r)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, fmt.Sprintf("Invalid upload: %v", err))
+		return
+	}
+	defer archive.Close()
+
+	if format := r.URL.Query().Get("format"); format != "" {
+		formatHint = format
+	}
+
+	format, err := importer.ParseFormat(formatHint)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "Unsupported format, use json, jsonl, csv or tweets")
+		return
+	}
+
+	records, err := importer.Parse(archive, format)
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		utils.RespondError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Archives are limited to %d MB", maxImportSize>>20))
+		return
+	}
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, fmt.Sprintf("Could not read the archive: %v", err))
+		return
+	}
+
+	if len(records) > maxImportRecords {
+		utils.RespondError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Archives are limited to %d chirps", maxImportRecords))
+		return
+	}
+
+	response := ImportChirpsResponse{Lines: make([]ImportLineResult, 0, len(records))}
+	var bodies, createdAts []string
+	now := time.Now()
+	for _, record := range records {
+		err := record.Err
+		if err == nil {
+			err = validateChirp(record.Body)
+		}
+		if err == nil && record.Body == "" {
+			err = importer.ErrMissingBody
+		}
+		if err == nil && record.CreatedAt != nil && record.CreatedAt.After(now) {
+			err = errors.New("created_at is in the future")
+		}
+
+		if err != nil {
+			response.Rejected++
+			response.Lines = append(response.Lines, ImportLineResult{Line: record.Line, Error: err.Error()})
+			continue
+		}
+
+		createdAt := ""
+		if record.CreatedAt != nil {
+			createdAt = record.CreatedAt.UTC().Format(importTimestampFmt)
+		}
+		bodies = append(bodies, record.Body)
+		createdAts = append(createdAts, createdAt)
+
+		response.Accepted++
+		response.Lines = append(response.Lines, ImportLineResult{Line: record.Line, Accepted: true})
+	}
+
+	tx, err := a.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to begin transaction", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	qtx := a.DBQueries.InTx(tx)
+
+	var imported int
+	for start := 0; start < len(bodies); start += chirpImportBatch {
+		end := min(start+chirpImportBatch, len(bodies))
+
+		chirps, err := qtx.ImportChirps(r.Context(), database.ImportChirpsParams{
+			UserID:            principal.UserID,
+			Bodies:            bodies[start:end],
+			ImportedCreatedAt: createdAts[start:end],
+		})
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to import chirps", "error", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		// Imported chirps are new to subscribers like any other.
+		for _, chirp := range chirps {
+			err = webhooks.Enqueue(r.Context(), qtx, webhooks.EventChirpCreated, chirp.UserID, chirp)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "failed to queue chirp.created webhooks", "error", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+		}
+		imported += len(chirps)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to commit chirp import", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	a.APIMetrics.ChirpsCreatedBy("import", imported)
+	utils.RespondJSON(w, http.StatusOK, response)
+}
+
+// importArchive returns the uploaded archive and a hint of its format: the
+// file name for multipart uploads, the Content-Type otherwise.
+func importArchive(r *http.Request) (io.ReadCloser, string, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return io.NopCloser(r.Body), r.Header.Get("Content-Type"), nil
+	}
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, "", err
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			return nil, "", errors.New("missing archive field")
+		}
+		if err != nil {
+			return nil, "", err
+		}
+
+		if part.FormName() == "archive" {
+			return part, part.FileName(), nil
+		}
+		part.Close()
+	}
+}
@@ -0,0 +1,65 @@
+package handlers_test
+
+import (
+	"chirpy/internal/auth"
+	"chirpy/internal/webhooks"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+)
+
+func TestImportChirpsQueuesWebhooksInTheSameTransaction(t *testing.T) {
+	a, mock := newTestHandlers(t)
+	userID := uuid.New()
+
+	now := time.Now()
+	rows := sqlmock.NewRows([]string{"id", "created_at", "updated_at", "body", "user_id", "imported_created_at"}).
+		AddRow(uuid.New(), now, now, "first", userID, nil).
+		AddRow(uuid.New(), now, now, "second", userID, nil)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("ImportChirps").WillReturnRows(rows)
+	for range 2 {
+		mock.ExpectExec("EnqueueWebhookDeliveries").
+			WithArgs(sqlmock.AnyArg(), webhooks.EventChirpCreated, sqlmock.AnyArg(), userID.String(), auth.ScopeChirpsRead).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectCommit()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/chirps/import?format=jsonl", strings.NewReader("{\"body\":\"first\"}\n{\"body\":\"second\"}\n"))
+	req = req.WithContext(auth.WithPrincipal(req.Context(), &auth.Principal{UserID: userID}))
+	rec := httptest.NewRecorder()
+	a.ImportChirps(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestImportChirpsRollsBackWhenWebhooksCannotBeQueued(t *testing.T) {
+	a, mock := newTestHandlers(t)
+	userID := uuid.New()
+
+	now := time.Now()
+	mock.ExpectBegin()
+	mock.ExpectQuery("ImportChirps").WillReturnRows(
+		sqlmock.NewRows([]string{"id", "created_at", "updated_at", "body", "user_id", "imported_created_at"}).
+			AddRow(uuid.New(), now, now, "first", userID, nil),
+	)
+	mock.ExpectExec("EnqueueWebhookDeliveries").WillReturnError(sqlmock.ErrCancelled)
+	mock.ExpectRollback()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/chirps/import?format=jsonl", strings.NewReader("{\"body\":\"first\"}\n"))
+	req = req.WithContext(auth.WithPrincipal(req.Context(), &auth.Principal{UserID: userID}))
+	rec := httptest.NewRecorder()
+	a.ImportChirps(rec, req)
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected status 500, got %d", rec.Code)
+	}
+}
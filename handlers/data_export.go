@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"chirpy/internal/auth"
+	"chirpy/internal/database"
+	"chirpy/utils"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	dataExportTTL         = 7 * 24 * time.Hour
+	dataExportDownloadTTL = 15 * time.Minute
+)
+
+type DataExportResponse struct {
+	ID          uuid.UUID  `json:"id"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	DownloadURL string     `json:"download_url,omitempty"`
+}
+
+func newDataExportResponse(row database.GetDataExportRow) DataExportResponse {
+	response := DataExportResponse{
+		ID:        row.ID,
+		Status:    row.Status,
+		CreatedAt: row.CreatedAt,
+		ExpiresAt: row.ExpiresAt,
+	}
+	if row.CompletedAt.Valid {
+		response.CompletedAt = &row.CompletedAt.Time
+	}
+	return response
+}
+
+// RequestDataExport queues an archive of everything the signed-in user has
+// stored with us. The BuildDataExports job builds it; poll GetDataExport for
+// its status and download link.
+func (a *APIHandlerStruct) RequestDataExport(w http.ResponseWriter, r *http.Request) {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	pending, err := a.DBQueries.CountPendingDataExports(r.Context(), principal.UserID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to count pending data exports", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if pending > 0 {
+		utils.RespondError(w, http.StatusConflict, "An export is already being prepared")
+		return
+	}
+
+	row, err := a.DBQueries.CreateDataExport(r.Context(), database.CreateDataExportParams{
+		UserID:    principal.UserID,
+		ExpiresAt: time.Now().Add(dataExportTTL),
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to create data export", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Location", "/api/users/me/export/"+row.ID.String())
+	utils.RespondJSON(w, http.StatusAccepted, newDataExportResponse(database.GetDataExportRow(row)))
+}
+
+// GetDataExport reports the status of one of the signed-in user's exports,
+// with a short-lived download link once it is ready. Following that link
+// hits this same route with a signature in the query string, which is all the
+// download needs: it works from a plain browser link, without a token.
+func (a *APIHandlerStruct) GetDataExport(w http.ResponseWriter, r *http.Request) {
+	exportID, err := uuid.Parse(r.PathValue("exportID"))
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid export ID")
+		return
+	}
+
+	if r.URL.Query().Has("signature") {
+		a.downloadDataExport(w, r, exportID)
+		return
+	}
+
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	if !principal.IsSession() {
+		utils.RespondError(w, http.StatusForbidden, "This endpoint requires a user session")
+		return
+	}
+
+	row, err := a.DBQueries.GetDataExport(r.Context(), database.GetDataExportParams{
+		ID:     exportID,
+		UserID: principal.UserID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.RespondError(w, http.StatusNotFound, "Export not found")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get data export", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response := newDataExportResponse(row)
+	if row.Status == "ready" {
+		expires := time.Now().Add(dataExportDownloadTTL)
+		if row.ExpiresAt.Before(expires) {
+			expires = row.ExpiresAt
+		}
+		response.DownloadURL = a.APIConfig.BaseURL + r.URL.Path + "?" + auth.SignURL(a.APIConfig.JWTSecret, r.URL.Path, expires)
+	}
+
+	utils.RespondJSON(w, http.StatusOK, response)
+}
+
+func (a *APIHandlerStruct) downloadDataExport(w http.ResponseWriter, r *http.Request, exportID uuid.UUID) {
+	err := auth.VerifySignedURL(a.APIConfig.JWTSecret, r.URL.Path, r.URL.Query(), time.Now())
+	if errors.Is(err, auth.ErrSignatureExpired) {
+		utils.RespondError(w, http.StatusForbidden, "This download link has expired")
+		return
+	}
+	if err != nil {
+		utils.RespondError(w, http.StatusForbidden, "Invalid download link")
+		return
+	}
+
+	archive, err := a.DBQueries.GetDataExportArchive(r.Context(), exportID)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.RespondError(w, http.StatusNotFound, "Export not found")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get data export archive", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="chirpy-export-%s.zip"`, exportID))
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Length", strconv.Itoa(len(archive)))
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(archive)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to write data export archive", "error", err)
+	}
+}
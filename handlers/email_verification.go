@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"chirpy/internal/auth"
+	"chirpy/internal/database"
+	"chirpy/internal/mailer"
+	"chirpy/utils"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const emailVerificationTTL = 24 * time.Hour
+
+type EmailVerificationParams struct {
+	Token string `json:"token"`
+}
+
+// sendEmailVerification emails a confirmation link for email. For an email
+// change the address only replaces the current one once the link is used.
+func (a *APIHandlerStruct) sendEmailVerification(ctx context.Context, userID uuid.UUID, email string) {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to create email verification token", "error", err)
+		return
+	}
+
+	err = a.DBQueries.CreateEmailVerificationToken(ctx, database.CreateEmailVerificationTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    userID,
+		Email:     email,
+		ExpiresAt: time.Now().Add(emailVerificationTTL),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to store email verification token", "error", err)
+		return
+	}
+
+	link := a.APIConfig.BaseURL + "/app/verify-email.html?token=" + url.QueryEscape(token)
+	err = a.Mailer.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Confirm your email for Chirpy",
+		Body: fmt.Sprintf("Confirm this address for your Chirpy account by following this link within %d hours:\n\n%s\n\n"+
+			"If you didn't ask for this, you can ignore this email.", int(emailVerificationTTL.Hours()), link),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to send email verification", "error", err)
+	}
+}
+
+// VerifyEmail marks the address from a verification link as verified. If it
+// differs from the user's current email this completes an email change.
+func (a *APIHandlerStruct) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var params EmailVerificationParams
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&params)
+	if err != nil || params.Token == "" {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	tx, err := a.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to begin transaction", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	qtx := a.DBQueries.InTx(tx)
+
+	verification, err := qtx.ConsumeEmailVerificationToken(r.Context(), auth.HashToken(params.Token))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.RespondError(w, http.StatusBadRequest, "Invalid or expired token")
+			return
+		}
+
+		slog.ErrorContext(r.Context(), "failed to consume email verification token", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	user, err := qtx.VerifyUserEmail(r.Context(), database.VerifyUserEmailParams{
+		ID:    verification.UserID,
+		Email: verification.Email,
+	})
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			utils.RespondError(w, http.StatusConflict, "Email is already in use")
+			return
+		}
+
+		slog.ErrorContext(r.Context(), "failed to verify email", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = qtx.InvalidateEmailVerificationTokens(r.Context(), user.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to invalidate email verification tokens", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to commit email verification", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	user.HashedPassword = ""
+	utils.RespondJSON(w, http.StatusOK, user)
+}
+
+// ResendEmailVerification sends a new link for an unverified account.
+func (a *APIHandlerStruct) ResendEmailVerification(w http.ResponseWriter, r *http.Request) {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	user, err := a.DBQueries.GetUserByID(r.Context(), principal.UserID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get user", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if user.EmailVerifiedAt.Valid {
+		utils.RespondError(w, http.StatusConflict, "Email is already verified")
+		return
+	}
+
+	go a.sendEmailVerification(context.WithoutCancel(r.Context()), user.ID, user.Email)
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// requireVerifiedEmail writes a 403 and returns false when action is
+// restricted for unverified accounts and the user has not verified yet.
+func (a *APIHandlerStruct) requireVerifiedEmail(w http.ResponseWriter, r *http.Request, userID uuid.UUID, action string) bool {
+	if !a.APIConfig.RestrictsUnverified(action) {
+		return true
+	}
+
+	user, err := a.DBQueries.GetUserByID(r.Context(), userID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get user", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return false
+	}
+
+	if !user.EmailVerifiedAt.Valid {
+		utils.RespondError(w, http.StatusForbidden, "Verify your email address first")
+		return false
+	}
+
+	return true
+}
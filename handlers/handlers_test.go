@@ -0,0 +1,63 @@
+package handlers_test
+
+import (
+	"chirpy/handlers"
+	"chirpy/internal/config"
+	"chirpy/internal/database"
+	"chirpy/internal/health"
+	"chirpy/internal/mailer"
+	"chirpy/metrics"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/alexedwards/argon2id"
+)
+
+const testSecret = "test-secret"
+
+// fastPasswordParams keep password hashing in tests quick.
+var fastPasswordParams = &argon2id.Params{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+// sentMail is a mailer.Mailer that hands every message to the test.
+type sentMail chan mailer.Message
+
+func (m sentMail) Send(ctx context.Context, msg mailer.Message) error {
+	m <- msg
+	return nil
+}
+
+// receiveMail waits for a message sent in the background.
+func receiveMail(t *testing.T, mail sentMail) mailer.Message {
+	t.Helper()
+
+	select {
+	case msg := <-mail:
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("Expected an email to be sent")
+		return mailer.Message{}
+	}
+}
+
+// newTestHandlers returns handlers backed by a mock database. Queries are
+// matched by their sqlc name, and every expectation must be met by the end
+// of the test.
+func newTestHandlers(t *testing.T) (*handlers.APIHandlerStruct, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open mock database: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		db.Close()
+	})
+
+	apiConfig := &config.APIConfig{JWTSecret: testSecret}
+	return handlers.NewAPIHandler(apiConfig, metrics.NewAPIMetrics(), db, database.New(db), nil, nil, &health.Readiness{}), mock
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"chirpy/internal/auth"
+	"chirpy/internal/database"
+	"chirpy/internal/mailer"
+	"chirpy/utils"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const magicLinkTTL = 15 * time.Minute
+
+type MagicLinkRequestParams struct {
+	Email string `json:"email"`
+}
+
+type MagicLinkLoginParams struct {
+	Token string `json:"token"`
+}
+
+// RequestMagicLink emails a single-use login link if the address belongs to
+// an account. Like RequestPasswordReset it answers the same way either way.
+func (a *APIHandlerStruct) RequestMagicLink(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var params MagicLinkRequestParams
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&params)
+	if err != nil || params.Email == "" {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	go a.sendMagicLink(context.WithoutCancel(r.Context()), params.Email)
+
+	var payload struct {
+		Message string `json:"message"`
+	}
+	payload.Message = "If an account exists for that email, a login link has been sent."
+	utils.RespondJSON(w, http.StatusAccepted, payload)
+}
+
+func (a *APIHandlerStruct) sendMagicLink(ctx context.Context, email string) {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	user, err := a.DBQueries.GetUser(ctx, email)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			slog.ErrorContext(ctx, "failed to get user for magic link", "error", err)
+		}
+		return
+	}
+
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to create magic link token", "error", err)
+		return
+	}
+
+	err = a.DBQueries.CreateMagicLinkToken(ctx, database.CreateMagicLinkTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(magicLinkTTL),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to store magic link token", "error", err)
+		return
+	}
+
+	link := a.APIConfig.BaseURL + "/app/magic-link.html?token=" + url.QueryEscape(token)
+	err = a.Mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Your Chirpy login link",
+		Body: fmt.Sprintf("Follow this link within %d minutes to log in to Chirpy:\n\n%s\n\n"+
+			"The link works once. If you didn't ask for it, you can ignore this email.", int(magicLinkTTL.Minutes()), link),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to send magic link", "error", err)
+	}
+}
+
+// MagicLinkLogin exchanges a token from RequestMagicLink for the same session
+// Login issues, including the two-factor challenge for users who enabled it.
+func (a *APIHandlerStruct) MagicLinkLogin(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var params MagicLinkLoginParams
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&params)
+	if err != nil || params.Token == "" {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	userID, err := a.DBQueries.ConsumeMagicLinkToken(r.Context(), auth.HashToken(params.Token))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.RespondError(w, http.StatusUnauthorized, "Invalid or expired login link")
+			return
+		}
+
+		slog.ErrorContext(r.Context(), "failed to consume magic link token", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	user, err := a.DBQueries.GetUserByID(r.Context(), userID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get user", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Following the link proves the user reads mail at this address.
+	if !user.EmailVerifiedAt.Valid {
+		user, err = a.DBQueries.VerifyUserEmail(r.Context(), database.VerifyUserEmailParams{
+			ID:    user.ID,
+			Email: user.Email,
+		})
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to verify email through magic link", "error", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	a.completeLogin(w, r, user, utils.ClientIP(r, a.APIConfig.TrustProxyHeaders))
+}
@@ -0,0 +1,191 @@
+package handlers_test
+
+import (
+	"chirpy/handlers"
+	"chirpy/internal/auth"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+)
+
+// consumeMagicLinkToken matches ConsumeMagicLinkToken only while it marks the
+// token used and skips tokens that are used or expired.
+const consumeMagicLinkToken = `(?s)ConsumeMagicLinkToken.*SET used_at = NOW\(\).*used_at IS NULL AND expires_at > NOW\(\)`
+
+func requestMagicLink(h *handlers.APIHandlerStruct, email string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/login/magic-link", strings.NewReader(`{"email":"`+email+`"}`))
+	rec := httptest.NewRecorder()
+	h.RequestMagicLink(rec, req)
+	return rec
+}
+
+func magicLinkLogin(h *handlers.APIHandlerStruct, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/login/magic-link/verify", strings.NewReader(`{"token":"`+token+`"}`))
+	rec := httptest.NewRecorder()
+	h.MagicLinkLogin(rec, req)
+	return rec
+}
+
+// magicLinkToken returns the token of the login link in body.
+func magicLinkToken(t *testing.T, body string) string {
+	t.Helper()
+
+	_, link, found := strings.Cut(body, "?")
+	if !found {
+		t.Fatalf("Expected a login link in %q", body)
+	}
+	link, _, _ = strings.Cut(link, "\n")
+	query, err := url.ParseQuery(link)
+	if err != nil || query.Get("token") == "" {
+		t.Fatalf("Expected a token in the login link, got %q", link)
+	}
+	return query.Get("token")
+}
+
+// waitForExpectations waits for queries run in the background to be made.
+func waitForExpectations(t *testing.T, mock sqlmock.Sqlmock) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for mock.ExpectationsWereMet() != nil {
+		if time.Now().After(deadline) {
+			t.Fatal(mock.ExpectationsWereMet())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// expectMagicLinkUser expects token to be consumed as userID's magic link.
+func expectMagicLinkUser(mock sqlmock.Sqlmock, token string, userID uuid.UUID) {
+	now := time.Now()
+	mock.ExpectQuery(consumeMagicLinkToken).WithArgs(auth.HashToken(token)).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(userID.String()))
+	mock.ExpectQuery("GetUserByID").WithArgs(userID.String()).WillReturnRows(
+		sqlmock.NewRows(userColumns).AddRow(userID.String(), "user@example.com", now, now, "hash", false, "user", now, nil),
+	)
+}
+
+func TestMagicLinksWorkOnce(t *testing.T) {
+	h, mock := newTestHandlers(t)
+	mail := make(sentMail, 1)
+	h.Mailer = mail
+	userID := uuid.New()
+	now := time.Now()
+
+	mock.ExpectQuery("GetUser").WithArgs("user@example.com").WillReturnRows(
+		sqlmock.NewRows(userColumns).AddRow(userID.String(), "user@example.com", now, now, "hash", false, "user", now, nil),
+	)
+	mock.ExpectExec("CreateMagicLinkToken").WithArgs(sqlmock.AnyArg(), userID.String(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	rec := requestMagicLink(h, "user@example.com")
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("Expected the request to be accepted with 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+	token := magicLinkToken(t, receiveMail(t, mail).Body)
+
+	expectMagicLinkUser(mock, token, userID)
+	mock.ExpectQuery("GetTOTP").WithArgs(userID.String()).WillReturnRows(sqlmock.NewRows(nil))
+	mock.ExpectExec("RecordLoginAttempt").WithArgs("user@example.com", sqlmock.AnyArg(), true).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("CreateRefreshToken").WillReturnRows(
+		sqlmock.NewRows(refreshTokenColumns).AddRow("refresh-token", now, now, userID.String(), now.Add(time.Hour), nil, uuid.NewString(), nil, nil),
+	)
+
+	rec = magicLinkLogin(h, token)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected the link to log in, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var response handlers.LoginResponse
+	err := json.Unmarshal(rec.Body.Bytes(), &response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Token == "" || response.RefreshToken == "" {
+		t.Fatalf("Expected a session, got %s", rec.Body.String())
+	}
+
+	// The first login marked the token used, so it no longer matches.
+	mock.ExpectQuery(consumeMagicLinkToken).WithArgs(auth.HashToken(token)).WillReturnError(sql.ErrNoRows)
+
+	rec = magicLinkLogin(h, token)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected a used link to be rejected with 401, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestMagicLinkLoginRejectsExpiredLinks(t *testing.T) {
+	h, mock := newTestHandlers(t)
+
+	mock.ExpectQuery(consumeMagicLinkToken).WithArgs(auth.HashToken("expired-token")).WillReturnError(sql.ErrNoRows)
+
+	rec := magicLinkLogin(h, "expired-token")
+	if rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), "Invalid or expired login link") {
+		t.Fatalf("Expected an expired link to be rejected with 401, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestMagicLinkLoginRequiresTwoFactor(t *testing.T) {
+	h, mock := newTestHandlers(t)
+	userID := uuid.New()
+	now := time.Now()
+
+	// No session may be created before the second factor is checked.
+	expectMagicLinkUser(mock, "link-token", userID)
+	mock.ExpectQuery("GetTOTP").WithArgs(userID.String()).WillReturnRows(
+		sqlmock.NewRows([]string{"user_id", "secret", "confirmed_at", "last_used_step", "created_at", "updated_at"}).
+			AddRow(userID.String(), "secret", now, 0, now, now),
+	)
+
+	rec := magicLinkLogin(h, "link-token")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected a two-factor challenge with 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var challenge handlers.TwoFactorChallengeResponse
+	err := json.Unmarshal(rec.Body.Bytes(), &challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !challenge.TwoFactorRequired || challenge.ChallengeToken == "" || strings.Contains(rec.Body.String(), `"refresh_token"`) {
+		t.Fatalf("Expected a challenge instead of a session, got %s", rec.Body.String())
+	}
+}
+
+func TestRequestMagicLinkDoesNotRevealRegisteredEmails(t *testing.T) {
+	h, mock := newTestHandlers(t)
+	mail := make(sentMail, 1)
+	h.Mailer = mail
+	now := time.Now()
+
+	mock.ExpectQuery("GetUser").WithArgs("user@example.com").WillReturnRows(
+		sqlmock.NewRows(userColumns).AddRow(uuid.NewString(), "user@example.com", now, now, "hash", false, "user", now, nil),
+	)
+	mock.ExpectExec("CreateMagicLinkToken").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	known := requestMagicLink(h, "user@example.com")
+	receiveMail(t, mail)
+
+	mock.ExpectQuery("GetUser").WithArgs("nobody@example.com").WillReturnError(sql.ErrNoRows)
+
+	unknown := requestMagicLink(h, "nobody@example.com")
+	waitForExpectations(t, mock)
+
+	if known.Code != http.StatusAccepted || unknown.Code != known.Code {
+		t.Fatalf("Expected both requests to get 202, got %d and %d", known.Code, unknown.Code)
+	}
+	if unknown.Body.String() != known.Body.String() {
+		t.Fatalf("Expected the same body for both requests, got %s and %s", known.Body.String(), unknown.Body.String())
+	}
+	select {
+	case msg := <-mail:
+		t.Fatalf("Expected no email for an unknown address, got %+v", msg)
+	default:
+	}
+}
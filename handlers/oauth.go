@@ -0,0 +1,688 @@
+package handlers
+
+import (
+	"chirpy/internal/auth"
+	"chirpy/internal/database"
+	"chirpy/utils"
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	authorizationCodeTTL = 5 * time.Minute
+	oauthAccessTokenTTL  = time.Hour
+)
+
+// AuthorizationRequest holds the parameters of an authorization code request
+// (RFC 6749 section 4.1.1 with PKCE). GET /api/oauth/authorize receives them
+// in the query string and the consent page posts them back as JSON.
+type AuthorizationRequest struct {
+	ResponseType        string `json:"response_type"`
+	ClientID            string `json:"client_id"`
+	RedirectURI         string `json:"redirect_uri"`
+	Scope               string `json:"scope"`
+	State               string `json:"state"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+}
+
+type ConsentParams struct {
+	AuthorizationRequest
+	Approved bool `json:"approved"`
+}
+
+type ConsentResponse struct {
+	RedirectTo string `json:"redirect_to"`
+}
+
+type OAuthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+}
+
+// IntrospectionResponse follows RFC 7662. Inactive tokens only carry Active.
+type IntrospectionResponse struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+}
+
+// oauthError is an error response as defined in RFC 6749 section 5.2.
+type oauthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func respondOAuthError(w http.ResponseWriter, status int, code, description string) {
+	w.Header().Set("Cache-Control", "no-store")
+	utils.RespondJSON(w, status, oauthError{Code: code, Description: description})
+}
+
+func authorizationRequestFromQuery(query url.Values) AuthorizationRequest {
+	return AuthorizationRequest{
+		ResponseType:        query.Get("response_type"),
+		ClientID:            query.Get("client_id"),
+		RedirectURI:         query.Get("redirect_uri"),
+		Scope:               query.Get("scope"),
+		State:               query.Get("state"),
+		CodeChallenge:       query.Get("code_challenge"),
+		CodeChallengeMethod: query.Get("code_challenge_method"),
+	}
+}
+
+// lookupAuthorizationClient returns the client of an authorization request
+// once its redirect URI is known to be registered. Until then errors must be
+// shown to the user rather than sent to the redirect URI.
+func (a *APIHandlerStruct) lookupAuthorizationClient(ctx context.Context, req AuthorizationRequest) (database.OauthClient, *oauthError, error) {
+	clientID, err := uuid.Parse(req.ClientID)
+	if err != nil {
+		return database.OauthClient{}, &oauthError{"invalid_client", "Unknown client"}, nil
+	}
+
+	client, err := a.DBQueries.GetOAuthClient(ctx, clientID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return database.OauthClient{}, &oauthError{"invalid_client", "Unknown client"}, nil
+		}
+		return database.OauthClient{}, nil, err
+	}
+
+	if !slices.Contains(client.RedirectUris, req.RedirectURI) {
+		return database.OauthClient{}, &oauthError{"invalid_request", "redirect_uri is not registered for this client"}, nil
+	}
+
+	return client, nil, nil
+}
+
+// validate checks the parts of an authorization request whose errors are
+// reported to the client through its redirect URI.
+func (req AuthorizationRequest) validate(client database.OauthClient) ([]string, *oauthError) {
+	if req.ResponseType != "code" {
+		return nil, &oauthError{"unsupported_response_type", "Only the code response type is supported"}
+	}
+
+	if req.CodeChallengeMethod != "S256" || !auth.IsValidCodeChallenge(req.CodeChallenge) {
+		return nil, &oauthError{"invalid_request", "PKCE with code_challenge_method S256 is required"}
+	}
+
+	scopes := auth.ParseScope(req.Scope)
+	if len(scopes) == 0 {
+		return nil, &oauthError{"invalid_scope", "scope is required"}
+	}
+
+	for _, scope := range scopes {
+		if !slices.Contains(client.Scopes, scope) {
+			return nil, &oauthError{"invalid_scope", "Scope not allowed for this client: " + scope}
+		}
+	}
+
+	return scopes, nil
+}
+
+func authorizationRedirect(redirectURI string, params url.Values) string {
+	uri, err := url.Parse(redirectURI)
+	if err != nil {
+		// Registered redirect URIs are validated, so this cannot happen.
+		return redirectURI
+	}
+
+	query := uri.Query()
+	for key, values := range params {
+		for _, value := range values {
+			query.Add(key, value)
+		}
+	}
+	uri.RawQuery = query.Encode()
+	return uri.String()
+}
+
+func authorizationErrorRedirect(req AuthorizationRequest, oauthErr *oauthError) string {
+	params := url.Values{"error": {oauthErr.Code}}
+	if oauthErr.Description != "" {
+		params.Set("error_description", oauthErr.Description)
+	}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	return authorizationRedirect(req.RedirectURI, params)
+}
+
+// Authorize is the authorization endpoint. It checks the request and sends
+// the user to the consent page, which asks them to log in if needed and posts
+// their decision to Consent.
+func (a *APIHandlerStruct) Authorize(w http.ResponseWriter, r *http.Request) {
+	req := authorizationRequestFromQuery(r.URL.Query())
+
+	client, oauthErr, err := a.lookupAuthorizationClient(r.Context(), req)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get OAuth client", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if oauthErr != nil {
+		respondOAuthError(w, http.StatusBadRequest, oauthErr.Code, oauthErr.Description)
+		return
+	}
+
+	_, oauthErr = req.validate(client)
+	if oauthErr != nil {
+		http.Redirect(w, r, authorizationErrorRedirect(req, oauthErr), http.StatusFound)
+		return
+	}
+
+	http.Redirect(w, r, "/app/oauth/consent.html?"+r.URL.RawQuery, http.StatusFound)
+}
+
+// Consent records the signed-in user's answer to an authorization request and
+// returns where the consent page should send the browser: the client's
+// redirect URI with either an authorization code or an access_denied error.
+func (a *APIHandlerStruct) Consent(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var params ConsentParams
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&params)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	req := params.AuthorizationRequest
+
+	client, oauthErr, err := a.lookupAuthorizationClient(r.Context(), req)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get OAuth client", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if oauthErr != nil {
+		respondOAuthError(w, http.StatusBadRequest, oauthErr.Code, oauthErr.Description)
+		return
+	}
+
+	scopes, oauthErr := req.validate(client)
+	if oauthErr == nil && !params.Approved {
+		oauthErr = &oauthError{"access_denied", "The user denied the request"}
+	}
+	if oauthErr != nil {
+		utils.RespondJSON(w, http.StatusOK, ConsentResponse{RedirectTo: authorizationErrorRedirect(req, oauthErr)})
+		return
+	}
+
+	code, err := auth.MakeRefreshToken()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to generate authorization code", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = a.DBQueries.CreateAuthorizationCode(r.Context(), database.CreateAuthorizationCodeParams{
+		CodeHash:      auth.HashToken(code),
+		ClientID:      client.ID,
+		UserID:        principal.UserID,
+		RedirectUri:   req.RedirectURI,
+		Scopes:        scopes,
+		CodeChallenge: req.CodeChallenge,
+		ExpiresAt:     time.Now().Add(authorizationCodeTTL),
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to store authorization code", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	redirectParams := url.Values{"code": {code}}
+	if req.State != "" {
+		redirectParams.Set("state", req.State)
+	}
+
+	utils.RespondJSON(w, http.StatusOK, ConsentResponse{RedirectTo: authorizationRedirect(req.RedirectURI, redirectParams)})
+}
+
+var errInvalidClient = errors.New("invalid client credentials")
+
+// authenticateOAuthClient identifies the client calling the token, revocation
+// or introspection endpoint. Confidential clients authenticate with HTTP Basic
+// or a client_secret form field; public clients only send client_id.
+func (a *APIHandlerStruct) authenticateOAuthClient(r *http.Request) (database.OauthClient, error) {
+	rawClientID, secret, hasBasic := r.BasicAuth()
+	if hasBasic {
+		// RFC 6749 section 2.3.1 form-encodes both values before Basic encoding.
+		var err error
+		rawClientID, err = url.QueryUnescape(rawClientID)
+		if err != nil {
+			return database.OauthClient{}, errInvalidClient
+		}
+		secret, err = url.QueryUnescape(secret)
+		if err != nil {
+			return database.OauthClient{}, errInvalidClient
+		}
+	} else {
+		rawClientID = r.PostForm.Get("client_id")
+		secret = r.PostForm.Get("client_secret")
+	}
+
+	clientID, err := uuid.Parse(rawClientID)
+	if err != nil {
+		return database.OauthClient{}, errInvalidClient
+	}
+
+	client, err := a.DBQueries.GetOAuthClient(r.Context(), clientID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return database.OauthClient{}, errInvalidClient
+		}
+		return database.OauthClient{}, err
+	}
+
+	if !client.ClientSecretHash.Valid {
+		if secret != "" {
+			return database.OauthClient{}, errInvalidClient
+		}
+		return client, nil
+	}
+
+	if subtle.ConstantTimeCompare([]byte(auth.HashToken(secret)), []byte(client.ClientSecretHash.String)) != 1 {
+		return database.OauthClient{}, errInvalidClient
+	}
+
+	return client, nil
+}
+
+// parseOAuthClientRequest parses the form of a request to the token,
+// revocation or introspection endpoint and authenticates its client. It writes
+// the error response and returns false when either fails.
+func (a *APIHandlerStruct) parseOAuthClientRequest(w http.ResponseWriter, r *http.Request) (database.OauthClient, bool) {
+	err := r.ParseForm()
+	if err != nil {
+		respondOAuthError(w, http.StatusBadRequest, "invalid_request", "Malformed form body")
+		return database.OauthClient{}, false
+	}
+
+	client, err := a.authenticateOAuthClient(r)
+	if err != nil {
+		if errors.Is(err, errInvalidClient) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="chirpy"`)
+			respondOAuthError(w, http.StatusUnauthorized, "invalid_client", "Client authentication failed")
+			return database.OauthClient{}, false
+		}
+		slog.ErrorContext(r.Context(), "failed to authenticate OAuth client", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return database.OauthClient{}, false
+	}
+
+	return client, true
+}
+
+// Token is the token endpoint. It exchanges authorization codes and refresh
+// tokens for a new access token and refresh token.
+func (a *APIHandlerStruct) Token(w http.ResponseWriter, r *http.Request) {
+	client, ok := a.parseOAuthClientRequest(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		a.exchangeAuthorizationCode(w, r, client)
+	case "refresh_token":
+		a.exchangeOAuthRefreshToken(w, r, client)
+	default:
+		respondOAuthError(w, http.StatusBadRequest, "unsupported_grant_type", "grant_type must be authorization_code or refresh_token")
+	}
+}
+
+func (a *APIHandlerStruct) exchangeAuthorizationCode(w http.ResponseWriter, r *http.Request, client database.OauthClient) {
+	code := r.PostForm.Get("code")
+	redirectURI := r.PostForm.Get("redirect_uri")
+	verifier := r.PostForm.Get("code_verifier")
+	if code == "" || redirectURI == "" || verifier == "" {
+		respondOAuthError(w, http.StatusBadRequest, "invalid_request", "code, redirect_uri and code_verifier are required")
+		return
+	}
+
+	// The code is spent even if the checks below fail, so a stolen code
+	// cannot be retried.
+	authCode, err := a.DBQueries.ConsumeAuthorizationCode(r.Context(), auth.HashToken(code))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondOAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid, expired or used authorization code")
+			return
+		}
+		slog.ErrorContext(r.Context(), "failed to consume authorization code", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if authCode.ClientID != client.ID || authCode.RedirectUri != redirectURI || !auth.VerifyPKCE(verifier, authCode.CodeChallenge) {
+		respondOAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid, expired or used authorization code")
+		return
+	}
+
+	user, err := a.DBQueries.GetUserByID(r.Context(), authCode.UserID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get user for authorization code", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response, err := a.makeOAuthTokens(r.Context(), a.DBQueries, client, user, uuid.New(), authCode.Scopes, authCode.Scopes)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to issue OAuth tokens", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	respondOAuthTokens(w, response)
+}
+
+// exchangeOAuthRefreshToken rotates a refresh token. Presenting a token that
+// was already rotated means it leaked, so the whole grant is revoked.
+func (a *APIHandlerStruct) exchangeOAuthRefreshToken(w http.ResponseWriter, r *http.Request, client database.OauthClient) {
+	token := r.PostForm.Get("refresh_token")
+	if token == "" {
+		respondOAuthError(w, http.StatusBadRequest, "invalid_request", "refresh_token is required")
+		return
+	}
+
+	clientID := uuid.NullUUID{UUID: client.ID, Valid: true}
+	refreshToken, err := a.DBQueries.GetOAuthRefreshToken(r.Context(), database.GetOAuthRefreshTokenParams{
+		Token:    token,
+		ClientID: clientID,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondOAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid, expired or revoked refresh token")
+			return
+		}
+		slog.ErrorContext(r.Context(), "failed to get OAuth refresh token", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if refreshToken.RevokedAt.Valid {
+		err = a.DBQueries.RevokeSession(r.Context(), refreshToken.SessionID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to revoke OAuth grant after refresh token reuse", "error", err)
+		}
+		respondOAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid, expired or revoked refresh token")
+		return
+	}
+
+	if time.Now().After(refreshToken.ExpiresAt) {
+		respondOAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid, expired or revoked refresh token")
+		return
+	}
+
+	// A narrower scope may be requested for the new access token. The new
+	// refresh token keeps the scope of the grant.
+	accessScopes := refreshToken.Scopes
+	if scope := r.PostForm.Get("scope"); scope != "" {
+		accessScopes = auth.ParseScope(scope)
+		if len(accessScopes) == 0 {
+			respondOAuthError(w, http.StatusBadRequest, "invalid_scope", "scope must not be empty")
+			return
+		}
+		for _, s := range accessScopes {
+			if !slices.Contains(refreshToken.Scopes, s) {
+				respondOAuthError(w, http.StatusBadRequest, "invalid_scope", "Scope exceeds the original grant: "+s)
+				return
+			}
+		}
+	}
+
+	user, err := a.DBQueries.GetUserByID(r.Context(), refreshToken.UserID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get user for refresh token", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := a.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to begin transaction", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	qtx := a.DBQueries.InTx(tx)
+
+	rotated, err := qtx.RotateOAuthRefreshToken(r.Context(), database.RotateOAuthRefreshTokenParams{
+		Token:    token,
+		ClientID: clientID,
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to rotate OAuth refresh token", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if rotated == 0 {
+		// Another request rotated it first.
+		respondOAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid, expired or revoked refresh token")
+		return
+	}
+
+	response, err := a.makeOAuthTokens(r.Context(), qtx, client, user, refreshToken.SessionID, refreshToken.Scopes, accessScopes)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to issue OAuth tokens", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to commit refresh token rotation", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	respondOAuthTokens(w, response)
+}
+
+// makeOAuthTokens stores a refresh token for the grant identified by
+// sessionID and signs an access token limited to accessScopes.
+func (a *APIHandlerStruct) makeOAuthTokens(ctx context.Context, q *database.Queries, client database.OauthClient, user database.User, sessionID uuid.UUID, grantScopes, accessScopes []string) (OAuthTokenResponse, error) {
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		return OAuthTokenResponse{}, err
+	}
+
+	refreshToken, err := q.CreateOAuthRefreshToken(ctx, database.CreateOAuthRefreshTokenParams{
+		Token:     token,
+		UserID:    user.ID,
+		SessionID: sessionID,
+		ClientID:  uuid.NullUUID{UUID: client.ID, Valid: true},
+		Scopes:    grantScopes,
+	})
+	if err != nil {
+		return OAuthTokenResponse{}, err
+	}
+
+	// OAuth tokens never carry the user's role: admin routes need a session.
+	accessToken, err := auth.MakeJWTWithClaims(user.ID, a.APIConfig.JWTSecret, oauthAccessTokenTTL, auth.Claims{
+		Scopes:    accessScopes,
+		SessionID: sessionID.String(),
+		Tier:      userTier(user),
+		ClientID:  client.ID.String(),
+	})
+	if err != nil {
+		return OAuthTokenResponse{}, err
+	}
+
+	return OAuthTokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(oauthAccessTokenTTL.Seconds()),
+		RefreshToken: refreshToken.Token,
+		Scope:        auth.FormatScope(accessScopes),
+	}, nil
+}
+
+func respondOAuthTokens(w http.ResponseWriter, response OAuthTokenResponse) {
+	w.Header().Set("Cache-Control", "no-store")
+	utils.RespondJSON(w, http.StatusOK, response)
+}
+
+// RevokeOAuthToken is the RFC 7009 revocation endpoint. Revoking either kind
+// of token ends the whole grant: its access tokens stop being accepted and
+// introspection reports them as inactive. Unknown tokens and tokens of other clients get the same
+// 200 response.
+func (a *APIHandlerStruct) RevokeOAuthToken(w http.ResponseWriter, r *http.Request) {
+	client, ok := a.parseOAuthClientRequest(w, r)
+	if !ok {
+		return
+	}
+
+	token := r.PostForm.Get("token")
+	if token == "" {
+		respondOAuthError(w, http.StatusBadRequest, "invalid_request", "token is required")
+		return
+	}
+
+	sessionID, found, err := a.oauthTokenSession(r.Context(), client, token)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to look up token to revoke", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if found {
+		err = a.DBQueries.RevokeSession(r.Context(), sessionID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to revoke OAuth grant", "error", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// oauthTokenSession finds the grant a refresh token or access token issued to
+// client belongs to.
+func (a *APIHandlerStruct) oauthTokenSession(ctx context.Context, client database.OauthClient, token string) (uuid.UUID, bool, error) {
+	refreshToken, err := a.DBQueries.GetOAuthRefreshToken(ctx, database.GetOAuthRefreshTokenParams{
+		Token:    token,
+		ClientID: uuid.NullUUID{UUID: client.ID, Valid: true},
+	})
+	if err == nil {
+		return refreshToken.SessionID, true, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return uuid.Nil, false, err
+	}
+
+	claims, err := auth.ParseJWT(token, a.APIConfig.JWTSecret)
+	if err != nil || claims.ClientID != client.ID.String() {
+		return uuid.Nil, false, nil
+	}
+
+	sessionID, err := uuid.Parse(claims.SessionID)
+	if err != nil {
+		return uuid.Nil, false, nil
+	}
+
+	return sessionID, true, nil
+}
+
+// IntrospectOAuthToken is the RFC 7662 introspection endpoint. Clients can
+// only introspect tokens that were issued to them.
+func (a *APIHandlerStruct) IntrospectOAuthToken(w http.ResponseWriter, r *http.Request) {
+	client, ok := a.parseOAuthClientRequest(w, r)
+	if !ok {
+		return
+	}
+
+	token := r.PostForm.Get("token")
+	if token == "" {
+		respondOAuthError(w, http.StatusBadRequest, "invalid_request", "token is required")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+
+	refreshToken, err := a.DBQueries.GetOAuthRefreshToken(r.Context(), database.GetOAuthRefreshTokenParams{
+		Token:    token,
+		ClientID: uuid.NullUUID{UUID: client.ID, Valid: true},
+	})
+	if err == nil {
+		if refreshToken.RevokedAt.Valid || time.Now().After(refreshToken.ExpiresAt) {
+			utils.RespondJSON(w, http.StatusOK, IntrospectionResponse{})
+			return
+		}
+
+		utils.RespondJSON(w, http.StatusOK, IntrospectionResponse{
+			Active:    true,
+			Scope:     auth.FormatScope(refreshToken.Scopes),
+			ClientID:  client.ID.String(),
+			Subject:   refreshToken.UserID.String(),
+			TokenType: "refresh_token",
+			ExpiresAt: refreshToken.ExpiresAt.Unix(),
+			IssuedAt:  refreshToken.CreatedAt.Unix(),
+		})
+		return
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		slog.ErrorContext(r.Context(), "failed to get OAuth refresh token", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	claims, err := auth.ParseJWT(token, a.APIConfig.JWTSecret)
+	if err != nil || claims.ClientID != client.ID.String() {
+		utils.RespondJSON(w, http.StatusOK, IntrospectionResponse{})
+		return
+	}
+
+	sessionID, err := uuid.Parse(claims.SessionID)
+	if err != nil {
+		utils.RespondJSON(w, http.StatusOK, IntrospectionResponse{})
+		return
+	}
+
+	active, err := a.DBQueries.IsSessionActive(r.Context(), sessionID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to check OAuth grant", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if !active {
+		utils.RespondJSON(w, http.StatusOK, IntrospectionResponse{})
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, IntrospectionResponse{
+		Active:    true,
+		Scope:     auth.FormatScope(claims.Scopes),
+		ClientID:  claims.ClientID,
+		Subject:   claims.Subject,
+		TokenType: "access_token",
+		ExpiresAt: claims.ExpiresAt.Unix(),
+		IssuedAt:  claims.IssuedAt.Unix(),
+	})
+}
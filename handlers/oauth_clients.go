@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"chirpy/internal/auth"
+	"chirpy/internal/database"
+	"chirpy/utils"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type CreateOAuthClientParams struct {
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirect_uris"`
+	Scopes       []string `json:"scopes"`
+	// Public clients, such as single page and native apps, cannot keep a
+	// secret and authenticate with PKCE alone.
+	Public bool `json:"public"`
+}
+
+type OAuthClientResponse struct {
+	ClientID     uuid.UUID `json:"client_id"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Scopes       []string  `json:"scopes"`
+	Public       bool      `json:"public"`
+	CreatedAt    time.Time `json:"created_at"`
+	// ClientSecret is only set in the response to CreateOAuthClient.
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+// OAuthClientInfo is what the consent page shows about a client. Anyone may
+// read it, so it leaves out the redirect URIs and the owner.
+type OAuthClientInfo struct {
+	ClientID uuid.UUID `json:"client_id"`
+	Name     string    `json:"name"`
+}
+
+func newOAuthClientResponse(client database.OauthClient) OAuthClientResponse {
+	return OAuthClientResponse{
+		ClientID:     client.ID,
+		Name:         client.Name,
+		RedirectURIs: client.RedirectUris,
+		Scopes:       client.Scopes,
+		Public:       !client.ClientSecretHash.Valid,
+		CreatedAt:    client.CreatedAt,
+	}
+}
+
+// CreateOAuthClient registers a third-party application owned by the caller.
+// The secret of a confidential client is returned once; only its hash is
+// stored.
+func (a *APIHandlerStruct) CreateOAuthClient(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var params CreateOAuthClientParams
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&params)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if params.Name == "" {
+		utils.RespondError(w, http.StatusBadRequest, "Name is required")
+		return
+	}
+
+	if len(params.RedirectURIs) == 0 {
+		utils.RespondError(w, http.StatusBadRequest, "At least one redirect URI is required")
+		return
+	}
+
+	for _, redirectURI := range params.RedirectURIs {
+		err = auth.ValidateRedirectURI(redirectURI)
+		if err != nil {
+			utils.RespondError(w, http.StatusBadRequest, "Invalid redirect URI "+redirectURI+": "+err.Error())
+			return
+		}
+	}
+
+	if len(params.Scopes) == 0 {
+		utils.RespondError(w, http.StatusBadRequest, "At least one scope is required")
+		return
+	}
+
+	for _, scope := range params.Scopes {
+		if !auth.IsValidScope(scope) {
+			utils.RespondError(w, http.StatusBadRequest, "Unknown scope: "+scope)
+			return
+		}
+	}
+
+	var secret string
+	var secretHash sql.NullString
+	if !params.Public {
+		secret, err = auth.MakeRefreshToken()
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to generate client secret", "error", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		secretHash = sql.NullString{String: auth.HashToken(secret), Valid: true}
+	}
+
+	client, err := a.DBQueries.CreateOAuthClient(r.Context(), database.CreateOAuthClientParams{
+		OwnerID:          principal.UserID,
+		Name:             params.Name,
+		ClientSecretHash: secretHash,
+		RedirectUris:     params.RedirectURIs,
+		Scopes:           params.Scopes,
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to create OAuth client", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response := newOAuthClientResponse(client)
+	response.ClientSecret = secret
+	utils.RespondJSON(w, http.StatusCreated, response)
+}
+
+func (a *APIHandlerStruct) ListOAuthClients(w http.ResponseWriter, r *http.Request) {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	clients, err := a.DBQueries.ListOAuthClientsByOwner(r.Context(), principal.UserID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to list OAuth clients", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]OAuthClientResponse, 0, len(clients))
+	for _, client := range clients {
+		response = append(response, newOAuthClientResponse(client))
+	}
+
+	utils.RespondJSON(w, http.StatusOK, response)
+}
+
+func (a *APIHandlerStruct) GetOAuthClientInfo(w http.ResponseWriter, r *http.Request) {
+	clientID, err := uuid.Parse(r.PathValue("clientID"))
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid client ID")
+		return
+	}
+
+	client, err := a.DBQueries.GetOAuthClient(r.Context(), clientID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		slog.ErrorContext(r.Context(), "failed to get OAuth client", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, OAuthClientInfo{
+		ClientID: client.ID,
+		Name:     client.Name,
+	})
+}
+
+// DeleteOAuthClient removes a client along with its authorization codes and
+// refresh tokens.
+func (a *APIHandlerStruct) DeleteOAuthClient(w http.ResponseWriter, r *http.Request) {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	clientID, err := uuid.Parse(r.PathValue("clientID"))
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid client ID")
+		return
+	}
+
+	deleted, err := a.DBQueries.DeleteOAuthClient(r.Context(), database.DeleteOAuthClientParams{
+		ID:      clientID,
+		OwnerID: principal.UserID,
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to delete OAuth client", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if deleted == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
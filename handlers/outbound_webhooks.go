@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"chirpy/internal/auth"
+	"chirpy/internal/database"
+	"chirpy/internal/webhooks"
+	"chirpy/utils"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const webhookDeliveryLogLimit = 100
+
+type CreateWebhookSubscriptionParams struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+}
+
+type WebhookSubscriptionResponse struct {
+	ID         uuid.UUID  `json:"id"`
+	URL        string     `json:"url"`
+	Events     []string   `json:"events"`
+	DisabledAt *time.Time `json:"disabled_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	// Secret is only set in the response to CreateWebhookSubscription.
+	Secret string `json:"secret,omitempty"`
+}
+
+type WebhookDeliveryResponse struct {
+	ID             uuid.UUID  `json:"id"`
+	EventID        uuid.UUID  `json:"event_id"`
+	EventType      string     `json:"event_type"`
+	Status         string     `json:"status"`
+	Attempts       int32      `json:"attempts"`
+	ResponseStatus *int32     `json:"response_status"`
+	Error          *string    `json:"error"`
+	CreatedAt      time.Time  `json:"created_at"`
+	LastAttemptAt  *time.Time `json:"last_attempt_at"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at"`
+	DeliveredAt    *time.Time `json:"delivered_at"`
+}
+
+func newWebhookSubscriptionResponse(subscription database.WebhookSubscription) WebhookSubscriptionResponse {
+	response := WebhookSubscriptionResponse{
+		ID:        subscription.ID,
+		URL:       subscription.Url,
+		Events:    subscription.EventTypes,
+		CreatedAt: subscription.CreatedAt,
+	}
+	if subscription.DisabledAt.Valid {
+		response.DisabledAt = &subscription.DisabledAt.Time
+	}
+	return response
+}
+
+func newWebhookDeliveryResponse(delivery database.WebhookDelivery) WebhookDeliveryResponse {
+	response := WebhookDeliveryResponse{
+		ID:        delivery.ID,
+		EventID:   delivery.EventID,
+		EventType: delivery.EventType,
+		Status:    delivery.Status,
+		Attempts:  delivery.Attempts,
+		CreatedAt: delivery.CreatedAt,
+	}
+	if delivery.ResponseStatus.Valid {
+		response.ResponseStatus = &delivery.ResponseStatus.Int32
+	}
+	if delivery.Error.Valid {
+		response.Error = &delivery.Error.String
+	}
+	if delivery.LastAttemptAt.Valid {
+		response.LastAttemptAt = &delivery.LastAttemptAt.Time
+	}
+	if delivery.Status == "pending" {
+		response.NextAttemptAt = &delivery.NextAttemptAt
+	}
+	if delivery.DeliveredAt.Valid {
+		response.DeliveredAt = &delivery.DeliveredAt.Time
+	}
+	return response
+}
+
+// ownedOAuthClientID returns the client in the path if the signed-in user owns
+// it, and writes the error response otherwise.
+func (a *APIHandlerStruct) ownedOAuthClientID(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return uuid.Nil, false
+	}
+
+	clientID, err := uuid.Parse(r.PathValue("clientID"))
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid client ID")
+		return uuid.Nil, false
+	}
+
+	client, err := a.DBQueries.GetOAuthClient(r.Context(), clientID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && client.OwnerID != principal.UserID) {
+		utils.RespondError(w, http.StatusNotFound, "Client not found")
+		return uuid.Nil, false
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get OAuth client", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return uuid.Nil, false
+	}
+
+	return client.ID, true
+}
+
+// CreateWebhookSubscription subscribes one of the caller's clients to events.
+// The signing secret is returned once.
+func (a *APIHandlerStruct) CreateWebhookSubscription(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	clientID, ok := a.ownedOAuthClientID(w, r)
+	if !ok {
+		return
+	}
+
+	var params CreateWebhookSubscriptionParams
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&params)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	err = webhooks.ValidateURL(params.URL, a.APIConfig.WebhookAllowPrivateNetworks)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid URL: "+err.Error())
+		return
+	}
+
+	if len(params.Events) == 0 {
+		utils.RespondError(w, http.StatusBadRequest, "At least one event is required: "+strings.Join(webhooks.EventTypes, ", "))
+		return
+	}
+
+	for _, event := range params.Events {
+		if !webhooks.IsEventType(event) {
+			utils.RespondError(w, http.StatusBadRequest, "Unknown event: "+event)
+			return
+		}
+	}
+
+	secret, err := webhooks.NewSecret()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to generate webhook secret", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	subscription, err := a.DBQueries.CreateWebhookSubscription(r.Context(), database.CreateWebhookSubscriptionParams{
+		ClientID:   clientID,
+		Url:        params.URL,
+		EventTypes: params.Events,
+		Secret:     secret,
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to create webhook subscription", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response := newWebhookSubscriptionResponse(subscription)
+	response.Secret = secret
+	utils.RespondJSON(w, http.StatusCreated, response)
+}
+
+func (a *APIHandlerStruct) ListWebhookSubscriptions(w http.ResponseWriter, r *http.Request) {
+	clientID, ok := a.ownedOAuthClientID(w, r)
+	if !ok {
+		return
+	}
+
+	subscriptions, err := a.DBQueries.ListWebhookSubscriptions(r.Context(), clientID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to list webhook subscriptions", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]WebhookSubscriptionResponse, 0, len(subscriptions))
+	for _, subscription := range subscriptions {
+		response = append(response, newWebhookSubscriptionResponse(subscription))
+	}
+
+	utils.RespondJSON(w, http.StatusOK, response)
+}
+
+// EnableWebhookSubscription turns a subscription that was disabled after
+// repeated failures back on. Deliveries that were still pending resume.
+func (a *APIHandlerStruct) EnableWebhookSubscription(w http.ResponseWriter, r *http.Request) {
+	clientID, ok := a.ownedOAuthClientID(w, r)
+	if !ok {
+		return
+	}
+
+	webhookID, err := uuid.Parse(r.PathValue("webhookID"))
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid webhook ID")
+		return
+	}
+
+	subscription, err := a.DBQueries.EnableWebhookSubscription(r.Context(), database.EnableWebhookSubscriptionParams{
+		ID:       webhookID,
+		ClientID: clientID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.RespondError(w, http.StatusNotFound, "Webhook not found")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to enable webhook subscription", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, newWebhookSubscriptionResponse(subscription))
+}
+
+func (a *APIHandlerStruct) DeleteWebhookSubscription(w http.ResponseWriter, r *http.Request) {
+	clientID, ok := a.ownedOAuthClientID(w, r)
+	if !ok {
+		return
+	}
+
+	webhookID, err := uuid.Parse(r.PathValue("webhookID"))
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid webhook ID")
+		return
+	}
+
+	deleted, err := a.DBQueries.DeleteWebhookSubscription(r.Context(), database.DeleteWebhookSubscriptionParams{
+		ID:       webhookID,
+		ClientID: clientID,
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to delete webhook subscription", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if deleted == 0 {
+		utils.RespondError(w, http.StatusNotFound, "Webhook not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListWebhookDeliveries is the delivery log of a subscription, newest first.
+func (a *APIHandlerStruct) ListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	clientID, ok := a.ownedOAuthClientID(w, r)
+	if !ok {
+		return
+	}
+
+	webhookID, err := uuid.Parse(r.PathValue("webhookID"))
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid webhook ID")
+		return
+	}
+
+	_, err = a.DBQueries.GetWebhookSubscription(r.Context(), database.GetWebhookSubscriptionParams{
+		ID:       webhookID,
+		ClientID: clientID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.RespondError(w, http.StatusNotFound, "Webhook not found")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get webhook subscription", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	deliveries, err := a.DBQueries.ListWebhookDeliveries(r.Context(), database.ListWebhookDeliveriesParams{
+		SubscriptionID: webhookID,
+		Limit:          webhookDeliveryLogLimit,
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to list webhook deliveries", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]WebhookDeliveryResponse, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		response = append(response, newWebhookDeliveryResponse(delivery))
+	}
+
+	utils.RespondJSON(w, http.StatusOK, response)
+}
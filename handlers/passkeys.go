@@ -0,0 +1,389 @@
+package handlers
+
+import (
+	"chirpy/internal/auth"
+	"chirpy/internal/database"
+	"chirpy/internal/passkey"
+	"chirpy/utils"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const (
+	webauthnSessionTTL = 5 * time.Minute
+
+	ceremonyRegistration = "registration"
+	ceremonyLogin        = "login"
+)
+
+// PasskeyCeremonyResponse starts a registration or login. Options go to
+// navigator.credentials.create or .get, and SessionID comes back with the
+// result.
+type PasskeyCeremonyResponse struct {
+	SessionID uuid.UUID `json:"session_id"`
+	Options   any       `json:"options"`
+}
+
+type FinishPasskeyRegistrationParams struct {
+	SessionID  uuid.UUID       `json:"session_id"`
+	Name       string          `json:"name"`
+	Credential json.RawMessage `json:"credential"`
+}
+
+type FinishPasskeyLoginParams struct {
+	SessionID  uuid.UUID       `json:"session_id"`
+	Credential json.RawMessage `json:"credential"`
+}
+
+type PasskeyResponse struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Transports []string   `json:"transports"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+func newPasskeyResponse(credential database.WebauthnCredential) PasskeyResponse {
+	response := PasskeyResponse{
+		ID:         credential.ID,
+		Name:       credential.Name,
+		Transports: credential.Transports,
+		CreatedAt:  credential.CreatedAt,
+	}
+	if credential.LastUsedAt.Valid {
+		response.LastUsedAt = &credential.LastUsedAt.Time
+	}
+	return response
+}
+
+// BeginPasskeyRegistration starts adding a passkey to the signed-in user.
+func (a *APIHandlerStruct) BeginPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	user, err := a.loadPasskeyUser(r.Context(), principal.UserID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to load passkey user", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	options, session, err := a.Passkeys.BeginRegistration(user)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to begin passkey registration", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	a.respondPasskeyCeremony(w, r, ceremonyRegistration, uuid.NullUUID{UUID: user.ID, Valid: true}, session, options)
+}
+
+// FinishPasskeyRegistration verifies the new credential and stores it.
+func (a *APIHandlerStruct) FinishPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var params FinishPasskeyRegistrationParams
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&params)
+	if err != nil || len(params.Credential) == 0 {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if params.Name == "" {
+		params.Name = "Passkey"
+	}
+
+	session, ok := a.consumePasskeySession(w, r, params.SessionID, ceremonyRegistration)
+	if !ok {
+		return
+	}
+
+	if session.userID != principal.UserID {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid or expired passkey session")
+		return
+	}
+
+	user, err := a.loadPasskeyUser(r.Context(), principal.UserID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to load passkey user", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	credential, err := a.Passkeys.FinishRegistration(user, session.data, params.Credential)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to verify passkey registration", "error", err)
+		utils.RespondError(w, http.StatusBadRequest, "Passkey verification failed")
+		return
+	}
+
+	transports := make([]string, 0, len(credential.Transport))
+	for _, transport := range credential.Transport {
+		transports = append(transports, string(transport))
+	}
+
+	stored, err := a.DBQueries.CreateWebAuthnCredential(r.Context(), database.CreateWebAuthnCredentialParams{
+		UserID:          principal.UserID,
+		Name:            params.Name,
+		CredentialID:    credential.ID,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		Aaguid:          credential.Authenticator.AAGUID,
+		SignCount:       int64(credential.Authenticator.SignCount),
+		Transports:      transports,
+		BackupEligible:  credential.Flags.BackupEligible,
+		BackupState:     credential.Flags.BackupState,
+	})
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			utils.RespondError(w, http.StatusConflict, "This passkey is already registered")
+			return
+		}
+		slog.ErrorContext(r.Context(), "failed to store passkey", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusCreated, newPasskeyResponse(stored))
+}
+
+func (a *APIHandlerStruct) ListPasskeys(w http.ResponseWriter, r *http.Request) {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	credentials, err := a.DBQueries.ListWebAuthnCredentials(r.Context(), principal.UserID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to list passkeys", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]PasskeyResponse, 0, len(credentials))
+	for _, credential := range credentials {
+		response = append(response, newPasskeyResponse(credential))
+	}
+
+	utils.RespondJSON(w, http.StatusOK, response)
+}
+
+func (a *APIHandlerStruct) DeletePasskey(w http.ResponseWriter, r *http.Request) {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	passkeyID, err := uuid.Parse(r.PathValue("passkeyID"))
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid passkey ID")
+		return
+	}
+
+	deleted, err := a.DBQueries.DeleteWebAuthnCredential(r.Context(), database.DeleteWebAuthnCredentialParams{
+		ID:     passkeyID,
+		UserID: principal.UserID,
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to delete passkey", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if deleted == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// BeginPasskeyLogin starts a login without asking who the user is; the
+// authenticator picks one of its passkeys for this site.
+func (a *APIHandlerStruct) BeginPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	options, session, err := a.Passkeys.BeginLogin()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to begin passkey login", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	a.respondPasskeyCeremony(w, r, ceremonyLogin, uuid.NullUUID{}, session, options)
+}
+
+// FinishPasskeyLogin verifies the assertion and issues the same session as
+// Login. Passkeys require user verification, so they count as both factors
+// and skip the TOTP challenge.
+func (a *APIHandlerStruct) FinishPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var params FinishPasskeyLoginParams
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&params)
+	if err != nil || len(params.Credential) == 0 {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	session, ok := a.consumePasskeySession(w, r, params.SessionID, ceremonyLogin)
+	if !ok {
+		return
+	}
+
+	passkeyUser, credential, err := a.Passkeys.FinishLogin(session.data, params.Credential, func(userID uuid.UUID) (*passkey.User, error) {
+		return a.loadPasskeyUser(r.Context(), userID)
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to verify passkey login", "error", err)
+		utils.RespondError(w, http.StatusUnauthorized, "Passkey verification failed")
+		return
+	}
+
+	err = a.DBQueries.UpdateWebAuthnCredentialUse(r.Context(), database.UpdateWebAuthnCredentialUseParams{
+		CredentialID: credential.ID,
+		SignCount:    int64(credential.Authenticator.SignCount),
+		BackupState:  credential.Flags.BackupState,
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to update passkey sign count", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	user, err := a.DBQueries.GetUserByID(r.Context(), passkeyUser.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get user", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	a.recordLoginAttempt(r, user.Email, utils.ClientIP(r, a.APIConfig.TrustProxyHeaders), true)
+	a.issueSession(w, r, user)
+}
+
+// loadPasskeyUser reads a user and their registered credentials.
+func (a *APIHandlerStruct) loadPasskeyUser(ctx context.Context, userID uuid.UUID) (*passkey.User, error) {
+	user, err := a.DBQueries.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	stored, err := a.DBQueries.ListWebAuthnCredentials(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	credentials := make([]webauthn.Credential, 0, len(stored))
+	for _, credential := range stored {
+		transports := make([]protocol.AuthenticatorTransport, 0, len(credential.Transports))
+		for _, transport := range credential.Transports {
+			transports = append(transports, protocol.AuthenticatorTransport(transport))
+		}
+
+		credentials = append(credentials, webauthn.Credential{
+			ID:              credential.CredentialID,
+			PublicKey:       credential.PublicKey,
+			AttestationType: credential.AttestationType,
+			Transport:       transports,
+			Flags: webauthn.CredentialFlags{
+				UserPresent:    true,
+				UserVerified:   true,
+				BackupEligible: credential.BackupEligible,
+				BackupState:    credential.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{
+				AAGUID:    credential.Aaguid,
+				SignCount: uint32(credential.SignCount),
+			},
+		})
+	}
+
+	return &passkey.User{
+		ID:          user.ID,
+		Email:       user.Email,
+		Credentials: credentials,
+	}, nil
+}
+
+func (a *APIHandlerStruct) respondPasskeyCeremony(w http.ResponseWriter, r *http.Request, ceremony string, userID uuid.NullUUID, session *webauthn.SessionData, options any) {
+	data, err := json.Marshal(session)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to encode passkey session", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	sessionID, err := a.DBQueries.CreateWebAuthnSession(r.Context(), database.CreateWebAuthnSessionParams{
+		UserID:    userID,
+		Ceremony:  ceremony,
+		Data:      data,
+		ExpiresAt: time.Now().Add(webauthnSessionTTL),
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to store passkey session", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, PasskeyCeremonyResponse{
+		SessionID: sessionID,
+		Options:   options,
+	})
+}
+
+type passkeySession struct {
+	userID uuid.UUID
+	data   webauthn.SessionData
+}
+
+// consumePasskeySession loads and deletes a ceremony's session so each
+// challenge can only be answered once. It writes a 400 and returns false when
+// the session is unknown or expired.
+func (a *APIHandlerStruct) consumePasskeySession(w http.ResponseWriter, r *http.Request, sessionID uuid.UUID, ceremony string) (passkeySession, bool) {
+	stored, err := a.DBQueries.ConsumeWebAuthnSession(r.Context(), database.ConsumeWebAuthnSessionParams{
+		ID:       sessionID,
+		Ceremony: ceremony,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.RespondError(w, http.StatusBadRequest, "Invalid or expired passkey session")
+			return passkeySession{}, false
+		}
+		slog.ErrorContext(r.Context(), "failed to get passkey session", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return passkeySession{}, false
+	}
+
+	var data webauthn.SessionData
+	err = json.Unmarshal(stored.Data, &data)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to decode passkey session", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return passkeySession{}, false
+	}
+
+	return passkeySession{userID: stored.UserID.UUID, data: data}, true
+}
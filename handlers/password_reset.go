@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"chirpy/internal/auth"
+	"chirpy/internal/database"
+	"chirpy/internal/mailer"
+	"chirpy/utils"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const passwordResetTTL = 30 * time.Minute
+
+type PasswordResetRequestParams struct {
+	Email string `json:"email"`
+}
+
+type PasswordResetConfirmParams struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// RequestPasswordReset emails a reset link if the address belongs to an
+// account. The response is the same either way, and the lookup runs after the
+// response is written so its timing does not reveal the answer either.
+func (a *APIHandlerStruct) RequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var params PasswordResetRequestParams
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&params)
+	if err != nil || params.Email == "" {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	go a.sendPasswordReset(context.WithoutCancel(r.Context()), params.Email)
+
+	var payload struct {
+		Message string `json:"message"`
+	}
+	payload.Message = "If an account exists for that email, a password reset link has been sent."
+	utils.RespondJSON(w, http.StatusAccepted, payload)
+}
+
+func (a *APIHandlerStruct) sendPasswordReset(ctx context.Context, email string) {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	user, err := a.DBQueries.GetUser(ctx, email)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			slog.ErrorContext(ctx, "failed to get user for password reset", "error", err)
+		}
+		return
+	}
+
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to create password reset token", "error", err)
+		return
+	}
+
+	err = a.DBQueries.CreatePasswordResetToken(ctx, database.CreatePasswordResetTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(passwordResetTTL),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to store password reset token", "error", err)
+		return
+	}
+
+	link := a.APIConfig.BaseURL + "/app/reset-password.html?token=" + url.QueryEscape(token)
+	err = a.Mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your Chirpy password",
+		Body: fmt.Sprintf("Someone asked to reset the password for your Chirpy account.\n\n"+
+			"Follow this link within %d minutes to choose a new one:\n\n%s\n\n"+
+			"If it wasn't you, you can ignore this email.", int(passwordResetTTL.Minutes()), link),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to send password reset email", "error", err)
+	}
+}
+
+// ConfirmPasswordReset sets a new password with a token from
+// RequestPasswordReset. It signs the user out everywhere by revoking all of
+// their refresh tokens.
+func (a *APIHandlerStruct) ConfirmPasswordReset(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var params PasswordResetConfirmParams
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&params)
+	if err != nil || params.Token == "" {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if !a.validateNewPassword(w, r, a.DBQueries, params.Password, nil) {
+		return
+	}
+
+	hashedPassword, err := a.hashPassword(params.Password)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to hash user password", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := a.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to begin transaction", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	qtx := a.DBQueries.InTx(tx)
+
+	userID, err := qtx.ConsumePasswordResetToken(r.Context(), auth.HashToken(params.Token))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.RespondError(w, http.StatusBadRequest, "Invalid or expired token")
+			return
+		}
+
+		slog.ErrorContext(r.Context(), "failed to consume password reset token", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	user, err := qtx.GetUserByID(r.Context(), userID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get user", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Rejecting a reused password rolls back the transaction, so the token
+	// stays valid for another try.
+	if !a.validateNewPassword(w, r, qtx, params.Password, &user) {
+		return
+	}
+
+	err = a.retirePassword(r.Context(), qtx, user)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to update password history", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = qtx.UpdateUserPassword(r.Context(), database.UpdateUserPasswordParams{
+		ID:             userID,
+		HashedPassword: hashedPassword,
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to update password", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = qtx.InvalidatePasswordResetTokens(r.Context(), userID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to invalidate password reset tokens", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = qtx.RevokeAllUserRefreshTokens(r.Context(), userID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to revoke refresh tokens", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to commit password reset", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
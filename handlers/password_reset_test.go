@@ -0,0 +1,99 @@
+package handlers_test
+
+import (
+	"chirpy/handlers"
+	"chirpy/internal/auth"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+)
+
+// consumeResetToken matches ConsumePasswordResetToken only while it marks the
+// token used and skips tokens that are used or expired, which is what makes
+// tokens single-use and short-lived.
+const consumeResetToken = `(?s)ConsumePasswordResetToken.*SET used_at = NOW\(\).*used_at IS NULL AND expires_at > NOW\(\)`
+
+func newPasswordResetTestHandlers(t *testing.T) (*handlers.APIHandlerStruct, sqlmock.Sqlmock) {
+	t.Helper()
+
+	h, mock := newTestHandlers(t)
+	h.APIConfig.PasswordParams = fastPasswordParams
+	return h, mock
+}
+
+func confirmPasswordReset(h *handlers.APIHandlerStruct, token string) *httptest.ResponseRecorder {
+	body := `{"token":"` + token + `","password":"a new password"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/password-reset/confirm", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	h.ConfirmPasswordReset(rec, req)
+	return rec
+}
+
+// expectPasswordReset expects a reset of userID's password with token to
+// succeed.
+func expectPasswordReset(mock sqlmock.Sqlmock, token string, userID uuid.UUID) {
+	now := time.Now()
+	mock.ExpectBegin()
+	mock.ExpectQuery(consumeResetToken).WithArgs(auth.HashToken(token)).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(userID.String()))
+	mock.ExpectQuery("GetUserByID").WithArgs(userID.String()).WillReturnRows(
+		sqlmock.NewRows(userColumns).AddRow(userID.String(), "user@example.com", now, now, "unset", false, "user", nil, nil),
+	)
+	mock.ExpectExec("UpdateUserPassword").WithArgs(userID.String(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("InvalidatePasswordResetTokens").WithArgs(userID.String()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("RevokeAllUserRefreshTokens").WithArgs(userID.String()).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+}
+
+func TestConfirmPasswordResetRevokesRefreshTokens(t *testing.T) {
+	h, mock := newPasswordResetTestHandlers(t)
+
+	// expectPasswordReset fails the test unless the user's refresh tokens
+	// are revoked in the same transaction as the new password.
+	expectPasswordReset(mock, "reset-token", uuid.New())
+
+	rec := confirmPasswordReset(h, "reset-token")
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected the reset to succeed with 204, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestConfirmPasswordResetTokensAreSingleUse(t *testing.T) {
+	h, mock := newPasswordResetTestHandlers(t)
+
+	expectPasswordReset(mock, "reset-token", uuid.New())
+	rec := confirmPasswordReset(h, "reset-token")
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected the first reset to succeed with 204, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// The first reset marked the token used, so it no longer matches, and
+	// nothing else may change.
+	mock.ExpectBegin()
+	mock.ExpectQuery(consumeResetToken).WithArgs(auth.HashToken("reset-token")).WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	rec = confirmPasswordReset(h, "reset-token")
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("Expected a used token to be rejected with 400, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestConfirmPasswordResetRejectsExpiredTokens(t *testing.T) {
+	h, mock := newPasswordResetTestHandlers(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(consumeResetToken).WithArgs(auth.HashToken("expired-token")).WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	rec := confirmPasswordReset(h, "expired-token")
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "Invalid or expired token") {
+		t.Fatalf("Expected an expired token to be rejected with 400, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
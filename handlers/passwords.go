@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"chirpy/internal/auth"
+	"chirpy/internal/database"
+	"chirpy/utils"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+)
+
+func (a *APIHandlerStruct) hashPassword(password string) (string, error) {
+	return auth.HashPasswordWithParams(password, a.APIConfig.PasswordParams)
+}
+
+// validateNewPassword writes a 400 and returns false when password breaks the
+// password policy. For existing users, pass the user read through q so their
+// current and recent passwords are checked for reuse; new accounts pass nil.
+func (a *APIHandlerStruct) validateNewPassword(w http.ResponseWriter, r *http.Request, q *database.Queries, password string, user *database.User) bool {
+	policy := a.APIConfig.PasswordPolicy
+
+	err := policy.Validate(password)
+	if err == nil && user != nil {
+		var recentHashes []string
+		recentHashes, err = a.recentPasswordHashes(r.Context(), q, *user)
+		if err == nil {
+			err = policy.CheckReuse(password, recentHashes)
+		}
+	}
+
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, auth.ErrPasswordTooShort):
+		utils.RespondError(w, http.StatusBadRequest, fmt.Sprintf("Password must be at least %d characters", max(policy.MinLength, 1)))
+	case errors.Is(err, auth.ErrPasswordBanned):
+		utils.RespondError(w, http.StatusBadRequest, "Password is too common, choose another one")
+	case errors.Is(err, auth.ErrPasswordReused):
+		utils.RespondError(w, http.StatusBadRequest, fmt.Sprintf("Password must differ from your last %d passwords", policy.HistorySize))
+	default:
+		slog.ErrorContext(r.Context(), "failed to check password policy", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	return false
+}
+
+// recentPasswordHashes returns the user's current hash followed by the
+// retired ones, newest first.
+func (a *APIHandlerStruct) recentPasswordHashes(ctx context.Context, q *database.Queries, user database.User) ([]string, error) {
+	historySize := a.APIConfig.PasswordPolicy.HistorySize
+	if historySize <= 1 {
+		return []string{user.HashedPassword}, nil
+	}
+
+	history, err := q.ListPasswordHistory(ctx, database.ListPasswordHistoryParams{
+		UserID: user.ID,
+		Limit:  int32(historySize - 1),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]string{user.HashedPassword}, history...), nil
+}
+
+// retirePassword moves the user's current hash into the password history
+// before it is replaced. Call it through the same transaction as the update.
+func (a *APIHandlerStruct) retirePassword(ctx context.Context, q *database.Queries, user database.User) error {
+	keep := a.APIConfig.PasswordPolicy.HistorySize - 1
+	if keep <= 0 || !auth.HasUsablePassword(user.HashedPassword) {
+		return nil
+	}
+
+	err := q.AddPasswordHistory(ctx, database.AddPasswordHistoryParams{
+		UserID:         user.ID,
+		HashedPassword: user.HashedPassword,
+	})
+	if err != nil {
+		return err
+	}
+
+	return q.PrunePasswordHistory(ctx, database.PrunePasswordHistoryParams{
+		UserID: user.ID,
+		Keep:   int32(keep),
+	})
+}
+
+// upgradePasswordHash re-hashes password with the configured parameters when
+// the stored hash uses outdated ones. It is best effort: the login that
+// triggered it succeeds either way.
+func (a *APIHandlerStruct) upgradePasswordHash(ctx context.Context, user database.User, password string) {
+	outdated, err := auth.NeedsRehash(user.HashedPassword, a.APIConfig.PasswordParams)
+	if err != nil || !outdated {
+		return
+	}
+
+	hashedPassword, err := a.hashPassword(password)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to re-hash password", "error", err)
+		return
+	}
+
+	err = a.DBQueries.UpdateUserPassword(ctx, database.UpdateUserPasswordParams{
+		ID:             user.ID,
+		HashedPassword: hashedPassword,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to store re-hashed password", "error", err)
+	}
+}
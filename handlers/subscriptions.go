@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"chirpy/internal/billing"
+	"chirpy/internal/database"
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func newSubscription(row database.Subscription) billing.Subscription {
+	sub := billing.Subscription{
+		Plan:              row.Plan,
+		Status:            billing.Status(row.Status),
+		CancelAtPeriodEnd: row.CancelAtPeriodEnd,
+		LastEventAt:       row.LastEventAt,
+	}
+	if row.CurrentPeriodStart.Valid {
+		sub.PeriodStart = &row.CurrentPeriodStart.Time
+	}
+	if row.CurrentPeriodEnd.Valid {
+		sub.PeriodEnd = &row.CurrentPeriodEnd.Time
+	}
+	return sub
+}
+
+func nullTime(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: *t, Valid: true}
+}
+
+// applySubscriptionEvent moves the user's subscription along and makes
+// is_chirpy_red follow it. It runs inside the caller's transaction.
+func applySubscriptionEvent(ctx context.Context, qtx *database.Queries, provider string, userID uuid.UUID, event billing.Event) error {
+	_, err := qtx.GetUserByID(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errWebhookUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	var current *billing.Subscription
+	row, err := qtx.GetSubscriptionForUpdate(ctx, userID)
+	if err == nil {
+		sub := newSubscription(row)
+		current = &sub
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	now := time.Now()
+	sub, ok := billing.Apply(current, event, now)
+	if !ok {
+		slog.InfoContext(ctx, "ignored subscription event, the subscription has newer state", "event", event.Type, "user_id", userID, "occurred_at", event.OccurredAt)
+		return nil
+	}
+
+	_, err = qtx.UpsertSubscription(ctx, database.UpsertSubscriptionParams{
+		UserID:             userID,
+		Provider:           provider,
+		Plan:               sub.Plan,
+		Status:             string(sub.Status),
+		CurrentPeriodStart: nullTime(sub.PeriodStart),
+		CurrentPeriodEnd:   nullTime(sub.PeriodEnd),
+		CancelAtPeriodEnd:  sub.CancelAtPeriodEnd,
+		LastEventAt:        sub.LastEventAt,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		// A newer event for a user without a subscription row won the race
+		// to create it.
+		slog.InfoContext(ctx, "ignored subscription event, the subscription has newer state", "event", event.Type, "user_id", userID, "occurred_at", event.OccurredAt)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if sub.Entitled(now) {
+		_, err = qtx.EnableUserChirpyRed(ctx, userID)
+	} else {
+		_, err = qtx.DisableUserChirpyRed(ctx, userID)
+	}
+	return err
+}
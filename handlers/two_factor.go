@@ -0,0 +1,373 @@
+package handlers
+
+import (
+	"chirpy/internal/auth"
+	"chirpy/internal/database"
+	"chirpy/utils"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/skip2/go-qrcode"
+)
+
+const (
+	totpIssuer            = "Chirpy"
+	twoFactorChallengeTTL = 5 * time.Minute
+	recoveryCodeCount     = 10
+)
+
+type TwoFactorChallengeResponse struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	ChallengeToken    string `json:"challenge_token"`
+}
+
+type TwoFactorEnrollmentResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+	QRCodePNG       string `json:"qr_code_png"`
+}
+
+type TwoFactorCodeParams struct {
+	Code string `json:"code"`
+}
+
+type TwoFactorLoginParams struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`
+	RecoveryCode   string `json:"recovery_code"`
+}
+
+// EnrollTwoFactor starts (or restarts) TOTP enrollment. The secret is not
+// enforced at login until it has been confirmed with ConfirmTwoFactor.
+func (a *APIHandlerStruct) EnrollTwoFactor(w http.ResponseWriter, r *http.Request) {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	user, err := a.DBQueries.GetUserByID(r.Context(), principal.UserID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get user", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to generate TOTP secret", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	_, err = a.DBQueries.UpsertPendingTOTP(r.Context(), database.UpsertPendingTOTPParams{
+		UserID: user.ID,
+		Secret: secret,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.RespondError(w, http.StatusConflict, "Two-factor authentication is already enabled")
+			return
+		}
+
+		slog.ErrorContext(r.Context(), "failed to store TOTP secret", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	uri := auth.TOTPProvisioningURI(secret, totpIssuer, user.Email)
+	png, err := qrcode.Encode(uri, qrcode.Medium, 256)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to render QR code", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, &TwoFactorEnrollmentResponse{
+		Secret:          secret,
+		ProvisioningURI: uri,
+		QRCodePNG:       base64.StdEncoding.EncodeToString(png),
+	})
+}
+
+// ConfirmTwoFactor enables TOTP once the user proves their authenticator
+// produces valid codes, and returns the recovery codes. They are only ever
+// shown here; the database keeps argon2id hashes.
+func (a *APIHandlerStruct) ConfirmTwoFactor(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var params TwoFactorCodeParams
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&params)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	totp, err := a.DBQueries.GetTOTP(r.Context(), principal.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.RespondError(w, http.StatusNotFound, "Two-factor enrollment not started")
+			return
+		}
+
+		slog.ErrorContext(r.Context(), "failed to get TOTP settings", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if totp.ConfirmedAt.Valid {
+		utils.RespondError(w, http.StatusConflict, "Two-factor authentication is already enabled")
+		return
+	}
+
+	step, valid, err := auth.MatchTOTP(totp.Secret, params.Code, time.Now())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to check TOTP code", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if !valid {
+		utils.RespondError(w, http.StatusUnauthorized, "Invalid code")
+		return
+	}
+
+	recoveryCodes, err := a.replaceRecoveryCodes(r, principal.UserID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to create recovery codes", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	_, err = a.DBQueries.ConfirmTOTP(r.Context(), database.ConfirmTOTPParams{
+		UserID:       principal.UserID,
+		LastUsedStep: step,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.RespondError(w, http.StatusConflict, "Two-factor authentication is already enabled")
+			return
+		}
+
+		slog.ErrorContext(r.Context(), "failed to confirm TOTP", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var payload struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	payload.RecoveryCodes = recoveryCodes
+	utils.RespondJSON(w, http.StatusOK, payload)
+}
+
+// DisableTwoFactor turns TOTP off. It requires a current code so a stolen
+// access token alone cannot strip the second factor.
+func (a *APIHandlerStruct) DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var params TwoFactorCodeParams
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&params)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	valid, err := a.verifyTOTP(r, principal.UserID, params.Code)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		slog.ErrorContext(r.Context(), "failed to verify TOTP code", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if !valid {
+		utils.RespondError(w, http.StatusUnauthorized, "Invalid code")
+		return
+	}
+
+	err = a.DBQueries.DeleteTOTP(r.Context(), principal.UserID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to delete TOTP", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = a.DBQueries.DeleteRecoveryCodes(r.Context(), principal.UserID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to delete recovery codes", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CompleteTwoFactorLogin exchanges a challenge token from Login plus a TOTP or
+// recovery code for a session.
+func (a *APIHandlerStruct) CompleteTwoFactorLogin(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var params TwoFactorLoginParams
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&params)
+	if err != nil {
+		utils.RespondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	userID, err := auth.ParseChallengeToken(params.ChallengeToken, a.APIConfig.JWTSecret)
+	if err != nil {
+		utils.RespondError(w, http.StatusUnauthorized, "Invalid or expired challenge")
+		return
+	}
+
+	user, err := a.DBQueries.GetUserByID(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.RespondError(w, http.StatusUnauthorized, "Invalid or expired challenge")
+			return
+		}
+
+		slog.ErrorContext(r.Context(), "failed to get user", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Second factor failures count towards the same throttle as passwords,
+	// otherwise a challenge token would allow guessing codes at full speed.
+	clientIP := utils.ClientIP(r, a.APIConfig.TrustProxyHeaders)
+	if !a.checkLoginThrottle(w, r, user.Email, clientIP) {
+		return
+	}
+
+	var valid bool
+	if params.RecoveryCode != "" {
+		valid, err = a.useRecoveryCode(r, userID, params.RecoveryCode)
+	} else {
+		valid, err = a.verifyTOTP(r, userID, params.Code)
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		slog.ErrorContext(r.Context(), "failed to verify second factor", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if !valid {
+		a.recordLoginAttempt(r, user.Email, clientIP, false)
+		utils.RespondError(w, http.StatusUnauthorized, "Invalid code")
+		return
+	}
+
+	a.recordLoginAttempt(r, user.Email, clientIP, true)
+	a.issueSession(w, r, user)
+}
+
+// verifyTOTP checks code against the user's confirmed TOTP secret and marks
+// its time step as used.
+func (a *APIHandlerStruct) verifyTOTP(r *http.Request, userID uuid.UUID, code string) (bool, error) {
+	totp, err := a.DBQueries.GetTOTP(r.Context(), userID)
+	if err != nil {
+		return false, err
+	}
+
+	if !totp.ConfirmedAt.Valid {
+		return false, nil
+	}
+
+	step, valid, err := auth.MatchTOTP(totp.Secret, code, time.Now())
+	if err != nil || !valid {
+		return false, err
+	}
+
+	// The update only matches when the step is newer than the last one
+	// used, so a code cannot be replayed.
+	updated, err := a.DBQueries.UseTOTPStep(r.Context(), database.UseTOTPStepParams{
+		UserID:       userID,
+		LastUsedStep: step,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return updated == 1, nil
+}
+
+func (a *APIHandlerStruct) useRecoveryCode(r *http.Request, userID uuid.UUID, code string) (bool, error) {
+	codes, err := a.DBQueries.ListUnusedRecoveryCodes(r.Context(), userID)
+	if err != nil {
+		return false, err
+	}
+
+	code = auth.NormalizeRecoveryCode(code)
+	for _, recoveryCode := range codes {
+		match, err := auth.CheckPassword(code, recoveryCode.HashedCode)
+		if err != nil {
+			return false, err
+		}
+		if !match {
+			continue
+		}
+
+		used, err := a.DBQueries.UseRecoveryCode(r.Context(), recoveryCode.ID)
+		if err != nil {
+			return false, err
+		}
+		return used == 1, nil
+	}
+
+	return false, nil
+}
+
+func (a *APIHandlerStruct) replaceRecoveryCodes(r *http.Request, userID uuid.UUID) ([]string, error) {
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+
+	err = a.DBQueries.DeleteRecoveryCodes(r.Context(), userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, code := range codes {
+		hashedCode, err := a.hashPassword(code)
+		if err != nil {
+			return nil, err
+		}
+
+		err = a.DBQueries.CreateRecoveryCode(r.Context(), database.CreateRecoveryCodeParams{
+			UserID:     userID,
+			HashedCode: hashedCode,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return codes, nil
+}
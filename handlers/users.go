@@ -3,13 +3,12 @@ package handlers
 import (
 	"chirpy/internal/auth"
 	"chirpy/internal/database"
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
-	"log"
+	"log/slog"
 	"net/http"
-
-	"github.com/google/uuid"
 )
 
 type User struct {
@@ -17,6 +16,11 @@ type User struct {
 	Password string `json:"password"`
 }
 
+type UpdateUserResponse struct {
+	database.User
+	PendingEmail string `json:"pending_email,omitempty"`
+}
+
 func (a *APIHandlerStruct) CreateUser(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 
@@ -24,16 +28,24 @@ func (a *APIHandlerStruct) CreateUser(w http.ResponseWriter, r *http.Request) {
 	decoder := json.NewDecoder(r.Body)
 	err := decoder.Decode(&user)
 	if err != nil {
-		log.Println("failed to decode data", err)
+		slog.ErrorContext(r.Context(), "failed to decode data", "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	hashedPassword, err := auth.HashPassword(user.Password)
-	if err != nil {
-		log.Printf("failed to hash user password: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		return
+	// Accounts created without a password log in through magic links.
+	hashedPassword := auth.UnusablePassword
+	if user.Password != "" {
+		if !a.validateNewPassword(w, r, a.DBQueries, user.Password, nil) {
+			return
+		}
+
+		hashedPassword, err = a.hashPassword(user.Password)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to hash user password", "error", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
 	}
 
 	createUserParam := &database.CreateUserParams{
@@ -43,11 +55,13 @@ func (a *APIHandlerStruct) CreateUser(w http.ResponseWriter, r *http.Request) {
 
 	createdUser, err := a.DBQueries.CreateUser(r.Context(), *createUserParam)
 	if err != nil {
-		log.Println("failed to create user", err)
+		slog.ErrorContext(r.Context(), "failed to create user", "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
+	go a.sendEmailVerification(context.WithoutCancel(r.Context()), createdUser.ID, createdUser.Email)
+
 	jsonData, _ := json.Marshal(createdUser)
 
 	w.WriteHeader(http.StatusCreated)
@@ -57,52 +71,77 @@ func (a *APIHandlerStruct) CreateUser(w http.ResponseWriter, r *http.Request) {
 func (a *APIHandlerStruct) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		log.Printf("GetBearerToken error: %v", err)
-		w.WriteHeader(http.StatusUnauthorized)
-		return
-	}
-
-	userUUID, err := auth.ValidateJWT(token, a.APIConfig.JWTSecret)
-	if err != nil {
-		log.Printf("failed to validate JWT: %v", err)
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
 		w.WriteHeader(http.StatusUnauthorized)
 		return
 	}
 
 	var user User
 	decoder := json.NewDecoder(r.Body)
-	err = decoder.Decode(&user)
+	err := decoder.Decode(&user)
 	if err != nil {
-		log.Println("failed to decode data", err)
+		slog.ErrorContext(r.Context(), "failed to decode data", "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	hashedPassword, err := auth.HashPassword(user.Password)
+	currentUser, err := a.DBQueries.GetUserByID(r.Context(), principal.UserID)
 	if err != nil {
-		log.Printf("failed to hash user password: %v", err)
+		if errors.Is(err, sql.ErrNoRows) {
+			slog.ErrorContext(r.Context(), "user ID not found", "error", err)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	userID, err := uuid.Parse(userUUID)
+	// The password is optional so the email can be changed on its own.
+	hashedPassword := currentUser.HashedPassword
+	if user.Password != "" {
+		if !a.validateNewPassword(w, r, a.DBQueries, user.Password, &currentUser) {
+			return
+		}
+
+		hashedPassword, err = a.hashPassword(user.Password)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to hash user password", "error", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	tx, err := a.DB.BeginTx(r.Context(), nil)
 	if err != nil {
-		log.Printf("failed to parse user UUID: %v", err)
+		slog.ErrorContext(r.Context(), "failed to begin transaction", "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	defer tx.Rollback()
 
-	updatedUser, err := a.DBQueries.UpdateUser(r.Context(), database.UpdateUserParams{
-		ID:             userID,
-		Email:          user.Email,
+	qtx := a.DBQueries.InTx(tx)
+
+	if user.Password != "" {
+		err = a.retirePassword(r.Context(), qtx, currentUser)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to update password history", "error", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// A new email address only replaces the current one once it has been
+	// confirmed through VerifyEmail.
+	updatedUser, err := qtx.UpdateUser(r.Context(), database.UpdateUserParams{
+		ID:             principal.UserID,
+		Email:          currentUser.Email,
 		HashedPassword: hashedPassword,
 	})
 
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			log.Printf("user ID not found: %v", err)
+			slog.ErrorContext(r.Context(), "user ID not found", "error", err)
 			w.WriteHeader(http.StatusNotFound)
 			return
 		}
@@ -110,7 +149,20 @@ func (a *APIHandlerStruct) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	jsonData, _ := json.Marshal(updatedUser)
+	err = tx.Commit()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to commit user update", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response := UpdateUserResponse{User: updatedUser}
+	if user.Email != "" && user.Email != currentUser.Email {
+		response.PendingEmail = user.Email
+		go a.sendEmailVerification(context.WithoutCancel(r.Context()), principal.UserID, user.Email)
+	}
+
+	jsonData, _ := json.Marshal(response)
 
 	w.WriteHeader(http.StatusOK)
 	_, _ = w.Write([]byte(jsonData))
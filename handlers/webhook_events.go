@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"chirpy/internal/database"
+	"chirpy/utils"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const webhookEventListLimit = 100
+
+type WebhookEventResponse struct {
+	Provider    string          `json:"provider"`
+	EventID     string          `json:"event_id"`
+	EventType   string          `json:"event_type"`
+	Status      string          `json:"status"`
+	Error       *string         `json:"error"`
+	Attempts    int32           `json:"attempts"`
+	Payload     json.RawMessage `json:"payload"`
+	ReceivedAt  time.Time       `json:"received_at"`
+	ProcessedAt *time.Time      `json:"processed_at"`
+}
+
+func newWebhookEventResponse(event database.WebhookEvent) WebhookEventResponse {
+	response := WebhookEventResponse{
+		Provider:   event.Provider,
+		EventID:    event.EventID,
+		EventType:  event.EventType,
+		Status:     event.Status,
+		Attempts:   event.Attempts,
+		ReceivedAt: event.ReceivedAt,
+	}
+	if event.Error.Valid {
+		response.Error = &event.Error.String
+	}
+	if event.ProcessedAt.Valid {
+		response.ProcessedAt = &event.ProcessedAt.Time
+	}
+
+	// Payloads that failed to decode are shown as the string they were.
+	if json.Valid([]byte(event.Payload)) {
+		response.Payload = json.RawMessage(event.Payload)
+	} else {
+		response.Payload, _ = json.Marshal(event.Payload)
+	}
+	return response
+}
+
+// ListWebhookEvents lists the most recent webhook events with the status given
+// in the query, failed ones by default.
+func (a *APIHandlerStruct) ListWebhookEvents(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = "failed"
+	}
+
+	if status != "processing" && status != "processed" && status != "failed" {
+		utils.RespondError(w, http.StatusBadRequest, "Status must be processing, processed or failed")
+		return
+	}
+
+	events, err := a.DBQueries.ListWebhookEventsByStatus(r.Context(), database.ListWebhookEventsByStatusParams{
+		Status: status,
+		Limit:  webhookEventListLimit,
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to list webhook events", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]WebhookEventResponse, 0, len(events))
+	for _, event := range events {
+		response = append(response, newWebhookEventResponse(event))
+	}
+
+	utils.RespondJSON(w, http.StatusOK, response)
+}
+
+// ReplayWebhookEvent processes a failed webhook event again from its stored
+// payload and responds with the event's new state.
+func (a *APIHandlerStruct) ReplayWebhookEvent(w http.ResponseWriter, r *http.Request) {
+	provider := r.PathValue("provider")
+	eventID := r.PathValue("eventID")
+
+	billingProvider, ok := a.APIConfig.BillingProviders[provider]
+	if !ok {
+		utils.RespondError(w, http.StatusNotFound, "Webhook event not found")
+		return
+	}
+
+	event, err := a.DBQueries.ClaimFailedWebhookEvent(r.Context(), database.ClaimFailedWebhookEventParams{
+		Provider: provider,
+		EventID:  eventID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		_, err = a.DBQueries.GetWebhookEvent(r.Context(), database.GetWebhookEventParams{
+			Provider: provider,
+			EventID:  eventID,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.RespondError(w, http.StatusNotFound, "Webhook event not found")
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to get webhook event", "error", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		utils.RespondError(w, http.StatusConflict, "Only failed events can be replayed")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to claim webhook event", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	notification, err := billingProvider.Parse([]byte(event.Payload))
+	if err == nil {
+		err = a.processBillingEvent(r.Context(), provider, eventID, event.ReceivedAt, notification)
+	}
+	if err != nil {
+		a.failWebhookEvent(r.Context(), provider, eventID, err)
+	}
+
+	event, err = a.DBQueries.GetWebhookEvent(r.Context(), database.GetWebhookEventParams{
+		Provider: provider,
+		EventID:  eventID,
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get webhook event", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	utils.RespondJSON(w, http.StatusOK, newWebhookEventResponse(event))
+}
@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"strings"
+)
+
+// Scopes that personal API keys can be granted.
+const (
+	ScopeChirpsRead   = "chirps:read"
+	ScopeChirpsWrite  = "chirps:write"
+	ScopeProfileWrite = "profile:write"
+)
+
+var Scopes = []string{ScopeChirpsRead, ScopeChirpsWrite, ScopeProfileWrite}
+
+const (
+	apiKeyPrefix = "chirpy_"
+	// apiKeyDisplayLength is how much of a key is kept in clear text so
+	// users can tell their keys apart.
+	apiKeyDisplayLength = len(apiKeyPrefix) + 6
+)
+
+var apiKeyEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func IsValidScope(scope string) bool {
+	for _, s := range Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// MakeAPIKey returns a new personal API key and its display prefix. Only the
+// prefix and HashToken(key) are stored.
+func MakeAPIKey() (key, prefix string, err error) {
+	randomBytes := make([]byte, 30)
+	_, err = rand.Read(randomBytes)
+	if err != nil {
+		return "", "", err
+	}
+
+	key = apiKeyPrefix + strings.ToLower(apiKeyEncoding.EncodeToString(randomBytes))
+	return key, key[:apiKeyDisplayLength], nil
+}
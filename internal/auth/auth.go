@@ -2,9 +2,9 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
-	"log"
 	"net/http"
 	"strings"
 	"time"
@@ -14,21 +14,79 @@ import (
 	"github.com/google/uuid"
 )
 
+// UnusablePassword is stored for accounts without a password, matching the
+// default from migration 003. Such accounts log in through magic links.
+const UnusablePassword = "unset"
+
 func HashPassword(password string) (string, error) {
 	return argon2id.CreateHash(password, argon2id.DefaultParams)
 }
 
+func HashPasswordWithParams(password string, params *argon2id.Params) (string, error) {
+	return argon2id.CreateHash(password, params)
+}
+
 func CheckPassword(password, hashedPassword string) (bool, error) {
 	return argon2id.ComparePasswordAndHash(password, hashedPassword)
 }
 
+// HasUsablePassword reports whether hashedPassword is a real password hash
+// rather than UnusablePassword or another placeholder.
+func HasUsablePassword(hashedPassword string) bool {
+	_, _, _, err := argon2id.DecodeHash(hashedPassword)
+	return err == nil
+}
+
+// NeedsRehash reports whether hashedPassword was created with parameters
+// other than params. Login uses it to upgrade hashes once it has the
+// plaintext password at hand.
+func NeedsRehash(hashedPassword string, params *argon2id.Params) (bool, error) {
+	current, _, _, err := argon2id.DecodeHash(hashedPassword)
+	if err != nil {
+		return false, err
+	}
+
+	return *current != *params, nil
+}
+
+const (
+	TierFree      = "free"
+	TierChirpyRed = "chirpy_red"
+	tokenIssuer   = "chirpy"
+
+	// Access tokens and 2FA challenge tokens are signed with the same secret,
+	// the audience keeps one from being accepted as the other.
+	accessTokenAudience    = "chirpy-api"
+	challengeTokenAudience = "chirpy-2fa"
+)
+
+// Claims are the JWT claims issued by chirpy. Scopes, SessionID, Tier, Role and
+// ClientID are optional and end up on the request Principal once the token is
+// validated. ClientID is set on tokens issued to OAuth clients.
+type Claims struct {
+	jwt.RegisteredClaims
+	Scopes    []string `json:"scopes,omitempty"`
+	SessionID string   `json:"sid,omitempty"`
+	Tier      string   `json:"tier,omitempty"`
+	Role      string   `json:"role,omitempty"`
+	ClientID  string   `json:"client_id,omitempty"`
+}
+
 func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
-		Issuer:    "chirpy",
-		IssuedAt:  jwt.NewNumericDate(time.Now()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
-		Subject:   userID.String(),
-	})
+	return MakeJWTWithClaims(userID, tokenSecret, expiresIn, Claims{})
+}
+
+func MakeJWTWithClaims(userID uuid.UUID, tokenSecret string, expiresIn time.Duration, claims Claims) (string, error) {
+	now := time.Now()
+	claims.Issuer = tokenIssuer
+	claims.IssuedAt = jwt.NewNumericDate(now)
+	claims.ExpiresAt = jwt.NewNumericDate(now.Add(expiresIn))
+	claims.Subject = userID.String()
+	if len(claims.Audience) == 0 {
+		claims.Audience = jwt.ClaimStrings{accessTokenAudience}
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
 	jwtToken, err := token.SignedString([]byte(tokenSecret))
 	if err != nil {
@@ -39,16 +97,49 @@ func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (str
 }
 
 func ValidateJWT(tokenString, tokenSecret string) (string, error) {
-	jwtToken, err := jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(tokenSecret), nil
-	})
+	claims, err := ParseJWT(tokenString, tokenSecret)
 	if err != nil {
-		log.Printf("failed to validate JWT: %v, %s", err, tokenString)
 		return "", err
 	}
 
-	userID := jwtToken.Claims.(*jwt.RegisteredClaims).Subject
-	return userID, nil
+	return claims.Subject, nil
+}
+
+// ParseJWT validates the signature, expiry and audience of an access token and
+// returns its claims.
+func ParseJWT(tokenString, tokenSecret string) (*Claims, error) {
+	return parseJWT(tokenString, tokenSecret, accessTokenAudience)
+}
+
+// MakeChallengeToken issues the short-lived token a client exchanges for a
+// session once it has passed the second authentication factor.
+func MakeChallengeToken(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
+	return MakeJWTWithClaims(userID, tokenSecret, expiresIn, Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience: jwt.ClaimStrings{challengeTokenAudience},
+		},
+	})
+}
+
+func ParseChallengeToken(tokenString, tokenSecret string) (uuid.UUID, error) {
+	claims, err := parseJWT(tokenString, tokenSecret, challengeTokenAudience)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	return uuid.Parse(claims.Subject)
+}
+
+func parseJWT(tokenString, tokenSecret, audience string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(tokenSecret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithAudience(audience))
+	if err != nil {
+		return nil, err
+	}
+
+	return claims, nil
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
@@ -89,6 +180,14 @@ func MakeRefreshToken() (string, error) {
 	return refreshToken, nil
 }
 
+// HashToken returns the hex SHA-256 digest of a random token. One-time tokens
+// are stored hashed so a leaked table cannot be replayed; they carry enough
+// entropy that a fast hash is sufficient, unlike passwords.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
 func GetAPIKey(headers http.Header) (string, error) {
 	apiKey := headers.Get("Authorization")
 	if apiKey == "" {
@@ -22,3 +22,17 @@ func TestHashAndCheckPassword(t *testing.T) {
 		t.Fatalf("Password does not match hashed password")
 	}
 }
+
+func TestHasUsablePassword(t *testing.T) {
+	hashedPassword, err := auth.HashPassword("securepassword123")
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+
+	if !auth.HasUsablePassword(hashedPassword) {
+		t.Fatal("Expected an argon2id hash to be usable")
+	}
+	if auth.HasUsablePassword(auth.UnusablePassword) {
+		t.Fatal("Expected the unusable password marker not to be usable")
+	}
+}
@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+)
+
+var ErrInvalidRedirectURI = errors.New("redirect URI must be an absolute https URL, or http on a loopback address, without a fragment")
+
+// ParseScope splits an OAuth scope parameter into its space-separated scopes.
+func ParseScope(scope string) []string {
+	return strings.Fields(scope)
+}
+
+func FormatScope(scopes []string) string {
+	return strings.Join(scopes, " ")
+}
+
+// IsValidCodeChallenge reports whether challenge looks like an S256 PKCE
+// challenge: the unpadded base64url encoding of a SHA-256 digest.
+func IsValidCodeChallenge(challenge string) bool {
+	decoded, err := base64.RawURLEncoding.DecodeString(challenge)
+	return err == nil && len(decoded) == sha256.Size
+}
+
+// VerifyPKCE checks a code verifier against the S256 challenge sent with the
+// authorization request (RFC 7636).
+func VerifyPKCE(verifier, challenge string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+// ValidateRedirectURI checks a redirect URI at client registration. Plain
+// http is only allowed for loopback addresses, which native apps listen on.
+func ValidateRedirectURI(rawURI string) error {
+	uri, err := url.Parse(rawURI)
+	if err != nil || !uri.IsAbs() || uri.Host == "" || uri.Fragment != "" {
+		return ErrInvalidRedirectURI
+	}
+
+	switch uri.Scheme {
+	case "https":
+		return nil
+	case "http":
+		host := uri.Hostname()
+		if host == "localhost" {
+			return nil
+		}
+		if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+			return nil
+		}
+	}
+
+	return ErrInvalidRedirectURI
+}
@@ -0,0 +1,63 @@
+package auth_test
+
+import (
+	"chirpy/internal/auth"
+	"testing"
+)
+
+func TestVerifyPKCEMatchesRFC7636Example(t *testing.T) {
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	if !auth.IsValidCodeChallenge(challenge) {
+		t.Fatalf("Expected %s to be a valid code challenge", challenge)
+	}
+	if !auth.VerifyPKCE(verifier, challenge) {
+		t.Fatal("Expected the RFC 7636 verifier to match its challenge")
+	}
+	if auth.VerifyPKCE(verifier+"x", challenge) {
+		t.Fatal("Expected a different verifier to be rejected")
+	}
+	if auth.IsValidCodeChallenge("not-a-challenge") {
+		t.Fatal("Expected a malformed challenge to be rejected")
+	}
+}
+
+func TestVerifyPKCERejectsShortVerifier(t *testing.T) {
+	if auth.VerifyPKCE("short", "BXkz8zUlwsHuJeOVd5h3LjRwk4Ox6hnMB2yfFOtF7k8") {
+		t.Fatal("Expected a verifier under 43 characters to be rejected")
+	}
+}
+
+func TestValidateRedirectURI(t *testing.T) {
+	tests := []struct {
+		uri   string
+		valid bool
+	}{
+		{"https://example.com/callback", true},
+		{"http://localhost:3000/callback", true},
+		{"http://127.0.0.1:8000/cb", true},
+		{"http://[::1]/cb", true},
+		{"http://example.com/callback", false},
+		{"https://example.com/callback#frag", false},
+		{"/callback", false},
+		{"javascript:alert(1)", false},
+	}
+
+	for _, tt := range tests {
+		err := auth.ValidateRedirectURI(tt.uri)
+		if (err == nil) != tt.valid {
+			t.Fatalf("ValidateRedirectURI(%q) = %v, expected valid=%v", tt.uri, err, tt.valid)
+		}
+	}
+}
+
+func TestParseScope(t *testing.T) {
+	scopes := auth.ParseScope("  chirps:read   chirps:write ")
+	if len(scopes) != 2 || scopes[0] != "chirps:read" || scopes[1] != "chirps:write" {
+		t.Fatalf("Unexpected scopes %v", scopes)
+	}
+	if auth.FormatScope(scopes) != "chirps:read chirps:write" {
+		t.Fatalf("Unexpected formatted scope %q", auth.FormatScope(scopes))
+	}
+}
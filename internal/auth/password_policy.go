@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"bufio"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// PasswordPolicy is checked whenever a user picks a new password.
+type PasswordPolicy struct {
+	MinLength int
+	// Banned holds lowercased passwords that are too common to allow.
+	Banned map[string]struct{}
+	// HistorySize is how many of the user's most recent passwords, the
+	// current one included, cannot be reused.
+	HistorySize int
+}
+
+var (
+	ErrPasswordTooShort = errors.New("password is too short")
+	ErrPasswordBanned   = errors.New("password is too common")
+	ErrPasswordReused   = errors.New("password was used recently")
+)
+
+//go:embed banned_passwords.txt
+var defaultBannedPasswords string
+
+// DefaultBannedPasswords returns the list of common passwords built into the
+// server.
+func DefaultBannedPasswords() map[string]struct{} {
+	banned, _ := readBannedPasswords(strings.NewReader(defaultBannedPasswords))
+	return banned
+}
+
+// LoadBannedPasswords reads one password per line. Blank lines and lines
+// starting with # are ignored.
+func LoadBannedPasswords(path string) (map[string]struct{}, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return readBannedPasswords(f)
+}
+
+func readBannedPasswords(r io.Reader) (map[string]struct{}, error) {
+	banned := map[string]struct{}{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		banned[strings.ToLower(line)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read banned passwords: %w", err)
+	}
+
+	return banned, nil
+}
+
+// Validate checks the parts of the policy that only need the password.
+func (p PasswordPolicy) Validate(password string) error {
+	if utf8.RuneCountInString(password) < max(p.MinLength, 1) {
+		return ErrPasswordTooShort
+	}
+
+	if _, banned := p.Banned[strings.ToLower(password)]; banned {
+		return ErrPasswordBanned
+	}
+
+	return nil
+}
+
+// CheckReuse compares password with the user's recent password hashes,
+// newest first, and returns ErrPasswordReused on a match. Only the first
+// HistorySize hashes are considered.
+func (p PasswordPolicy) CheckReuse(password string, recentHashes []string) error {
+	for i, hash := range recentHashes {
+		if i >= p.HistorySize {
+			break
+		}
+
+		match, err := CheckPassword(password, hash)
+		if err != nil {
+			// Placeholder hashes such as 'unset' can never match.
+			continue
+		}
+		if match {
+			return ErrPasswordReused
+		}
+	}
+
+	return nil
+}
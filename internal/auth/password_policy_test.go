@@ -0,0 +1,103 @@
+package auth_test
+
+import (
+	"chirpy/internal/auth"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alexedwards/argon2id"
+)
+
+func TestPasswordPolicyValidate(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "banned.txt")
+	err := os.WriteFile(path, []byte("# common passwords\nPassword123\n\nletmein123\n"), 0o600)
+	if err != nil {
+		t.Fatalf("Failed to write banned passwords: %v", err)
+	}
+
+	banned, err := auth.LoadBannedPasswords(path)
+	if err != nil {
+		t.Fatalf("Failed to load banned passwords: %v", err)
+	}
+
+	policy := auth.PasswordPolicy{MinLength: 8, Banned: banned}
+
+	tests := []struct {
+		password string
+		want     error
+	}{
+		{"", auth.ErrPasswordTooShort},
+		{"short", auth.ErrPasswordTooShort},
+		{"password123", auth.ErrPasswordBanned},
+		{"LETMEIN123", auth.ErrPasswordBanned},
+		{"correct horse battery staple", nil},
+	}
+
+	for _, tt := range tests {
+		err := policy.Validate(tt.password)
+		if !errors.Is(err, tt.want) {
+			t.Fatalf("Validate(%q): expected %v, got %v", tt.password, tt.want, err)
+		}
+	}
+
+	if err := (auth.PasswordPolicy{}).Validate(""); !errors.Is(err, auth.ErrPasswordTooShort) {
+		t.Fatalf("Expected empty password to be rejected without a minimum length, got %v", err)
+	}
+}
+
+func TestPasswordPolicyCheckReuse(t *testing.T) {
+	oldest, err := auth.HashPassword("first-password")
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+	newest, err := auth.HashPassword("second-password")
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+
+	policy := auth.PasswordPolicy{HistorySize: 1}
+	recent := []string{newest, "unset", oldest}
+
+	if err := policy.CheckReuse("second-password", recent); !errors.Is(err, auth.ErrPasswordReused) {
+		t.Fatalf("Expected current password to be rejected, got %v", err)
+	}
+	if err := policy.CheckReuse("first-password", recent); err != nil {
+		t.Fatalf("Expected password outside the history size to be allowed, got %v", err)
+	}
+
+	policy.HistorySize = 3
+	if err := policy.CheckReuse("first-password", recent); !errors.Is(err, auth.ErrPasswordReused) {
+		t.Fatalf("Expected password within the history size to be rejected, got %v", err)
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	params := &argon2id.Params{Memory: 16 * 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	upgraded := &argon2id.Params{Memory: 16 * 1024, Iterations: 2, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+	hash, err := auth.HashPasswordWithParams("securepassword123", params)
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+
+	outdated, err := auth.NeedsRehash(hash, params)
+	if err != nil || outdated {
+		t.Fatalf("Expected hash with current params to be up to date, got %v, %v", outdated, err)
+	}
+
+	outdated, err = auth.NeedsRehash(hash, upgraded)
+	if err != nil || !outdated {
+		t.Fatalf("Expected hash with old params to need a rehash, got %v, %v", outdated, err)
+	}
+}
+
+func TestDefaultBannedPasswords(t *testing.T) {
+	policy := auth.PasswordPolicy{MinLength: 8, Banned: auth.DefaultBannedPasswords()}
+
+	if err := policy.Validate("Password123"); !errors.Is(err, auth.ErrPasswordBanned) {
+		t.Fatalf("Expected the built-in list to ban a common password, got %v", err)
+	}
+}
@@ -0,0 +1,52 @@
+package auth
+
+type Role string
+
+const (
+	RoleUser      Role = "user"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+type Permission string
+
+const (
+	PermissionViewMetrics    Permission = "admin:metrics"
+	PermissionModerateChirps Permission = "admin:moderate-chirps"
+	PermissionManageRoles    Permission = "admin:manage-roles"
+	PermissionResetDatabase  Permission = "admin:reset"
+	PermissionManageWebhooks Permission = "admin:webhooks"
+)
+
+// rolePermissions is the access policy for the admin API. Moderators get the
+// read-only and moderation permissions, destructive operations stay with admins.
+var rolePermissions = map[Role][]Permission{
+	RoleModerator: {
+		PermissionViewMetrics,
+		PermissionModerateChirps,
+	},
+	RoleAdmin: {
+		PermissionViewMetrics,
+		PermissionModerateChirps,
+		PermissionManageRoles,
+		PermissionResetDatabase,
+		PermissionManageWebhooks,
+	},
+}
+
+func ParseRole(role string) (Role, bool) {
+	switch Role(role) {
+	case RoleUser, RoleModerator, RoleAdmin:
+		return Role(role), true
+	}
+	return "", false
+}
+
+func (r Role) Can(permission Permission) bool {
+	for _, p := range rolePermissions[r] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
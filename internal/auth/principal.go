@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"context"
+	"slices"
+
+	"github.com/google/uuid"
+)
+
+// Principal is the authenticated caller of a request. First-party sessions
+// may do anything the user can. Delegated credentials such as API keys and
+// OAuth tokens set Delegated and may only do what their Scopes allow, so one
+// that lost its scopes on the way can do nothing rather than everything.
+// ClientID is the OAuth client acting on the user's behalf, if any.
+type Principal struct {
+	UserID    uuid.UUID
+	Delegated bool
+	Scopes    []string
+	SessionID string
+	Tier      string
+	Role      Role
+	ClientID  string
+}
+
+type principalKey struct{}
+
+func (p *Principal) HasScope(scope string) bool {
+	return p.IsSession() || slices.Contains(p.Scopes, scope)
+}
+
+// IsSession reports whether the principal is a first-party session rather
+// than a delegated credential. Anything that carries a client or scopes is
+// delegated, whether or not Delegated was set.
+func (p *Principal) IsSession() bool {
+	return !p.Delegated && p.ClientID == "" && p.Scopes == nil
+}
+
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(*Principal)
+	return principal, ok && principal != nil
+}
@@ -0,0 +1,35 @@
+package auth_test
+
+import (
+	"chirpy/internal/auth"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestDelegatedPrincipalsNeverActAsSessions(t *testing.T) {
+	tests := []struct {
+		name      string
+		principal auth.Principal
+		session   bool
+		canWrite  bool
+	}{
+		{"session", auth.Principal{UserID: uuid.New()}, true, true},
+		{"API key with scope", auth.Principal{Delegated: true, Scopes: []string{auth.ScopeChirpsWrite}}, false, true},
+		{"API key without scopes", auth.Principal{Delegated: true, Scopes: []string{}}, false, false},
+		{"delegated with nil scopes", auth.Principal{Delegated: true}, false, false},
+		{"OAuth client with nil scopes", auth.Principal{ClientID: uuid.NewString()}, false, false},
+		{"scopes without the flag", auth.Principal{Scopes: []string{auth.ScopeChirpsRead}}, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.principal.IsSession(); got != tt.session {
+				t.Fatalf("Expected IsSession %v, got %v", tt.session, got)
+			}
+			if got := tt.principal.HasScope(auth.ScopeChirpsWrite); got != tt.canWrite {
+				t.Fatalf("Expected HasScope %v, got %v", tt.canWrite, got)
+			}
+		})
+	}
+}
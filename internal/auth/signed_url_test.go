@@ -0,0 +1,39 @@
+package auth_test
+
+import (
+	"chirpy/internal/auth"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestSignedURL(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	path := "/api/users/me/export/123"
+	query, err := url.ParseQuery(auth.SignURL("secret", path, now.Add(time.Minute)))
+	if err != nil {
+		t.Fatalf("Failed to parse signed query: %v", err)
+	}
+
+	if err := auth.VerifySignedURL("secret", path, query, now); err != nil {
+		t.Fatalf("Expected a valid signature, got %v", err)
+	}
+
+	if err := auth.VerifySignedURL("secret", path, query, now.Add(time.Minute)); !errors.Is(err, auth.ErrSignatureExpired) {
+		t.Fatalf("Expected ErrSignatureExpired, got %v", err)
+	}
+
+	if err := auth.VerifySignedURL("secret", "/api/users/me/export/456", query, now); !errors.Is(err, auth.ErrInvalidSignature) {
+		t.Fatalf("Expected a signature for another path to be rejected, got %v", err)
+	}
+
+	if err := auth.VerifySignedURL("other-secret", path, query, now); !errors.Is(err, auth.ErrInvalidSignature) {
+		t.Fatalf("Expected a signature from another secret to be rejected, got %v", err)
+	}
+
+	query.Set("expires", "9999999999")
+	if err := auth.VerifySignedURL("secret", path, query, now); !errors.Is(err, auth.ErrInvalidSignature) {
+		t.Fatalf("Expected an extended expiry to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"sync"
+	"time"
+
+	"github.com/alexedwards/argon2id"
+)
+
+// LoginThrottle decides how long a client has to wait before its next login
+// attempt, based on the failures recorded within Window. The first
+// FreeAttempts failures cost nothing, after that the delay doubles with every
+// failure up to MaxDelay, and from LockoutAfter failures on the client is
+// locked out for LockoutDuration.
+type LoginThrottle struct {
+	Window          time.Duration
+	FreeAttempts    int
+	BaseDelay       time.Duration
+	MaxDelay        time.Duration
+	LockoutAfter    int
+	LockoutDuration time.Duration
+}
+
+// RetryAfter returns how much longer the client has to wait given the number
+// of recent failures and the time of the last one. Zero means it may try now.
+func (t LoginThrottle) RetryAfter(failures int, lastFailure, now time.Time) time.Duration {
+	if failures < t.FreeAttempts {
+		return 0
+	}
+
+	var wait time.Duration
+	if t.LockoutAfter > 0 && failures >= t.LockoutAfter {
+		wait = t.LockoutDuration
+	} else {
+		wait = t.BaseDelay
+		for i := t.FreeAttempts; i < failures && wait < t.MaxDelay; i++ {
+			wait *= 2
+		}
+		wait = min(wait, t.MaxDelay)
+	}
+
+	return max(lastFailure.Add(wait).Sub(now), 0)
+}
+
+var (
+	dummyHashesMu sync.Mutex
+	dummyHashes   = map[argon2id.Params]string{}
+)
+
+// CheckDummyPassword does the same work as CheckPassword against a throwaway
+// hash created with params. Login runs it for unknown emails so they take as
+// long as a wrong password and the response time does not reveal which
+// accounts exist.
+func CheckDummyPassword(password string, params *argon2id.Params) {
+	dummyHashesMu.Lock()
+	hash, ok := dummyHashes[*params]
+	if !ok {
+		var err error
+		hash, err = HashPasswordWithParams("chirpy-dummy-password", params)
+		if err != nil {
+			dummyHashesMu.Unlock()
+			return
+		}
+		dummyHashes[*params] = hash
+	}
+	dummyHashesMu.Unlock()
+
+	_, _ = CheckPassword(password, hash)
+}
@@ -0,0 +1,44 @@
+package auth_test
+
+import (
+	"chirpy/internal/auth"
+	"testing"
+	"time"
+)
+
+func TestLoginThrottleRetryAfter(t *testing.T) {
+	throttle := auth.LoginThrottle{
+		Window:          15 * time.Minute,
+		FreeAttempts:    3,
+		BaseDelay:       time.Second,
+		MaxDelay:        time.Minute,
+		LockoutAfter:    10,
+		LockoutDuration: 15 * time.Minute,
+	}
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		failures    int
+		lastFailure time.Time
+		want        time.Duration
+	}{
+		{"no failures", 0, time.Time{}, 0},
+		{"within free attempts", 2, now, 0},
+		{"first delay", 3, now, time.Second},
+		{"doubles", 5, now, 4 * time.Second},
+		{"capped", 9, now, time.Minute},
+		{"partially elapsed", 4, now.Add(-500 * time.Millisecond), 1500 * time.Millisecond},
+		{"fully elapsed", 4, now.Add(-time.Hour), 0},
+		{"locked out", 10, now.Add(-5 * time.Minute), 10 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := throttle.RetryAfter(tt.failures, tt.lastFailure, now)
+			if got != tt.want {
+				t.Fatalf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTP parameters (RFC 6238). These are the defaults every authenticator app
+// understands, so they are not configurable.
+const (
+	TOTPPeriod = 30 * time.Second
+	TOTPDigits = 6
+	// TOTPSkew is the number of periods accepted on either side of the
+	// current one to tolerate clock drift.
+	TOTPSkew = 1
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func GenerateTOTPSecret() (string, error) {
+	secret := make([]byte, 20)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(secret), nil
+}
+
+// TOTPStep returns the RFC 6238 time step counter for t.
+func TOTPStep(t time.Time) int64 {
+	return t.Unix() / int64(TOTPPeriod/time.Second)
+}
+
+// TOTPCode returns the code for secret at time t.
+func TOTPCode(secret string, t time.Time) (string, error) {
+	key, err := decodeTOTPSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return hotp(key, TOTPStep(t)), nil
+}
+
+// MatchTOTP checks code against the steps around t and returns the matching
+// step. Callers persist the step and reject codes for steps that were already
+// used, which stops a code from being replayed within its validity window.
+func MatchTOTP(secret, code string, t time.Time) (int64, bool, error) {
+	key, err := decodeTOTPSecret(secret)
+	if err != nil {
+		return 0, false, err
+	}
+
+	code = strings.TrimSpace(code)
+	if len(code) != TOTPDigits {
+		return 0, false, nil
+	}
+
+	current := TOTPStep(t)
+	for step := current - TOTPSkew; step <= current+TOTPSkew; step++ {
+		if subtle.ConstantTimeCompare([]byte(hotp(key, step)), []byte(code)) == 1 {
+			return step, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// TOTPProvisioningURI returns the otpauth:// URI that authenticator apps
+// import, usually by scanning it as a QR code.
+func TOTPProvisioningURI(secret, issuer, accountName string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(TOTPDigits))
+	query.Set("period", fmt.Sprint(int(TOTPPeriod/time.Second)))
+
+	label := url.PathEscape(issuer + ":" + accountName)
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+func decodeTOTPSecret(secret string) ([]byte, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil {
+		return nil, fmt.Errorf("invalid TOTP secret: %w", err)
+	}
+	return key, nil
+}
+
+// hotp implements RFC 4226 with dynamic truncation.
+func hotp(key []byte, counter int64) string {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(counter))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for range TOTPDigits {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", TOTPDigits, value%mod)
+}
+
+const recoveryCodeAlphabet = "abcdefghijklmnopqrstuvwxyz234567"
+
+// GenerateRecoveryCodes returns n single-use codes formatted as xxxxx-xxxxx.
+// Store them with HashPassword and compare with NormalizeRecoveryCode applied
+// to the user's input.
+func GenerateRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, 0, n)
+	for range n {
+		raw := make([]byte, 10)
+		_, err := rand.Read(raw)
+		if err != nil {
+			return nil, err
+		}
+
+		var code strings.Builder
+		for i, b := range raw {
+			if i == 5 {
+				code.WriteByte('-')
+			}
+			code.WriteByte(recoveryCodeAlphabet[b&31])
+		}
+		codes = append(codes, code.String())
+	}
+	return codes, nil
+}
+
+// NormalizeRecoveryCode strips the formatting users tend to add or drop when
+// typing a recovery code.
+func NormalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.NewReplacer(" ", "", "-", "").Replace(code)
+	if len(code) == 10 {
+		code = code[:5] + "-" + code[5:]
+	}
+	return code
+}
@@ -0,0 +1,137 @@
+package auth_test
+
+import (
+	"chirpy/internal/auth"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RFC 6238 appendix B secret ("12345678901234567890") in base32.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCodeMatchesRFC6238Vectors(t *testing.T) {
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tt := range tests {
+		code, err := auth.TOTPCode(rfcSecret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatalf("Failed to compute TOTP code: %v", err)
+		}
+		if code != tt.code {
+			t.Fatalf("At %d expected code %s, got %s", tt.unix, tt.code, code)
+		}
+	}
+}
+
+func TestMatchTOTPAcceptsSkewOnly(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+
+	previous, err := auth.TOTPCode(rfcSecret, now.Add(-auth.TOTPPeriod))
+	if err != nil {
+		t.Fatalf("Failed to compute TOTP code: %v", err)
+	}
+
+	step, ok, err := auth.MatchTOTP(rfcSecret, previous, now)
+	if err != nil {
+		t.Fatalf("Failed to match TOTP code: %v", err)
+	}
+	if !ok || step != auth.TOTPStep(now)-1 {
+		t.Fatalf("Expected previous step to match, got ok=%v step=%d", ok, step)
+	}
+
+	stale, err := auth.TOTPCode(rfcSecret, now.Add(-3*auth.TOTPPeriod))
+	if err != nil {
+		t.Fatalf("Failed to compute TOTP code: %v", err)
+	}
+
+	_, ok, err = auth.MatchTOTP(rfcSecret, stale, now)
+	if err != nil {
+		t.Fatalf("Failed to match TOTP code: %v", err)
+	}
+	if ok {
+		t.Fatalf("Expected code from three periods ago to be rejected")
+	}
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	uri := auth.TOTPProvisioningURI(rfcSecret, "Chirpy", "user@example.com")
+
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		t.Fatalf("Failed to parse provisioning URI: %v", err)
+	}
+	if parsed.Scheme != "otpauth" || parsed.Host != "totp" {
+		t.Fatalf("Unexpected provisioning URI: %s", uri)
+	}
+	if parsed.Query().Get("secret") != rfcSecret || parsed.Query().Get("issuer") != "Chirpy" {
+		t.Fatalf("Unexpected provisioning URI query: %s", parsed.RawQuery)
+	}
+	if !strings.HasSuffix(parsed.Path, "Chirpy:user@example.com") {
+		t.Fatalf("Unexpected provisioning URI label: %s", parsed.Path)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := auth.GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatalf("Failed to generate recovery codes: %v", err)
+	}
+
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Fatalf("Unexpected recovery code format: %q", code)
+		}
+		if seen[code] {
+			t.Fatalf("Duplicate recovery code: %q", code)
+		}
+		seen[code] = true
+
+		typed := strings.ToUpper(strings.ReplaceAll(code, "-", " "))
+		if auth.NormalizeRecoveryCode(typed) != code {
+			t.Fatalf("Expected %q to normalize to %q", typed, code)
+		}
+	}
+}
+
+func TestChallengeTokenIsNotAnAccessToken(t *testing.T) {
+	userID := uuid.New()
+
+	challenge, err := auth.MakeChallengeToken(userID, "secret", time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to make challenge token: %v", err)
+	}
+
+	if _, err := auth.ParseJWT(challenge, "secret"); err == nil {
+		t.Fatalf("Expected challenge token to be rejected as an access token")
+	}
+
+	got, err := auth.ParseChallengeToken(challenge, "secret")
+	if err != nil {
+		t.Fatalf("Failed to parse challenge token: %v", err)
+	}
+	if got != userID {
+		t.Fatalf("Expected user %s, got %s", userID, got)
+	}
+
+	access, err := auth.MakeJWT(userID, "secret", time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to make JWT: %v", err)
+	}
+	if _, err := auth.ParseChallengeToken(access, "secret"); err == nil {
+		t.Fatalf("Expected access token to be rejected as a challenge token")
+	}
+}
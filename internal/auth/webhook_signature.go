@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidWebhookSignature = errors.New("invalid webhook signature")
+	ErrWebhookTimestamp        = errors.New("webhook timestamp is outside the tolerance window")
+)
+
+// webhookSignatureVersion prefixes each signature so the scheme can change
+// without breaking senders that still use this one.
+const webhookSignatureVersion = "v1"
+
+// SignWebhook returns the signature header value for body sent at timestamp:
+// v1= followed by the hex HMAC-SHA256 of "<unix timestamp>.<body>".
+func SignWebhook(secret string, timestamp time.Time, body []byte) string {
+	return webhookSignatureVersion + "=" + hex.EncodeToString(webhookMAC(secret, strconv.FormatInt(timestamp.Unix(), 10), body))
+}
+
+// VerifyWebhookSignature checks a webhook's timestamp and signature headers
+// against body. The signature header may hold several comma-separated
+// signatures and any of secrets may have made them, so both sides can rotate
+// secrets without dropping webhooks. Requests signed more than tolerance away
+// from now are rejected so a captured request cannot be replayed later.
+func VerifyWebhookSignature(secrets []string, timestampHeader, signatureHeader string, body []byte, tolerance time.Duration, now time.Time) error {
+	timestamp, err := strconv.ParseInt(timestampHeader, 10, 64)
+	if err != nil {
+		return ErrInvalidWebhookSignature
+	}
+
+	var signatures [][]byte
+	for _, value := range strings.Split(signatureHeader, ",") {
+		version, signature, found := strings.Cut(strings.TrimSpace(value), "=")
+		if !found || version != webhookSignatureVersion {
+			continue
+		}
+
+		decoded, err := hex.DecodeString(signature)
+		if err != nil {
+			continue
+		}
+		signatures = append(signatures, decoded)
+	}
+
+	valid := false
+	for _, secret := range secrets {
+		if secret == "" {
+			continue
+		}
+
+		expected := webhookMAC(secret, timestampHeader, body)
+		for _, signature := range signatures {
+			if subtle.ConstantTimeCompare(signature, expected) == 1 {
+				valid = true
+			}
+		}
+	}
+	if !valid {
+		return ErrInvalidWebhookSignature
+	}
+
+	age := now.Sub(time.Unix(timestamp, 0))
+	if age > tolerance || age < -tolerance {
+		return ErrWebhookTimestamp
+	}
+
+	return nil
+}
+
+func webhookMAC(secret, timestamp string, body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
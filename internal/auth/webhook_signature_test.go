@@ -0,0 +1,77 @@
+package auth_test
+
+import (
+	"chirpy/internal/auth"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestVerifyWebhookSignature(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	body := []byte(`{"event":"user.upgraded"}`)
+	signature := auth.SignWebhook("current", now, body)
+
+	err := auth.VerifyWebhookSignature([]string{"current"}, timestamp, signature, body, 5*time.Minute, now)
+	if err != nil {
+		t.Fatalf("Expected a valid signature, got %v", err)
+	}
+
+	err = auth.VerifyWebhookSignature([]string{"current"}, timestamp, signature, []byte(`{"event":"user.downgraded"}`), 5*time.Minute, now)
+	if !errors.Is(err, auth.ErrInvalidWebhookSignature) {
+		t.Fatalf("Expected a changed body to be rejected, got %v", err)
+	}
+
+	err = auth.VerifyWebhookSignature([]string{"current"}, strconv.FormatInt(now.Unix()+1, 10), signature, body, 5*time.Minute, now)
+	if !errors.Is(err, auth.ErrInvalidWebhookSignature) {
+		t.Fatalf("Expected a changed timestamp to be rejected, got %v", err)
+	}
+
+	err = auth.VerifyWebhookSignature([]string{"other"}, timestamp, signature, body, 5*time.Minute, now)
+	if !errors.Is(err, auth.ErrInvalidWebhookSignature) {
+		t.Fatalf("Expected a signature from another secret to be rejected, got %v", err)
+	}
+
+	err = auth.VerifyWebhookSignature([]string{"current"}, timestamp, "", body, 5*time.Minute, now)
+	if !errors.Is(err, auth.ErrInvalidWebhookSignature) {
+		t.Fatalf("Expected a missing signature to be rejected, got %v", err)
+	}
+}
+
+func TestVerifyWebhookSignatureTolerance(t *testing.T) {
+	sentAt := time.Unix(1700000000, 0)
+	timestamp := strconv.FormatInt(sentAt.Unix(), 10)
+	body := []byte(`{}`)
+	signature := auth.SignWebhook("secret", sentAt, body)
+
+	err := auth.VerifyWebhookSignature([]string{"secret"}, timestamp, signature, body, 5*time.Minute, sentAt.Add(6*time.Minute))
+	if !errors.Is(err, auth.ErrWebhookTimestamp) {
+		t.Fatalf("Expected a replayed request to be rejected, got %v", err)
+	}
+
+	err = auth.VerifyWebhookSignature([]string{"secret"}, timestamp, signature, body, 5*time.Minute, sentAt.Add(-6*time.Minute))
+	if !errors.Is(err, auth.ErrWebhookTimestamp) {
+		t.Fatalf("Expected a request from the future to be rejected, got %v", err)
+	}
+}
+
+func TestVerifyWebhookSignatureDuringRotation(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	body := []byte(`{}`)
+
+	// The sender signs with both its old and new secret while we only know
+	// the old one, and the other way around.
+	signatures := auth.SignWebhook("old", now, body) + "," + auth.SignWebhook("new", now, body)
+	err := auth.VerifyWebhookSignature([]string{"old"}, timestamp, signatures, body, 5*time.Minute, now)
+	if err != nil {
+		t.Fatalf("Expected one matching signature to be enough, got %v", err)
+	}
+
+	err = auth.VerifyWebhookSignature([]string{"new", "old"}, timestamp, auth.SignWebhook("old", now, body), body, 5*time.Minute, now)
+	if err != nil {
+		t.Fatalf("Expected any active secret to be accepted, got %v", err)
+	}
+}
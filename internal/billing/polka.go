@@ -0,0 +1,121 @@
+package billing
+
+import (
+	"chirpy/internal/auth"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	PolkaTimestampHeader = "X-Polka-Timestamp"
+	PolkaSignatureHeader = "X-Polka-Signature"
+)
+
+// Ways Polka webhooks can authenticate, for Polka.AuthMode.
+const (
+	// PolkaAuthHMAC checks an HMAC-SHA256 signature over the body.
+	PolkaAuthHMAC = "hmac"
+	// PolkaAuthAPIKey checks the static APIKey in the Authorization header.
+	PolkaAuthAPIKey = "api_key"
+)
+
+// polkaEvents maps Polka's event names onto Event types.
+var polkaEvents = map[string]string{
+	"user.upgraded":         EventUpgraded,
+	"user.downgraded":       EventDowngraded,
+	"subscription.renewed":  EventRenewed,
+	"subscription.canceled": EventCanceled,
+	"payment.failed":        EventPaymentFailed,
+}
+
+type Polka struct {
+	// AuthMode is PolkaAuthHMAC or PolkaAuthAPIKey.
+	AuthMode string
+	APIKey   string
+	// Secrets are the secrets Polka may sign webhooks with. There is more
+	// than one while a secret is being rotated.
+	Secrets []string
+	// Tolerance is how far a signed webhook's timestamp may be from the
+	// current time.
+	Tolerance time.Duration
+}
+
+type polkaPayload struct {
+	ID    string `json:"id"`
+	Event string `json:"event"`
+	// OccurredAt orders events that arrive out of order.
+	OccurredAt *time.Time `json:"occurred_at"`
+	Data       struct {
+		UserID      string     `json:"user_id"`
+		Plan        string     `json:"plan"`
+		PeriodStart *time.Time `json:"period_start"`
+		PeriodEnd   *time.Time `json:"period_end"`
+	} `json:"data"`
+}
+
+func (p *Polka) Name() string {
+	return "polka"
+}
+
+func (p *Polka) Verify(header http.Header, body []byte, now time.Time) error {
+	if p.AuthMode == PolkaAuthAPIKey {
+		apiKey, err := auth.GetAPIKey(header)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrUnauthenticatedWebhook, err)
+		}
+
+		if p.APIKey == "" || subtle.ConstantTimeCompare([]byte(apiKey), []byte(p.APIKey)) != 1 {
+			return fmt.Errorf("%w: wrong API key", ErrUnauthenticatedWebhook)
+		}
+		return nil
+	}
+
+	err := auth.VerifyWebhookSignature(
+		p.Secrets,
+		header.Get(PolkaTimestampHeader),
+		header.Get(PolkaSignatureHeader),
+		body,
+		p.Tolerance,
+		now,
+	)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUnauthenticatedWebhook, err)
+	}
+	return nil
+}
+
+// DeliveryStamp returns the signed timestamp of a delivery. Deliveries
+// authenticated with the API key have nothing signed to return.
+func (p *Polka) DeliveryStamp(header http.Header) string {
+	if p.AuthMode == PolkaAuthAPIKey {
+		return ""
+	}
+	return header.Get(PolkaTimestampHeader)
+}
+
+func (p *Polka) Parse(body []byte) (Notification, error) {
+	var payload polkaPayload
+	err := json.Unmarshal(body, &payload)
+	if err != nil {
+		return Notification{}, err
+	}
+
+	notification := Notification{
+		ID:     payload.ID,
+		Type:   payload.Event,
+		UserID: payload.Data.UserID,
+		Event: Event{
+			Type:        polkaEvents[payload.Event],
+			Plan:        payload.Data.Plan,
+			PeriodStart: payload.Data.PeriodStart,
+			PeriodEnd:   payload.Data.PeriodEnd,
+		},
+	}
+	if payload.OccurredAt != nil {
+		notification.Event.OccurredAt = *payload.OccurredAt
+	}
+	return notification, nil
+}
@@ -0,0 +1,43 @@
+package billing
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+var ErrUnauthenticatedWebhook = errors.New("webhook is not from the provider")
+
+// Notification is a provider webhook after it has been verified and decoded.
+type Notification struct {
+	// ID identifies the event across redeliveries. It is empty when the
+	// provider did not send one.
+	ID string
+	// Type is the provider's own name for the event, kept for the event log.
+	Type string
+	// UserID is the Chirpy user the event is about, as the provider sent it.
+	UserID string
+	// Event is the subscription change. Its Type is one of the Event
+	// constants, or empty for events that do not change subscriptions, and
+	// OccurredAt is zero when the provider did not say when it happened.
+	Event Event
+}
+
+// Provider is a payment provider that sends subscription webhooks.
+type Provider interface {
+	// Name identifies the provider in URLs and in the webhook event log.
+	Name() string
+	// Verify checks that a webhook came from the provider. body is the exact
+	// request body, which signatures are computed over.
+	Verify(header http.Header, body []byte, now time.Time) error
+	// Parse decodes a verified webhook body. It is also used to replay
+	// events from the log, so it must not depend on the request.
+	Parse(body []byte) (Notification, error)
+}
+
+// DeliveryStamper is implemented by providers whose events may come without
+// an ID. DeliveryStamp returns a value the provider signed that is unique to
+// one delivery, or "" when the delivery carries none.
+type DeliveryStamper interface {
+	DeliveryStamp(header http.Header) string
+}
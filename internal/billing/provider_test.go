@@ -0,0 +1,204 @@
+package billing_test
+
+import (
+	"chirpy/internal/auth"
+	"chirpy/internal/billing"
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestPolkaVerifiesSignature(t *testing.T) {
+	polka := &billing.Polka{AuthMode: billing.PolkaAuthHMAC, Secrets: []string{"old", "new"}, Tolerance: 5 * time.Minute}
+	body := []byte(`{"event":"user.upgraded","data":{"user_id":"x"}}`)
+
+	header := http.Header{}
+	header.Set(billing.PolkaTimestampHeader, strconv.FormatInt(now.Unix(), 10))
+	header.Set(billing.PolkaSignatureHeader, auth.SignWebhook("new", now, body))
+
+	err := polka.Verify(header, body, now)
+	if err != nil {
+		t.Fatalf("Expected a valid signature, got %v", err)
+	}
+
+	err = polka.Verify(header, []byte(`{"event":"user.downgraded"}`), now)
+	if !errors.Is(err, billing.ErrUnauthenticatedWebhook) {
+		t.Fatalf("Expected a changed body to be rejected, got %v", err)
+	}
+}
+
+func TestPolkaVerifiesAPIKey(t *testing.T) {
+	polka := &billing.Polka{AuthMode: billing.PolkaAuthAPIKey, APIKey: "polka-key"}
+
+	header := http.Header{}
+	header.Set("Authorization", "ApiKey polka-key")
+	err := polka.Verify(header, nil, now)
+	if err != nil {
+		t.Fatalf("Expected the API key to be accepted, got %v", err)
+	}
+
+	header.Set("Authorization", "ApiKey other-key")
+	err = polka.Verify(header, nil, now)
+	if !errors.Is(err, billing.ErrUnauthenticatedWebhook) {
+		t.Fatalf("Expected a wrong API key to be rejected, got %v", err)
+	}
+}
+
+func TestPolkaParse(t *testing.T) {
+	polka := &billing.Polka{}
+
+	notification, err := polka.Parse([]byte(`{
+		"id": "evt_1",
+		"event": "subscription.canceled",
+		"occurred_at": "2026-03-15T12:00:00Z",
+		"data": {"user_id": "3311741c-680c-4546-99f3-fc9efac2036c", "plan": "chirpy_red_yearly"}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if notification.ID != "evt_1" || notification.Type != "subscription.canceled" || notification.UserID != "3311741c-680c-4546-99f3-fc9efac2036c" {
+		t.Fatalf("Unexpected notification %+v", notification)
+	}
+	if notification.Event.Type != billing.EventCanceled || notification.Event.Plan != "chirpy_red_yearly" || !notification.Event.OccurredAt.Equal(now) {
+		t.Fatalf("Unexpected event %+v", notification.Event)
+	}
+
+	notification, err = polka.Parse([]byte(`{"event":"user.created"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if notification.Event.Handles() {
+		t.Fatal("Expected an unknown event to be ignored")
+	}
+}
+
+func TestStripeVerifiesSignature(t *testing.T) {
+	stripe := &billing.Stripe{Secrets: []string{"whsec_test"}, Tolerance: 5 * time.Minute}
+	body := []byte(`{"id":"evt_1","type":"customer.subscription.deleted"}`)
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+
+	header := http.Header{}
+	header.Set(billing.StripeSignatureHeader, "t="+timestamp+",v1=00ff,"+auth.SignWebhook("whsec_test", now, body)+",v0=ignored")
+	err := stripe.Verify(header, body, now)
+	if err != nil {
+		t.Fatalf("Expected a valid signature, got %v", err)
+	}
+
+	err = stripe.Verify(header, body, now.Add(10*time.Minute))
+	if !errors.Is(err, billing.ErrUnauthenticatedWebhook) {
+		t.Fatalf("Expected a stale signature to be rejected, got %v", err)
+	}
+
+	header.Set(billing.StripeSignatureHeader, "t="+timestamp+","+auth.SignWebhook("other", now, body))
+	err = stripe.Verify(header, body, now)
+	if !errors.Is(err, billing.ErrUnauthenticatedWebhook) {
+		t.Fatalf("Expected a signature with another secret to be rejected, got %v", err)
+	}
+}
+
+func TestStripeParse(t *testing.T) {
+	stripe := &billing.Stripe{}
+
+	tests := []struct {
+		name      string
+		body      string
+		eventType string
+	}{
+		{
+			name:      "new subscription",
+			body:      `{"type":"customer.subscription.created","data":{"object":{"status":"active"}}}`,
+			eventType: billing.EventUpgraded,
+		},
+		{
+			name:      "incomplete subscription",
+			body:      `{"type":"customer.subscription.created","data":{"object":{"status":"incomplete"}}}`,
+			eventType: "",
+		},
+		{
+			name:      "renewal",
+			body:      `{"type":"customer.subscription.updated","data":{"object":{"status":"active"}}}`,
+			eventType: billing.EventRenewed,
+		},
+		{
+			name:      "cancellation",
+			body:      `{"type":"customer.subscription.updated","data":{"object":{"status":"active","cancel_at_period_end":true}}}`,
+			eventType: billing.EventCanceled,
+		},
+		{
+			name:      "past due",
+			body:      `{"type":"customer.subscription.updated","data":{"object":{"status":"past_due"}}}`,
+			eventType: billing.EventPaymentFailed,
+		},
+		{
+			name:      "deleted",
+			body:      `{"type":"customer.subscription.deleted","data":{"object":{"status":"canceled"}}}`,
+			eventType: billing.EventDowngraded,
+		},
+		{
+			name:      "failed invoice",
+			body:      `{"type":"invoice.payment_failed","data":{"object":{}}}`,
+			eventType: billing.EventPaymentFailed,
+		},
+		{
+			name:      "other event",
+			body:      `{"type":"customer.created","data":{"object":{}}}`,
+			eventType: "",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			notification, err := stripe.Parse([]byte(test.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if notification.Event.Type != test.eventType {
+				t.Fatalf("Expected %q, got %q", test.eventType, notification.Event.Type)
+			}
+		})
+	}
+}
+
+func TestStripeParseSubscription(t *testing.T) {
+	stripe := &billing.Stripe{}
+
+	notification, err := stripe.Parse([]byte(`{
+		"id": "evt_1",
+		"type": "customer.subscription.updated",
+		"created": ` + strconv.FormatInt(now.Unix(), 10) + `,
+		"data": {"object": {
+			"status": "active",
+			"current_period_start": ` + strconv.FormatInt(at(0).Unix(), 10) + `,
+			"current_period_end": ` + strconv.FormatInt(at(30).Unix(), 10) + `,
+			"metadata": {"user_id": "3311741c-680c-4546-99f3-fc9efac2036c", "plan": "chirpy_red_yearly"}
+		}}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if notification.ID != "evt_1" || notification.UserID != "3311741c-680c-4546-99f3-fc9efac2036c" {
+		t.Fatalf("Unexpected notification %+v", notification)
+	}
+	event := notification.Event
+	if !event.OccurredAt.Equal(now) || event.Plan != "chirpy_red_yearly" {
+		t.Fatalf("Unexpected event %+v", event)
+	}
+	if event.PeriodStart == nil || !event.PeriodStart.Equal(*at(0)) || event.PeriodEnd == nil || !event.PeriodEnd.Equal(*at(30)) {
+		t.Fatalf("Unexpected period %v - %v", event.PeriodStart, event.PeriodEnd)
+	}
+
+	notification, err = stripe.Parse([]byte(`{
+		"type": "invoice.payment_failed",
+		"data": {"object": {"subscription_details": {"metadata": {"user_id": "3311741c-680c-4546-99f3-fc9efac2036c"}}}}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if notification.UserID != "3311741c-680c-4546-99f3-fc9efac2036c" {
+		t.Fatalf("Expected the user from the invoice's subscription, got %q", notification.UserID)
+	}
+}
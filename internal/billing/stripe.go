@@ -0,0 +1,137 @@
+package billing
+
+import (
+	"chirpy/internal/auth"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// StripeSignatureHeader carries the timestamp and signatures together, as in
+// "t=1700000000,v1=<hex>,v1=<hex>". The signatures are the same HMAC-SHA256
+// of "<timestamp>.<body>" that Polka uses.
+const StripeSignatureHeader = "Stripe-Signature"
+
+// Stripe takes webhooks in Stripe's format from Stripe or any provider that
+// signs and shapes them the same way. Subscriptions are tied to Chirpy users
+// by a user_id in their metadata, which checkout has to set.
+type Stripe struct {
+	// Secrets are the endpoint secrets webhooks may be signed with.
+	Secrets   []string
+	Tolerance time.Duration
+}
+
+type stripePayload struct {
+	ID      string `json:"id"`
+	Type    string `json:"type"`
+	Created int64  `json:"created"`
+	Data    struct {
+		Object stripeObject `json:"object"`
+	} `json:"data"`
+}
+
+// stripeObject holds the fields used from both subscription and invoice
+// objects.
+type stripeObject struct {
+	Status             string            `json:"status"`
+	CancelAtPeriodEnd  bool              `json:"cancel_at_period_end"`
+	CurrentPeriodStart int64             `json:"current_period_start"`
+	CurrentPeriodEnd   int64             `json:"current_period_end"`
+	Metadata           map[string]string `json:"metadata"`
+	// SubscriptionDetails is set on invoices.
+	SubscriptionDetails *struct {
+		Metadata map[string]string `json:"metadata"`
+	} `json:"subscription_details"`
+}
+
+func (s *Stripe) Name() string {
+	return "stripe"
+}
+
+func (s *Stripe) Verify(header http.Header, body []byte, now time.Time) error {
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header.Get(StripeSignatureHeader), ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			if timestamp == "" {
+				timestamp = value
+			}
+		case "v1":
+			signatures = append(signatures, "v1="+value)
+		}
+	}
+
+	err := auth.VerifyWebhookSignature(s.Secrets, timestamp, strings.Join(signatures, ","), body, s.Tolerance, now)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUnauthenticatedWebhook, err)
+	}
+	return nil
+}
+
+func (s *Stripe) Parse(body []byte) (Notification, error) {
+	var payload stripePayload
+	err := json.Unmarshal(body, &payload)
+	if err != nil {
+		return Notification{}, err
+	}
+
+	object := payload.Data.Object
+	notification := Notification{
+		ID:     payload.ID,
+		Type:   payload.Type,
+		UserID: object.Metadata["user_id"],
+		Event: Event{
+			Type:        stripeEventType(payload.Type, object),
+			Plan:        object.Metadata["plan"],
+			PeriodStart: unixTime(object.CurrentPeriodStart),
+			PeriodEnd:   unixTime(object.CurrentPeriodEnd),
+		},
+	}
+	if object.SubscriptionDetails != nil && notification.UserID == "" {
+		notification.UserID = object.SubscriptionDetails.Metadata["user_id"]
+	}
+	if payload.Created != 0 {
+		notification.Event.OccurredAt = time.Unix(payload.Created, 0)
+	}
+	return notification, nil
+}
+
+// stripeEventType maps a Stripe event onto an Event type. Stripe reports most
+// changes as customer.subscription.updated, so the subscription's status
+// decides what happened.
+func stripeEventType(eventType string, object stripeObject) string {
+	switch eventType {
+	case "customer.subscription.created", "customer.subscription.updated":
+		switch object.Status {
+		case "active", "trialing":
+			if object.CancelAtPeriodEnd {
+				return EventCanceled
+			}
+			if eventType == "customer.subscription.created" {
+				return EventUpgraded
+			}
+			return EventRenewed
+		case "past_due", "unpaid":
+			return EventPaymentFailed
+		case "canceled", "incomplete_expired":
+			return EventDowngraded
+		}
+	case "customer.subscription.deleted":
+		return EventDowngraded
+	case "invoice.payment_failed":
+		return EventPaymentFailed
+	}
+	return ""
+}
+
+func unixTime(seconds int64) *time.Time {
+	if seconds == 0 {
+		return nil
+	}
+	t := time.Unix(seconds, 0)
+	return &t
+}
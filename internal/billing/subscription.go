@@ -0,0 +1,133 @@
+// Package billing models Chirpy Red subscriptions and the payment provider
+// events that move them between states.
+package billing
+
+import "time"
+
+// DefaultPlan is the plan for events that do not name one.
+const DefaultPlan = "chirpy_red"
+
+type Status string
+
+const (
+	StatusActive Status = "active"
+	// StatusPastDue keeps the subscription until the end of the period while
+	// the provider retries the payment.
+	StatusPastDue  Status = "past_due"
+	StatusCanceled Status = "canceled"
+	StatusExpired  Status = "expired"
+)
+
+// Event types. Providers map their own event names onto these.
+const (
+	EventUpgraded      = "upgraded"
+	EventDowngraded    = "downgraded"
+	EventRenewed       = "renewed"
+	EventCanceled      = "canceled"
+	EventPaymentFailed = "payment_failed"
+)
+
+// Event is something that happened to a user's subscription at the provider.
+// Period bounds are only set when the provider sent them.
+type Event struct {
+	Type        string
+	OccurredAt  time.Time
+	Plan        string
+	PeriodStart *time.Time
+	PeriodEnd   *time.Time
+}
+
+// Handles reports whether events of this type change subscriptions.
+func (e Event) Handles() bool {
+	switch e.Type {
+	case EventUpgraded, EventDowngraded, EventRenewed, EventCanceled, EventPaymentFailed:
+		return true
+	}
+	return false
+}
+
+type Subscription struct {
+	Plan              string
+	Status            Status
+	PeriodStart       *time.Time
+	PeriodEnd         *time.Time
+	CancelAtPeriodEnd bool
+	// LastEventAt is when the newest event applied so far happened.
+	LastEventAt time.Time
+}
+
+// Apply returns the subscription after event. current is nil for users who
+// never subscribed. ok is false when the event changes nothing: an unknown
+// type, or an event older than one already applied, which arrived late and
+// must not undo newer state.
+func Apply(current *Subscription, event Event, now time.Time) (Subscription, bool) {
+	if !event.Handles() {
+		return Subscription{}, false
+	}
+
+	var sub Subscription
+	if current != nil {
+		if event.OccurredAt.Before(current.LastEventAt) {
+			return *current, false
+		}
+		sub = *current
+	}
+
+	if event.Plan != "" {
+		sub.Plan = event.Plan
+	}
+	if sub.Plan == "" {
+		sub.Plan = DefaultPlan
+	}
+	if event.PeriodStart != nil {
+		sub.PeriodStart = event.PeriodStart
+	}
+	if event.PeriodEnd != nil {
+		sub.PeriodEnd = event.PeriodEnd
+	}
+	sub.LastEventAt = event.OccurredAt
+
+	switch event.Type {
+	case EventUpgraded, EventRenewed:
+		sub.Status = StatusActive
+		sub.CancelAtPeriodEnd = false
+		// Without a period, as Polka sends them, the subscription is
+		// open-ended. Keeping the period of one that lapsed would expire it
+		// again right away.
+		if event.PeriodStart == nil && event.PeriodEnd == nil {
+			sub.PeriodStart = nil
+			sub.PeriodEnd = nil
+		}
+
+	case EventCanceled:
+		// Whatever was paid for runs until the end of the period; the expiry
+		// job takes it from there.
+		sub.CancelAtPeriodEnd = true
+		if sub.Status == "" || sub.PeriodEnd == nil || !now.Before(*sub.PeriodEnd) {
+			sub.Status = StatusCanceled
+		}
+
+	case EventPaymentFailed:
+		switch sub.Status {
+		case StatusActive:
+			sub.Status = StatusPastDue
+		case "":
+			// The first payment failed: there never was a subscription.
+			sub.Status = StatusExpired
+		}
+
+	case EventDowngraded:
+		sub.Status = StatusExpired
+		sub.CancelAtPeriodEnd = false
+	}
+
+	return sub, true
+}
+
+// Entitled reports whether the subscription grants Chirpy Red at now.
+func (s Subscription) Entitled(now time.Time) bool {
+	if s.Status != StatusActive && s.Status != StatusPastDue {
+		return false
+	}
+	return s.PeriodEnd == nil || now.Before(*s.PeriodEnd)
+}
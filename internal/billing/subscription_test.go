@@ -0,0 +1,126 @@
+package billing_test
+
+import (
+	"chirpy/internal/billing"
+	"testing"
+	"time"
+)
+
+var now = time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC)
+
+func at(days int) *time.Time {
+	t := now.AddDate(0, 0, days)
+	return &t
+}
+
+func apply(t *testing.T, current *billing.Subscription, event billing.Event) billing.Subscription {
+	t.Helper()
+
+	sub, ok := billing.Apply(current, event, now)
+	if !ok {
+		t.Fatalf("Expected %s to be applied", event.Type)
+	}
+	return sub
+}
+
+func TestUpgradeStartsSubscription(t *testing.T) {
+	sub := apply(t, nil, billing.Event{
+		Type:        billing.EventUpgraded,
+		OccurredAt:  now,
+		PeriodStart: at(0),
+		PeriodEnd:   at(30),
+	})
+
+	if sub.Status != billing.StatusActive || sub.Plan != billing.DefaultPlan {
+		t.Fatalf("Unexpected subscription %+v", sub)
+	}
+	if !sub.Entitled(now) {
+		t.Fatal("Expected an active subscription to grant Chirpy Red")
+	}
+	if sub.Entitled(now.AddDate(0, 0, 30)) {
+		t.Fatal("Expected the subscription to lapse at the end of the period")
+	}
+}
+
+func TestUpgradeWithoutPeriodAfterLapse(t *testing.T) {
+	sub := apply(t, nil, billing.Event{Type: billing.EventUpgraded, OccurredAt: now.AddDate(0, 0, -60), PeriodEnd: at(-30)})
+	if sub.Entitled(now) {
+		t.Fatal("Expected the subscription to have lapsed")
+	}
+
+	sub = apply(t, &sub, billing.Event{Type: billing.EventUpgraded, OccurredAt: now})
+	if sub.Status != billing.StatusActive || sub.PeriodStart != nil || sub.PeriodEnd != nil {
+		t.Fatalf("Expected an open-ended active subscription, got %+v", sub)
+	}
+	if !sub.Entitled(now.AddDate(1, 0, 0)) {
+		t.Fatal("Expected an upgrade without a period to grant Chirpy Red until it is downgraded")
+	}
+}
+
+func TestCancelKeepsSubscriptionUntilPeriodEnd(t *testing.T) {
+	sub := apply(t, nil, billing.Event{Type: billing.EventUpgraded, OccurredAt: now.AddDate(0, 0, -1), PeriodEnd: at(29)})
+	sub = apply(t, &sub, billing.Event{Type: billing.EventCanceled, OccurredAt: now})
+
+	if !sub.CancelAtPeriodEnd || sub.Status != billing.StatusActive {
+		t.Fatalf("Expected the subscription to stay active until the period ends, got %+v", sub)
+	}
+	if !sub.Entitled(now) {
+		t.Fatal("Expected a canceled subscription to keep Chirpy Red for the paid period")
+	}
+
+	sub = apply(t, &sub, billing.Event{Type: billing.EventRenewed, OccurredAt: now.Add(time.Hour), PeriodEnd: at(59)})
+	if sub.CancelAtPeriodEnd {
+		t.Fatal("Expected a renewal to undo the cancellation")
+	}
+}
+
+func TestCancelWithoutPaidPeriodEndsSubscription(t *testing.T) {
+	sub := apply(t, nil, billing.Event{Type: billing.EventUpgraded, OccurredAt: now.AddDate(0, 0, -1)})
+	sub = apply(t, &sub, billing.Event{Type: billing.EventCanceled, OccurredAt: now})
+
+	if sub.Status != billing.StatusCanceled || sub.Entitled(now) {
+		t.Fatalf("Expected a subscription without a period to end on cancellation, got %+v", sub)
+	}
+}
+
+func TestPaymentFailedAndDowngrade(t *testing.T) {
+	sub := apply(t, nil, billing.Event{Type: billing.EventUpgraded, OccurredAt: now.AddDate(0, 0, -2), PeriodEnd: at(3)})
+	sub = apply(t, &sub, billing.Event{Type: billing.EventPaymentFailed, OccurredAt: now.AddDate(0, 0, -1)})
+
+	if sub.Status != billing.StatusPastDue || !sub.Entitled(now) {
+		t.Fatalf("Expected a past due subscription to keep Chirpy Red for now, got %+v", sub)
+	}
+
+	sub = apply(t, &sub, billing.Event{Type: billing.EventDowngraded, OccurredAt: now})
+	if sub.Status != billing.StatusExpired || sub.Entitled(now) {
+		t.Fatalf("Expected a downgrade to end the subscription, got %+v", sub)
+	}
+}
+
+func TestFirstPaymentFailedIsNotASubscription(t *testing.T) {
+	sub := apply(t, nil, billing.Event{Type: billing.EventPaymentFailed, OccurredAt: now})
+	if sub.Entitled(now) {
+		t.Fatalf("Expected no Chirpy Red without a successful payment, got %+v", sub)
+	}
+}
+
+func TestOutOfOrderEventsAreIgnored(t *testing.T) {
+	sub := apply(t, nil, billing.Event{Type: billing.EventUpgraded, OccurredAt: now.AddDate(0, 0, -2)})
+	sub = apply(t, &sub, billing.Event{Type: billing.EventDowngraded, OccurredAt: now})
+
+	// The renewal happened before the downgrade but was delivered after it.
+	late, ok := billing.Apply(&sub, billing.Event{Type: billing.EventRenewed, OccurredAt: now.AddDate(0, 0, -1)}, now)
+	if ok {
+		t.Fatal("Expected a late event to be ignored")
+	}
+	if late.Status != billing.StatusExpired {
+		t.Fatalf("Expected the newer state to stand, got %+v", late)
+	}
+}
+
+func TestUnknownEventsAreIgnored(t *testing.T) {
+	_, ok := billing.Apply(nil, billing.Event{Type: "user.renamed", OccurredAt: now}, now)
+	if ok {
+		t.Fatal("Expected an unknown event to be ignored")
+	}
+}
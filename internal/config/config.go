@@ -1,6 +1,54 @@
 package config
 
+import (
+	"chirpy/internal/auth"
+	"chirpy/internal/billing"
+	"slices"
+	"time"
+
+	"github.com/alexedwards/argon2id"
+)
+
+// Actions that can be listed in APIConfig.UnverifiedRestrictions.
+const (
+	ActionPostChirps = "chirps:write"
+)
+
 type APIConfig struct {
 	JWTSecret string
-	PolkaKey  string
+	// BillingProviders are the payment providers webhooks are accepted from,
+	// by name.
+	BillingProviders map[string]billing.Provider
+	// MetricsToken, when set, is the bearer token scrapers must send to
+	// GET /metrics.
+	MetricsToken string
+	// WebhookAllowPrivateNetworks lets outbound webhooks reach loopback and
+	// private addresses. Only for local development.
+	WebhookAllowPrivateNetworks bool
+	// BaseURL is the public URL of the server, used to build links in emails.
+	BaseURL string
+	// UnverifiedRestrictions lists the actions accounts without a verified
+	// email address are not allowed to take.
+	UnverifiedRestrictions []string
+	// AccountLoginThrottle limits failed logins per email address,
+	// IPLoginThrottle per client IP.
+	AccountLoginThrottle auth.LoginThrottle
+	IPLoginThrottle      auth.LoginThrottle
+	// TrustProxyHeaders makes the client IP come from X-Forwarded-For. Only
+	// enable it behind a proxy that sets the header.
+	TrustProxyHeaders bool
+	// PasskeyRateLimit is how many passkey ceremonies one client IP may
+	// begin per minute, for logins and registrations each.
+	PasskeyRateLimit int
+	// PasswordParams are used for new hashes. Older hashes are upgraded to
+	// them the next time their owner logs in.
+	PasswordParams *argon2id.Params
+	PasswordPolicy auth.PasswordPolicy
+	// AccountDeletionGracePeriod is how long a deleted account can still be
+	// restored by logging in.
+	AccountDeletionGracePeriod time.Duration
+}
+
+func (c *APIConfig) RestrictsUnverified(action string) bool {
+	return slices.Contains(c.UnverifiedRestrictions, action)
 }
@@ -0,0 +1,74 @@
+package config
+
+import (
+	"chirpy/internal/auth"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/alexedwards/argon2id"
+)
+
+// PasswordParamsFromEnv reads the argon2id parameters for new password
+// hashes from ARGON2_MEMORY, ARGON2_ITERATIONS and ARGON2_PARALLELISM.
+func PasswordParamsFromEnv() (*argon2id.Params, error) {
+	memory, err := envInt("ARGON2_MEMORY", 64*1024)
+	if err != nil {
+		return nil, err
+	}
+	iterations, err := envInt("ARGON2_ITERATIONS", 1)
+	if err != nil {
+		return nil, err
+	}
+	parallelism, err := envInt("ARGON2_PARALLELISM", 2)
+	if err != nil {
+		return nil, err
+	}
+
+	return &argon2id.Params{
+		Memory:      uint32(memory),
+		Iterations:  uint32(iterations),
+		Parallelism: uint8(parallelism),
+		SaltLength:  16,
+		KeyLength:   32,
+	}, nil
+}
+
+// PasswordPolicyFromEnv reads the password policy from PASSWORD_MIN_LENGTH
+// and PASSWORD_HISTORY. Passwords are checked against the built-in list of
+// common ones, or the list in BANNED_PASSWORDS_FILE when it is set.
+func PasswordPolicyFromEnv() (auth.PasswordPolicy, error) {
+	var policy auth.PasswordPolicy
+	var err error
+
+	policy.MinLength, err = envInt("PASSWORD_MIN_LENGTH", 8)
+	if err != nil {
+		return policy, err
+	}
+	policy.HistorySize, err = envInt("PASSWORD_HISTORY", 5)
+	if err != nil {
+		return policy, err
+	}
+	policy.Banned = auth.DefaultBannedPasswords()
+	if bannedPasswordsFile := os.Getenv("BANNED_PASSWORDS_FILE"); bannedPasswordsFile != "" {
+		policy.Banned, err = auth.LoadBannedPasswords(bannedPasswordsFile)
+		if err != nil {
+			return policy, err
+		}
+	}
+
+	return policy, nil
+}
+
+func envInt(name string, fallback int) (int, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback, nil
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return parsed, nil
+}
@@ -9,6 +9,7 @@ import (
 	"context"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 const createChirp = `-- name: CreateChirp :one
@@ -16,7 +17,7 @@ INSERT INTO chirps (id, created_at, updated_at, body, user_id)
 VALUES (
   gen_random_uuid(), NOW(), NOW(), $1, $2
 )
-RETURNING id, created_at, updated_at, body, user_id
+RETURNING id, created_at, updated_at, body, user_id, imported_created_at
 `
 
 type CreateChirpParams struct {
@@ -33,6 +34,7 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.ImportedCreatedAt,
 	)
 	return i, err
 }
@@ -52,7 +54,7 @@ func (q *Queries) DeleteChirp(ctx context.Context, arg DeleteChirpParams) error
 }
 
 const getChirp = `-- name: GetChirp :one
-SELECT id, created_at, updated_at, body, user_id FROM chirps
+SELECT id, created_at, updated_at, body, user_id, imported_created_at FROM chirps
 WHERE id = $1
 `
 
@@ -65,12 +67,60 @@ func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.ImportedCreatedAt,
 	)
 	return i, err
 }
 
+const importChirps = `-- name: ImportChirps :many
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, imported_created_at)
+SELECT gen_random_uuid(), NOW(), NOW(), i.body, $1, NULLIF(i.imported_created_at, '')::TIMESTAMP
+FROM (
+  SELECT unnest($2::TEXT[]) AS body, unnest($3::TEXT[]) AS imported_created_at
+) AS i
+RETURNING id, created_at, updated_at, body, user_id, imported_created_at
+`
+
+type ImportChirpsParams struct {
+	UserID            uuid.UUID `json:"user_id"`
+	Bodies            []string  `json:"bodies"`
+	ImportedCreatedAt []string  `json:"imported_created_at"`
+}
+
+// Inserts a batch of chirps. imported_created_at holds timestamps formatted
+// for Postgres, with an empty string for chirps that have none.
+func (q *Queries) ImportChirps(ctx context.Context, arg ImportChirpsParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, importChirps, arg.UserID, pq.Array(arg.Bodies), pq.Array(arg.ImportedCreatedAt))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.ImportedCreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listChirps = `-- name: ListChirps :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps
+SELECT id, created_at, updated_at, body, user_id, imported_created_at FROM chirps
 ORDER BY 
   CASE WHEN $1 = 'desc' THEN created_at END DESC,
   CASE WHEN $1 = 'asc' THEN created_at END ASC
@@ -91,6 +141,7 @@ func (q *Queries) ListChirps(ctx context.Context, sortOrder interface{}) ([]Chir
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.ImportedCreatedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -106,7 +157,7 @@ func (q *Queries) ListChirps(ctx context.Context, sortOrder interface{}) ([]Chir
 }
 
 const listChirpsByAuthorID = `-- name: ListChirpsByAuthorID :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps
+SELECT id, created_at, updated_at, body, user_id, imported_created_at FROM chirps
 WHERE user_id = $1
 ORDER BY
   CASE WHEN $2 = 'desc' THEN created_at END DESC,
@@ -133,6 +184,7 @@ func (q *Queries) ListChirpsByAuthorID(ctx context.Context, arg ListChirpsByAuth
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.ImportedCreatedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -146,3 +198,22 @@ func (q *Queries) ListChirpsByAuthorID(ctx context.Context, arg ListChirpsByAuth
 	}
 	return items, nil
 }
+
+const moderateDeleteChirp = `-- name: ModerateDeleteChirp :one
+DELETE FROM chirps WHERE id = $1
+RETURNING id, created_at, updated_at, body, user_id, imported_created_at
+`
+
+func (q *Queries) ModerateDeleteChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, moderateDeleteChirp, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.ImportedCreatedAt,
+	)
+	return i, err
+}
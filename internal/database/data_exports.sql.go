@@ -0,0 +1,175 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: data_exports.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const claimPendingDataExport = `-- name: ClaimPendingDataExport :one
+UPDATE data_exports
+SET started_at = NOW()
+WHERE id = (
+  SELECT pending.id FROM data_exports AS pending
+  WHERE pending.status = 'pending'
+  AND (pending.started_at IS NULL OR pending.started_at < NOW() - $1::INTEGER * INTERVAL '1 second')
+  ORDER BY pending.created_at
+  LIMIT 1
+  FOR UPDATE SKIP LOCKED
+)
+RETURNING id, user_id
+`
+
+type ClaimPendingDataExportRow struct {
+	ID     uuid.UUID `json:"id"`
+	UserID uuid.UUID `json:"user_id"`
+}
+
+// Leases the oldest pending export that no worker is building, or whose
+// worker stopped before finishing, so each export is built by one worker.
+func (q *Queries) ClaimPendingDataExport(ctx context.Context, leaseSeconds int32) (ClaimPendingDataExportRow, error) {
+	row := q.db.QueryRowContext(ctx, claimPendingDataExport, leaseSeconds)
+	var i ClaimPendingDataExportRow
+	err := row.Scan(&i.ID, &i.UserID)
+	return i, err
+}
+
+const completeDataExport = `-- name: CompleteDataExport :exec
+UPDATE data_exports
+SET status = 'ready', archive = $2, completed_at = NOW()
+WHERE id = $1
+`
+
+type CompleteDataExportParams struct {
+	ID      uuid.UUID `json:"id"`
+	Archive []byte    `json:"archive"`
+}
+
+func (q *Queries) CompleteDataExport(ctx context.Context, arg CompleteDataExportParams) error {
+	_, err := q.db.ExecContext(ctx, completeDataExport, arg.ID, arg.Archive)
+	return err
+}
+
+const countPendingDataExports = `-- name: CountPendingDataExports :one
+SELECT COUNT(*) FROM data_exports
+WHERE user_id = $1 AND status = 'pending'
+`
+
+func (q *Queries) CountPendingDataExports(ctx context.Context, userID uuid.UUID) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countPendingDataExports, userID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const createDataExport = `-- name: CreateDataExport :one
+INSERT INTO data_exports (id, user_id, status, created_at, expires_at)
+VALUES (
+  gen_random_uuid(), $1, 'pending', NOW(), $2
+)
+RETURNING id, user_id, status, created_at, completed_at, expires_at
+`
+
+type CreateDataExportParams struct {
+	UserID    uuid.UUID `json:"user_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type CreateDataExportRow struct {
+	ID          uuid.UUID    `json:"id"`
+	UserID      uuid.UUID    `json:"user_id"`
+	Status      string       `json:"status"`
+	CreatedAt   time.Time    `json:"created_at"`
+	CompletedAt sql.NullTime `json:"completed_at"`
+	ExpiresAt   time.Time    `json:"expires_at"`
+}
+
+func (q *Queries) CreateDataExport(ctx context.Context, arg CreateDataExportParams) (CreateDataExportRow, error) {
+	row := q.db.QueryRowContext(ctx, createDataExport, arg.UserID, arg.ExpiresAt)
+	var i CreateDataExportRow
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Status,
+		&i.CreatedAt,
+		&i.CompletedAt,
+		&i.ExpiresAt,
+	)
+	return i, err
+}
+
+const deleteExpiredDataExports = `-- name: DeleteExpiredDataExports :execrows
+DELETE FROM data_exports
+WHERE expires_at <= NOW()
+`
+
+func (q *Queries) DeleteExpiredDataExports(ctx context.Context) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteExpiredDataExports)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const failDataExport = `-- name: FailDataExport :exec
+UPDATE data_exports
+SET status = 'failed', completed_at = NOW()
+WHERE id = $1
+`
+
+func (q *Queries) FailDataExport(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, failDataExport, id)
+	return err
+}
+
+const getDataExport = `-- name: GetDataExport :one
+SELECT id, user_id, status, created_at, completed_at, expires_at FROM data_exports
+WHERE id = $1 AND user_id = $2 AND expires_at > NOW()
+`
+
+type GetDataExportParams struct {
+	ID     uuid.UUID `json:"id"`
+	UserID uuid.UUID `json:"user_id"`
+}
+
+type GetDataExportRow struct {
+	ID          uuid.UUID    `json:"id"`
+	UserID      uuid.UUID    `json:"user_id"`
+	Status      string       `json:"status"`
+	CreatedAt   time.Time    `json:"created_at"`
+	CompletedAt sql.NullTime `json:"completed_at"`
+	ExpiresAt   time.Time    `json:"expires_at"`
+}
+
+func (q *Queries) GetDataExport(ctx context.Context, arg GetDataExportParams) (GetDataExportRow, error) {
+	row := q.db.QueryRowContext(ctx, getDataExport, arg.ID, arg.UserID)
+	var i GetDataExportRow
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Status,
+		&i.CreatedAt,
+		&i.CompletedAt,
+		&i.ExpiresAt,
+	)
+	return i, err
+}
+
+const getDataExportArchive = `-- name: GetDataExportArchive :one
+SELECT archive FROM data_exports
+WHERE id = $1 AND status = 'ready' AND expires_at > NOW()
+`
+
+func (q *Queries) GetDataExportArchive(ctx context.Context, id uuid.UUID) ([]byte, error) {
+	row := q.db.QueryRowContext(ctx, getDataExportArchive, id)
+	var archive []byte
+	err := row.Scan(&archive)
+	return archive, err
+}
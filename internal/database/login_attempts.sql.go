@@ -0,0 +1,108 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: login_attempts.sql
+
+package database
+
+import (
+	"context"
+	"time"
+)
+
+const deleteLoginAttemptsBefore = `-- name: DeleteLoginAttemptsBefore :execrows
+DELETE FROM login_attempts
+WHERE created_at < $1
+`
+
+// Attempts older than every throttle window are never counted again.
+func (q *Queries) DeleteLoginAttemptsBefore(ctx context.Context, createdAt time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteLoginAttemptsBefore, createdAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteLoginAttemptsByEmail = `-- name: DeleteLoginAttemptsByEmail :exec
+DELETE FROM login_attempts
+WHERE email = $1
+`
+
+func (q *Queries) DeleteLoginAttemptsByEmail(ctx context.Context, email string) error {
+	_, err := q.db.ExecContext(ctx, deleteLoginAttemptsByEmail, email)
+	return err
+}
+
+const getLoginFailuresByEmail = `-- name: GetLoginFailuresByEmail :one
+SELECT COUNT(*) AS failures, COALESCE(MAX(f.created_at), 'epoch')::timestamp AS last_failure
+FROM login_attempts f
+WHERE f.email = $1
+AND NOT f.succeeded
+AND f.created_at > $2
+AND f.created_at > COALESCE(
+  (SELECT MAX(s.created_at) FROM login_attempts s WHERE s.email = $1 AND s.succeeded),
+  'epoch'
+)
+`
+
+type GetLoginFailuresByEmailParams struct {
+	Email string    `json:"email"`
+	Since time.Time `json:"since"`
+}
+
+type GetLoginFailuresByEmailRow struct {
+	Failures    int64     `json:"failures"`
+	LastFailure time.Time `json:"last_failure"`
+}
+
+// Failures since the account's last successful login, within the window.
+func (q *Queries) GetLoginFailuresByEmail(ctx context.Context, arg GetLoginFailuresByEmailParams) (GetLoginFailuresByEmailRow, error) {
+	row := q.db.QueryRowContext(ctx, getLoginFailuresByEmail, arg.Email, arg.Since)
+	var i GetLoginFailuresByEmailRow
+	err := row.Scan(&i.Failures, &i.LastFailure)
+	return i, err
+}
+
+const getLoginFailuresByIP = `-- name: GetLoginFailuresByIP :one
+SELECT COUNT(*) AS failures, COALESCE(MAX(created_at), 'epoch')::timestamp AS last_failure
+FROM login_attempts
+WHERE ip_address = $1
+AND NOT succeeded
+AND created_at > $2
+`
+
+type GetLoginFailuresByIPParams struct {
+	IpAddress string    `json:"ip_address"`
+	Since     time.Time `json:"since"`
+}
+
+type GetLoginFailuresByIPRow struct {
+	Failures    int64     `json:"failures"`
+	LastFailure time.Time `json:"last_failure"`
+}
+
+func (q *Queries) GetLoginFailuresByIP(ctx context.Context, arg GetLoginFailuresByIPParams) (GetLoginFailuresByIPRow, error) {
+	row := q.db.QueryRowContext(ctx, getLoginFailuresByIP, arg.IpAddress, arg.Since)
+	var i GetLoginFailuresByIPRow
+	err := row.Scan(&i.Failures, &i.LastFailure)
+	return i, err
+}
+
+const recordLoginAttempt = `-- name: RecordLoginAttempt :exec
+INSERT INTO login_attempts (id, email, ip_address, succeeded, created_at)
+VALUES (
+  gen_random_uuid(), $1, $2, $3, NOW()
+)
+`
+
+type RecordLoginAttemptParams struct {
+	Email     string `json:"email"`
+	IpAddress string `json:"ip_address"`
+	Succeeded bool   `json:"succeeded"`
+}
+
+func (q *Queries) RecordLoginAttempt(ctx context.Context, arg RecordLoginAttemptParams) error {
+	_, err := q.db.ExecContext(ctx, recordLoginAttempt, arg.Email, arg.IpAddress, arg.Succeeded)
+	return err
+}
@@ -0,0 +1,45 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: magic_link.sql
+
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const consumeMagicLinkToken = `-- name: ConsumeMagicLinkToken :one
+UPDATE magic_link_tokens
+SET used_at = NOW()
+WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+RETURNING user_id
+`
+
+func (q *Queries) ConsumeMagicLinkToken(ctx context.Context, tokenHash string) (uuid.UUID, error) {
+	row := q.db.QueryRowContext(ctx, consumeMagicLinkToken, tokenHash)
+	var user_id uuid.UUID
+	err := row.Scan(&user_id)
+	return user_id, err
+}
+
+const createMagicLinkToken = `-- name: CreateMagicLinkToken :exec
+INSERT INTO magic_link_tokens (token_hash, user_id, created_at, expires_at)
+VALUES (
+  $1, $2, NOW(), $3
+)
+`
+
+type CreateMagicLinkTokenParams struct {
+	TokenHash string    `json:"token_hash"`
+	UserID    uuid.UUID `json:"user_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (q *Queries) CreateMagicLinkToken(ctx context.Context, arg CreateMagicLinkTokenParams) error {
+	_, err := q.db.ExecContext(ctx, createMagicLinkToken, arg.TokenHash, arg.UserID, arg.ExpiresAt)
+	return err
+}
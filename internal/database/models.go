@@ -6,33 +6,226 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+type ApiKey struct {
+	ID         uuid.UUID    `json:"id"`
+	UserID     uuid.UUID    `json:"user_id"`
+	Name       string       `json:"name"`
+	Prefix     string       `json:"prefix"`
+	KeyHash    string       `json:"key_hash"`
+	Scopes     []string     `json:"scopes"`
+	ExpiresAt  sql.NullTime `json:"expires_at"`
+	LastUsedAt sql.NullTime `json:"last_used_at"`
+	RevokedAt  sql.NullTime `json:"revoked_at"`
+	CreatedAt  time.Time    `json:"created_at"`
+	UpdatedAt  time.Time    `json:"updated_at"`
+}
+
 type Chirp struct {
+	ID                uuid.UUID  `json:"id"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+	Body              string     `json:"body"`
+	UserID            uuid.UUID  `json:"user_id"`
+	ImportedCreatedAt *time.Time `json:"imported_created_at"`
+}
+
+type DataExport struct {
+	ID          uuid.UUID    `json:"id"`
+	UserID      uuid.UUID    `json:"user_id"`
+	Status      string       `json:"status"`
+	Archive     []byte       `json:"archive"`
+	CreatedAt   time.Time    `json:"created_at"`
+	CompletedAt sql.NullTime `json:"completed_at"`
+	ExpiresAt   time.Time    `json:"expires_at"`
+	StartedAt   sql.NullTime `json:"started_at"`
+}
+
+type EmailVerificationToken struct {
+	TokenHash string       `json:"token_hash"`
+	UserID    uuid.UUID    `json:"user_id"`
+	Email     string       `json:"email"`
+	CreatedAt time.Time    `json:"created_at"`
+	ExpiresAt time.Time    `json:"expires_at"`
+	UsedAt    sql.NullTime `json:"used_at"`
+}
+
+type LoginAttempt struct {
 	ID        uuid.UUID `json:"id"`
+	Email     string    `json:"email"`
+	IpAddress string    `json:"ip_address"`
+	Succeeded bool      `json:"succeeded"`
 	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Body      string    `json:"body"`
-	UserID    uuid.UUID `json:"user_id"`
 }
 
-type RefreshToken struct {
-	Token     string       `json:"token"`
-	CreatedAt time.Time    `json:"created_at"`
-	UpdatedAt time.Time    `json:"updated_at"`
+type MagicLinkToken struct {
+	TokenHash string       `json:"token_hash"`
 	UserID    uuid.UUID    `json:"user_id"`
+	CreatedAt time.Time    `json:"created_at"`
 	ExpiresAt time.Time    `json:"expires_at"`
-	RevokedAt sql.NullTime `json:"revoked_at"`
+	UsedAt    sql.NullTime `json:"used_at"`
 }
 
-type User struct {
+type OauthAuthorizationCode struct {
+	CodeHash      string       `json:"code_hash"`
+	ClientID      uuid.UUID    `json:"client_id"`
+	UserID        uuid.UUID    `json:"user_id"`
+	RedirectUri   string       `json:"redirect_uri"`
+	Scopes        []string     `json:"scopes"`
+	CodeChallenge string       `json:"code_challenge"`
+	CreatedAt     time.Time    `json:"created_at"`
+	ExpiresAt     time.Time    `json:"expires_at"`
+	UsedAt        sql.NullTime `json:"used_at"`
+}
+
+type OauthClient struct {
+	ID               uuid.UUID      `json:"id"`
+	OwnerID          uuid.UUID      `json:"owner_id"`
+	Name             string         `json:"name"`
+	ClientSecretHash sql.NullString `json:"client_secret_hash"`
+	RedirectUris     []string       `json:"redirect_uris"`
+	Scopes           []string       `json:"scopes"`
+	CreatedAt        time.Time      `json:"created_at"`
+	UpdatedAt        time.Time      `json:"updated_at"`
+}
+
+type PasswordHistory struct {
 	ID             uuid.UUID `json:"id"`
-	Email          string    `json:"email"`
-	CreatedAt      time.Time `json:"created_at"`
-	UpdatedAt      time.Time `json:"updated_at"`
+	UserID         uuid.UUID `json:"user_id"`
 	HashedPassword string    `json:"hashed_password"`
-	IsChirpyRed    bool      `json:"is_chirpy_red"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+type PasswordResetToken struct {
+	TokenHash string       `json:"token_hash"`
+	UserID    uuid.UUID    `json:"user_id"`
+	CreatedAt time.Time    `json:"created_at"`
+	ExpiresAt time.Time    `json:"expires_at"`
+	UsedAt    sql.NullTime `json:"used_at"`
+}
+
+type RecoveryCode struct {
+	ID         uuid.UUID    `json:"id"`
+	UserID     uuid.UUID    `json:"user_id"`
+	HashedCode string       `json:"hashed_code"`
+	UsedAt     sql.NullTime `json:"used_at"`
+	CreatedAt  time.Time    `json:"created_at"`
+}
+
+type RefreshToken struct {
+	Token     string        `json:"token"`
+	CreatedAt time.Time     `json:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at"`
+	UserID    uuid.UUID     `json:"user_id"`
+	ExpiresAt time.Time     `json:"expires_at"`
+	RevokedAt sql.NullTime  `json:"revoked_at"`
+	SessionID uuid.UUID     `json:"session_id"`
+	ClientID  uuid.NullUUID `json:"client_id"`
+	Scopes    []string      `json:"scopes"`
+}
+
+type Subscription struct {
+	UserID             uuid.UUID    `json:"user_id"`
+	Provider           string       `json:"provider"`
+	Plan               string       `json:"plan"`
+	Status             string       `json:"status"`
+	CurrentPeriodStart sql.NullTime `json:"current_period_start"`
+	CurrentPeriodEnd   sql.NullTime `json:"current_period_end"`
+	CancelAtPeriodEnd  bool         `json:"cancel_at_period_end"`
+	LastEventAt        time.Time    `json:"last_event_at"`
+	CreatedAt          time.Time    `json:"created_at"`
+	UpdatedAt          time.Time    `json:"updated_at"`
+}
+
+type User struct {
+	ID              uuid.UUID    `json:"id"`
+	Email           string       `json:"email"`
+	CreatedAt       time.Time    `json:"created_at"`
+	UpdatedAt       time.Time    `json:"updated_at"`
+	HashedPassword  string       `json:"hashed_password"`
+	IsChirpyRed     bool         `json:"is_chirpy_red"`
+	Role            string       `json:"role"`
+	EmailVerifiedAt sql.NullTime `json:"email_verified_at"`
+	DeleteAfter     sql.NullTime `json:"delete_after"`
+}
+
+type UserTotp struct {
+	UserID       uuid.UUID    `json:"user_id"`
+	Secret       string       `json:"secret"`
+	ConfirmedAt  sql.NullTime `json:"confirmed_at"`
+	LastUsedStep int64        `json:"last_used_step"`
+	CreatedAt    time.Time    `json:"created_at"`
+	UpdatedAt    time.Time    `json:"updated_at"`
+}
+
+type WebauthnCredential struct {
+	ID              uuid.UUID    `json:"id"`
+	UserID          uuid.UUID    `json:"user_id"`
+	Name            string       `json:"name"`
+	CredentialID    []byte       `json:"credential_id"`
+	PublicKey       []byte       `json:"public_key"`
+	AttestationType string       `json:"attestation_type"`
+	Aaguid          []byte       `json:"aaguid"`
+	SignCount       int64        `json:"sign_count"`
+	Transports      []string     `json:"transports"`
+	BackupEligible  bool         `json:"backup_eligible"`
+	BackupState     bool         `json:"backup_state"`
+	CreatedAt       time.Time    `json:"created_at"`
+	UpdatedAt       time.Time    `json:"updated_at"`
+	LastUsedAt      sql.NullTime `json:"last_used_at"`
+}
+
+type WebauthnSession struct {
+	ID        uuid.UUID       `json:"id"`
+	UserID    uuid.NullUUID   `json:"user_id"`
+	Ceremony  string          `json:"ceremony"`
+	Data      json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"created_at"`
+	ExpiresAt time.Time       `json:"expires_at"`
+}
+
+type WebhookDelivery struct {
+	ID             uuid.UUID      `json:"id"`
+	SubscriptionID uuid.UUID      `json:"subscription_id"`
+	EventID        uuid.UUID      `json:"event_id"`
+	EventType      string         `json:"event_type"`
+	Payload        string         `json:"payload"`
+	Status         string         `json:"status"`
+	Attempts       int32          `json:"attempts"`
+	NextAttemptAt  time.Time      `json:"next_attempt_at"`
+	LastAttemptAt  sql.NullTime   `json:"last_attempt_at"`
+	ResponseStatus sql.NullInt32  `json:"response_status"`
+	Error          sql.NullString `json:"error"`
+	CreatedAt      time.Time      `json:"created_at"`
+	DeliveredAt    sql.NullTime   `json:"delivered_at"`
+}
+
+type WebhookEvent struct {
+	Provider    string         `json:"provider"`
+	EventID     string         `json:"event_id"`
+	EventType   string         `json:"event_type"`
+	Payload     string         `json:"payload"`
+	Status      string         `json:"status"`
+	Error       sql.NullString `json:"error"`
+	Attempts    int32          `json:"attempts"`
+	ReceivedAt  time.Time      `json:"received_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	ProcessedAt sql.NullTime   `json:"processed_at"`
+}
+
+type WebhookSubscription struct {
+	ID                  uuid.UUID    `json:"id"`
+	ClientID            uuid.UUID    `json:"client_id"`
+	Url                 string       `json:"url"`
+	EventTypes          []string     `json:"event_types"`
+	Secret              string       `json:"secret"`
+	ConsecutiveFailures int32        `json:"consecutive_failures"`
+	DisabledAt          sql.NullTime `json:"disabled_at"`
+	CreatedAt           time.Time    `json:"created_at"`
+	UpdatedAt           time.Time    `json:"updated_at"`
 }
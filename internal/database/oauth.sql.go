@@ -0,0 +1,184 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: oauth.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const consumeAuthorizationCode = `-- name: ConsumeAuthorizationCode :one
+UPDATE oauth_authorization_codes
+SET used_at = NOW()
+WHERE code_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+RETURNING code_hash, client_id, user_id, redirect_uri, scopes, code_challenge, created_at, expires_at, used_at
+`
+
+func (q *Queries) ConsumeAuthorizationCode(ctx context.Context, codeHash string) (OauthAuthorizationCode, error) {
+	row := q.db.QueryRowContext(ctx, consumeAuthorizationCode, codeHash)
+	var i OauthAuthorizationCode
+	err := row.Scan(
+		&i.CodeHash,
+		&i.ClientID,
+		&i.UserID,
+		&i.RedirectUri,
+		pq.Array(&i.Scopes),
+		&i.CodeChallenge,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+		&i.UsedAt,
+	)
+	return i, err
+}
+
+const createAuthorizationCode = `-- name: CreateAuthorizationCode :exec
+INSERT INTO oauth_authorization_codes (code_hash, client_id, user_id, redirect_uri, scopes, code_challenge, created_at, expires_at)
+VALUES (
+  $1, $2, $3, $4, $5, $6, NOW(), $7
+)
+`
+
+type CreateAuthorizationCodeParams struct {
+	CodeHash      string    `json:"code_hash"`
+	ClientID      uuid.UUID `json:"client_id"`
+	UserID        uuid.UUID `json:"user_id"`
+	RedirectUri   string    `json:"redirect_uri"`
+	Scopes        []string  `json:"scopes"`
+	CodeChallenge string    `json:"code_challenge"`
+	ExpiresAt     time.Time `json:"expires_at"`
+}
+
+func (q *Queries) CreateAuthorizationCode(ctx context.Context, arg CreateAuthorizationCodeParams) error {
+	_, err := q.db.ExecContext(ctx, createAuthorizationCode,
+		arg.CodeHash,
+		arg.ClientID,
+		arg.UserID,
+		arg.RedirectUri,
+		pq.Array(arg.Scopes),
+		arg.CodeChallenge,
+		arg.ExpiresAt,
+	)
+	return err
+}
+
+const createOAuthClient = `-- name: CreateOAuthClient :one
+INSERT INTO oauth_clients (id, owner_id, name, client_secret_hash, redirect_uris, scopes, created_at, updated_at)
+VALUES (
+  gen_random_uuid(), $1, $2, $3, $4, $5, NOW(), NOW()
+)
+RETURNING id, owner_id, name, client_secret_hash, redirect_uris, scopes, created_at, updated_at
+`
+
+type CreateOAuthClientParams struct {
+	OwnerID          uuid.UUID      `json:"owner_id"`
+	Name             string         `json:"name"`
+	ClientSecretHash sql.NullString `json:"client_secret_hash"`
+	RedirectUris     []string       `json:"redirect_uris"`
+	Scopes           []string       `json:"scopes"`
+}
+
+func (q *Queries) CreateOAuthClient(ctx context.Context, arg CreateOAuthClientParams) (OauthClient, error) {
+	row := q.db.QueryRowContext(ctx, createOAuthClient,
+		arg.OwnerID,
+		arg.Name,
+		arg.ClientSecretHash,
+		pq.Array(arg.RedirectUris),
+		pq.Array(arg.Scopes),
+	)
+	var i OauthClient
+	err := row.Scan(
+		&i.ID,
+		&i.OwnerID,
+		&i.Name,
+		&i.ClientSecretHash,
+		pq.Array(&i.RedirectUris),
+		pq.Array(&i.Scopes),
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const deleteOAuthClient = `-- name: DeleteOAuthClient :execrows
+DELETE FROM oauth_clients
+WHERE id = $1 AND owner_id = $2
+`
+
+type DeleteOAuthClientParams struct {
+	ID      uuid.UUID `json:"id"`
+	OwnerID uuid.UUID `json:"owner_id"`
+}
+
+func (q *Queries) DeleteOAuthClient(ctx context.Context, arg DeleteOAuthClientParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteOAuthClient, arg.ID, arg.OwnerID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getOAuthClient = `-- name: GetOAuthClient :one
+SELECT id, owner_id, name, client_secret_hash, redirect_uris, scopes, created_at, updated_at FROM oauth_clients
+WHERE id = $1
+`
+
+func (q *Queries) GetOAuthClient(ctx context.Context, id uuid.UUID) (OauthClient, error) {
+	row := q.db.QueryRowContext(ctx, getOAuthClient, id)
+	var i OauthClient
+	err := row.Scan(
+		&i.ID,
+		&i.OwnerID,
+		&i.Name,
+		&i.ClientSecretHash,
+		pq.Array(&i.RedirectUris),
+		pq.Array(&i.Scopes),
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const listOAuthClientsByOwner = `-- name: ListOAuthClientsByOwner :many
+SELECT id, owner_id, name, client_secret_hash, redirect_uris, scopes, created_at, updated_at FROM oauth_clients
+WHERE owner_id = $1
+ORDER BY created_at DESC
+`
+
+func (q *Queries) ListOAuthClientsByOwner(ctx context.Context, ownerID uuid.UUID) ([]OauthClient, error) {
+	rows, err := q.db.QueryContext(ctx, listOAuthClientsByOwner, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []OauthClient
+	for rows.Next() {
+		var i OauthClient
+		if err := rows.Scan(
+			&i.ID,
+			&i.OwnerID,
+			&i.Name,
+			&i.ClientSecretHash,
+			pq.Array(&i.RedirectUris),
+			pq.Array(&i.Scopes),
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -0,0 +1,411 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: outbound_webhooks.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const claimDueWebhookDeliveries = `-- name: ClaimDueWebhookDeliveries :many
+UPDATE webhook_deliveries AS d
+SET next_attempt_at = NOW() + $1::INTEGER * INTERVAL '1 second'
+FROM webhook_subscriptions AS s
+WHERE s.id = d.subscription_id
+AND d.id IN (
+  SELECT due.id FROM webhook_deliveries AS due
+  JOIN webhook_subscriptions AS active ON active.id = due.subscription_id
+  WHERE due.status = 'pending' AND due.next_attempt_at <= NOW() AND active.disabled_at IS NULL
+  ORDER BY due.next_attempt_at
+  LIMIT $2
+  FOR UPDATE OF due SKIP LOCKED
+)
+RETURNING d.id, d.subscription_id, d.event_id, d.event_type, d.payload, d.attempts, s.url, s.secret
+`
+
+type ClaimDueWebhookDeliveriesParams struct {
+	LeaseSeconds int32 `json:"lease_seconds"`
+	BatchSize    int32 `json:"batch_size"`
+}
+
+type ClaimDueWebhookDeliveriesRow struct {
+	ID             uuid.UUID `json:"id"`
+	SubscriptionID uuid.UUID `json:"subscription_id"`
+	EventID        uuid.UUID `json:"event_id"`
+	EventType      string    `json:"event_type"`
+	Payload        string    `json:"payload"`
+	Attempts       int32     `json:"attempts"`
+	Url            string    `json:"url"`
+	Secret         string    `json:"secret"`
+}
+
+// Leases due deliveries by pushing their next attempt back, so other workers
+// skip them while they are being sent.
+func (q *Queries) ClaimDueWebhookDeliveries(ctx context.Context, arg ClaimDueWebhookDeliveriesParams) ([]ClaimDueWebhookDeliveriesRow, error) {
+	rows, err := q.db.QueryContext(ctx, claimDueWebhookDeliveries, arg.LeaseSeconds, arg.BatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ClaimDueWebhookDeliveriesRow
+	for rows.Next() {
+		var i ClaimDueWebhookDeliveriesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.SubscriptionID,
+			&i.EventID,
+			&i.EventType,
+			&i.Payload,
+			&i.Attempts,
+			&i.Url,
+			&i.Secret,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const createWebhookSubscription = `-- name: CreateWebhookSubscription :one
+INSERT INTO webhook_subscriptions (id, client_id, url, event_types, secret, created_at, updated_at)
+VALUES (
+  gen_random_uuid(), $1, $2, $3, $4, NOW(), NOW()
+)
+RETURNING id, client_id, url, event_types, secret, consecutive_failures, disabled_at, created_at, updated_at
+`
+
+type CreateWebhookSubscriptionParams struct {
+	ClientID   uuid.UUID `json:"client_id"`
+	Url        string    `json:"url"`
+	EventTypes []string  `json:"event_types"`
+	Secret     string    `json:"secret"`
+}
+
+func (q *Queries) CreateWebhookSubscription(ctx context.Context, arg CreateWebhookSubscriptionParams) (WebhookSubscription, error) {
+	row := q.db.QueryRowContext(ctx, createWebhookSubscription,
+		arg.ClientID,
+		arg.Url,
+		pq.Array(arg.EventTypes),
+		arg.Secret,
+	)
+	var i WebhookSubscription
+	err := row.Scan(
+		&i.ID,
+		&i.ClientID,
+		&i.Url,
+		pq.Array(&i.EventTypes),
+		&i.Secret,
+		&i.ConsecutiveFailures,
+		&i.DisabledAt,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const deleteWebhookSubscription = `-- name: DeleteWebhookSubscription :execrows
+DELETE FROM webhook_subscriptions
+WHERE id = $1 AND client_id = $2
+`
+
+type DeleteWebhookSubscriptionParams struct {
+	ID       uuid.UUID `json:"id"`
+	ClientID uuid.UUID `json:"client_id"`
+}
+
+func (q *Queries) DeleteWebhookSubscription(ctx context.Context, arg DeleteWebhookSubscriptionParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteWebhookSubscription, arg.ID, arg.ClientID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const enableWebhookSubscription = `-- name: EnableWebhookSubscription :one
+UPDATE webhook_subscriptions
+SET disabled_at = NULL,
+consecutive_failures = 0,
+updated_at = NOW()
+WHERE id = $1 AND client_id = $2
+RETURNING id, client_id, url, event_types, secret, consecutive_failures, disabled_at, created_at, updated_at
+`
+
+type EnableWebhookSubscriptionParams struct {
+	ID       uuid.UUID `json:"id"`
+	ClientID uuid.UUID `json:"client_id"`
+}
+
+func (q *Queries) EnableWebhookSubscription(ctx context.Context, arg EnableWebhookSubscriptionParams) (WebhookSubscription, error) {
+	row := q.db.QueryRowContext(ctx, enableWebhookSubscription, arg.ID, arg.ClientID)
+	var i WebhookSubscription
+	err := row.Scan(
+		&i.ID,
+		&i.ClientID,
+		&i.Url,
+		pq.Array(&i.EventTypes),
+		&i.Secret,
+		&i.ConsecutiveFailures,
+		&i.DisabledAt,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const enqueueWebhookDeliveries = `-- name: EnqueueWebhookDeliveries :execrows
+INSERT INTO webhook_deliveries (id, subscription_id, event_id, event_type, payload, status, next_attempt_at, created_at)
+SELECT gen_random_uuid(), s.id, $1, $2, $3, 'pending', NOW(), NOW()
+FROM webhook_subscriptions AS s
+WHERE s.disabled_at IS NULL AND $2::TEXT = ANY(s.event_types)
+AND EXISTS (
+  SELECT 1 FROM refresh_tokens AS grant_token
+  WHERE grant_token.client_id = s.client_id
+  AND grant_token.user_id = $4
+  AND grant_token.revoked_at IS NULL
+  AND grant_token.expires_at > NOW()
+  AND $5::TEXT = ANY(grant_token.scopes)
+)
+`
+
+type EnqueueWebhookDeliveriesParams struct {
+	EventID   uuid.UUID `json:"event_id"`
+	EventType string    `json:"event_type"`
+	Payload   string    `json:"payload"`
+	UserID    uuid.UUID `json:"user_id"`
+	Scope     string    `json:"scope"`
+}
+
+// Queues an event for every enabled subscription to its type whose client
+// the user the event is about has granted the scope to read it.
+func (q *Queries) EnqueueWebhookDeliveries(ctx context.Context, arg EnqueueWebhookDeliveriesParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, enqueueWebhookDeliveries,
+		arg.EventID,
+		arg.EventType,
+		arg.Payload,
+		arg.UserID,
+		arg.Scope,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getWebhookSubscription = `-- name: GetWebhookSubscription :one
+SELECT id, client_id, url, event_types, secret, consecutive_failures, disabled_at, created_at, updated_at FROM webhook_subscriptions
+WHERE id = $1 AND client_id = $2
+`
+
+type GetWebhookSubscriptionParams struct {
+	ID       uuid.UUID `json:"id"`
+	ClientID uuid.UUID `json:"client_id"`
+}
+
+func (q *Queries) GetWebhookSubscription(ctx context.Context, arg GetWebhookSubscriptionParams) (WebhookSubscription, error) {
+	row := q.db.QueryRowContext(ctx, getWebhookSubscription, arg.ID, arg.ClientID)
+	var i WebhookSubscription
+	err := row.Scan(
+		&i.ID,
+		&i.ClientID,
+		&i.Url,
+		pq.Array(&i.EventTypes),
+		&i.Secret,
+		&i.ConsecutiveFailures,
+		&i.DisabledAt,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const listWebhookDeliveries = `-- name: ListWebhookDeliveries :many
+SELECT id, subscription_id, event_id, event_type, payload, status, attempts, next_attempt_at, last_attempt_at, response_status, error, created_at, delivered_at FROM webhook_deliveries
+WHERE subscription_id = $1
+ORDER BY created_at DESC
+LIMIT $2
+`
+
+type ListWebhookDeliveriesParams struct {
+	SubscriptionID uuid.UUID `json:"subscription_id"`
+	Limit          int32     `json:"limit"`
+}
+
+func (q *Queries) ListWebhookDeliveries(ctx context.Context, arg ListWebhookDeliveriesParams) ([]WebhookDelivery, error) {
+	rows, err := q.db.QueryContext(ctx, listWebhookDeliveries, arg.SubscriptionID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []WebhookDelivery
+	for rows.Next() {
+		var i WebhookDelivery
+		if err := rows.Scan(
+			&i.ID,
+			&i.SubscriptionID,
+			&i.EventID,
+			&i.EventType,
+			&i.Payload,
+			&i.Status,
+			&i.Attempts,
+			&i.NextAttemptAt,
+			&i.LastAttemptAt,
+			&i.ResponseStatus,
+			&i.Error,
+			&i.CreatedAt,
+			&i.DeliveredAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listWebhookSubscriptions = `-- name: ListWebhookSubscriptions :many
+SELECT id, client_id, url, event_types, secret, consecutive_failures, disabled_at, created_at, updated_at FROM webhook_subscriptions
+WHERE client_id = $1
+ORDER BY created_at
+`
+
+func (q *Queries) ListWebhookSubscriptions(ctx context.Context, clientID uuid.UUID) ([]WebhookSubscription, error) {
+	rows, err := q.db.QueryContext(ctx, listWebhookSubscriptions, clientID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []WebhookSubscription
+	for rows.Next() {
+		var i WebhookSubscription
+		if err := rows.Scan(
+			&i.ID,
+			&i.ClientID,
+			&i.Url,
+			pq.Array(&i.EventTypes),
+			&i.Secret,
+			&i.ConsecutiveFailures,
+			&i.DisabledAt,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markWebhookAttemptFailed = `-- name: MarkWebhookAttemptFailed :exec
+UPDATE webhook_deliveries
+SET status = $2,
+attempts = attempts + 1,
+last_attempt_at = NOW(),
+next_attempt_at = $3,
+response_status = $4,
+error = $5
+WHERE id = $1
+`
+
+type MarkWebhookAttemptFailedParams struct {
+	ID             uuid.UUID      `json:"id"`
+	Status         string         `json:"status"`
+	NextAttemptAt  time.Time      `json:"next_attempt_at"`
+	ResponseStatus sql.NullInt32  `json:"response_status"`
+	Error          sql.NullString `json:"error"`
+}
+
+// Records a failed attempt. The delivery is retried at next_attempt_at, or
+// given up on when status is 'failed'.
+func (q *Queries) MarkWebhookAttemptFailed(ctx context.Context, arg MarkWebhookAttemptFailedParams) error {
+	_, err := q.db.ExecContext(ctx, markWebhookAttemptFailed,
+		arg.ID,
+		arg.Status,
+		arg.NextAttemptAt,
+		arg.ResponseStatus,
+		arg.Error,
+	)
+	return err
+}
+
+const markWebhookDelivered = `-- name: MarkWebhookDelivered :exec
+UPDATE webhook_deliveries
+SET status = 'delivered',
+attempts = attempts + 1,
+last_attempt_at = NOW(),
+delivered_at = NOW(),
+response_status = $2,
+error = NULL
+WHERE id = $1
+`
+
+type MarkWebhookDeliveredParams struct {
+	ID             uuid.UUID     `json:"id"`
+	ResponseStatus sql.NullInt32 `json:"response_status"`
+}
+
+func (q *Queries) MarkWebhookDelivered(ctx context.Context, arg MarkWebhookDeliveredParams) error {
+	_, err := q.db.ExecContext(ctx, markWebhookDelivered, arg.ID, arg.ResponseStatus)
+	return err
+}
+
+const recordWebhookFailure = `-- name: RecordWebhookFailure :one
+UPDATE webhook_subscriptions
+SET consecutive_failures = consecutive_failures + 1,
+disabled_at = CASE
+  WHEN consecutive_failures + 1 >= $2::INTEGER THEN COALESCE(disabled_at, NOW())
+  ELSE disabled_at
+END,
+updated_at = NOW()
+WHERE id = $1
+RETURNING consecutive_failures
+`
+
+type RecordWebhookFailureParams struct {
+	ID          uuid.UUID `json:"id"`
+	MaxFailures int32     `json:"max_failures"`
+}
+
+// Counts a failed attempt against the subscription and disables it once
+// max_failures are reached in a row.
+func (q *Queries) RecordWebhookFailure(ctx context.Context, arg RecordWebhookFailureParams) (int32, error) {
+	row := q.db.QueryRowContext(ctx, recordWebhookFailure, arg.ID, arg.MaxFailures)
+	var consecutive_failures int32
+	err := row.Scan(&consecutive_failures)
+	return consecutive_failures, err
+}
+
+const resetWebhookFailures = `-- name: ResetWebhookFailures :exec
+UPDATE webhook_subscriptions
+SET consecutive_failures = 0
+WHERE id = $1 AND consecutive_failures > 0
+`
+
+func (q *Queries) ResetWebhookFailures(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, resetWebhookFailures, id)
+	return err
+}
@@ -0,0 +1,84 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: password_history.sql
+
+package database
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+const addPasswordHistory = `-- name: AddPasswordHistory :exec
+INSERT INTO password_history (id, user_id, hashed_password, created_at)
+VALUES (
+  gen_random_uuid(), $1, $2, NOW()
+)
+`
+
+type AddPasswordHistoryParams struct {
+	UserID         uuid.UUID `json:"user_id"`
+	HashedPassword string    `json:"hashed_password"`
+}
+
+func (q *Queries) AddPasswordHistory(ctx context.Context, arg AddPasswordHistoryParams) error {
+	_, err := q.db.ExecContext(ctx, addPasswordHistory, arg.UserID, arg.HashedPassword)
+	return err
+}
+
+const listPasswordHistory = `-- name: ListPasswordHistory :many
+SELECT hashed_password FROM password_history
+WHERE user_id = $1
+ORDER BY created_at DESC
+LIMIT $2
+`
+
+type ListPasswordHistoryParams struct {
+	UserID uuid.UUID `json:"user_id"`
+	Limit  int32     `json:"limit"`
+}
+
+func (q *Queries) ListPasswordHistory(ctx context.Context, arg ListPasswordHistoryParams) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, listPasswordHistory, arg.UserID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var hashed_password string
+		if err := rows.Scan(&hashed_password); err != nil {
+			return nil, err
+		}
+		items = append(items, hashed_password)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const prunePasswordHistory = `-- name: PrunePasswordHistory :exec
+DELETE FROM password_history p
+WHERE p.user_id = $1 AND p.id NOT IN (
+  SELECT h.id FROM password_history h
+  WHERE h.user_id = $1
+  ORDER BY h.created_at DESC
+  LIMIT $2
+)
+`
+
+type PrunePasswordHistoryParams struct {
+	UserID uuid.UUID `json:"user_id"`
+	Keep   int32     `json:"keep"`
+}
+
+func (q *Queries) PrunePasswordHistory(ctx context.Context, arg PrunePasswordHistoryParams) error {
+	_, err := q.db.ExecContext(ctx, prunePasswordHistory, arg.UserID, arg.Keep)
+	return err
+}
@@ -9,14 +9,54 @@ import (
 	"context"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+const createOAuthRefreshToken = `-- name: CreateOAuthRefreshToken :one
+INSERT INTO refresh_tokens (created_at, updated_at, token, user_id, expires_at, session_id, client_id, scopes)
+VALUES (
+  NOW(), NOW(), $1, $2, (NOW() + INTERVAL '60 days'), $3, $4, $5
+)
+RETURNING token, created_at, updated_at, user_id, expires_at, revoked_at, session_id, client_id, scopes
+`
+
+type CreateOAuthRefreshTokenParams struct {
+	Token     string        `json:"token"`
+	UserID    uuid.UUID     `json:"user_id"`
+	SessionID uuid.UUID     `json:"session_id"`
+	ClientID  uuid.NullUUID `json:"client_id"`
+	Scopes    []string      `json:"scopes"`
+}
+
+func (q *Queries) CreateOAuthRefreshToken(ctx context.Context, arg CreateOAuthRefreshTokenParams) (RefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, createOAuthRefreshToken,
+		arg.Token,
+		arg.UserID,
+		arg.SessionID,
+		arg.ClientID,
+		pq.Array(arg.Scopes),
+	)
+	var i RefreshToken
+	err := row.Scan(
+		&i.Token,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+		&i.SessionID,
+		&i.ClientID,
+		pq.Array(&i.Scopes),
+	)
+	return i, err
+}
+
 const createRefreshToken = `-- name: CreateRefreshToken :one
 INSERT INTO refresh_tokens (created_at, updated_at, token, user_id, expires_at)
 VALUES (
   NOW(), NOW(), $1, $2, (NOW() + INTERVAL '60 days')
 )
-RETURNING token, created_at, updated_at, user_id, expires_at, revoked_at
+RETURNING token, created_at, updated_at, user_id, expires_at, revoked_at, session_id, client_id, scopes
 `
 
 type CreateRefreshTokenParams struct {
@@ -34,12 +74,42 @@ func (q *Queries) CreateRefreshToken(ctx context.Context, arg CreateRefreshToken
 		&i.UserID,
 		&i.ExpiresAt,
 		&i.RevokedAt,
+		&i.SessionID,
+		&i.ClientID,
+		pq.Array(&i.Scopes),
+	)
+	return i, err
+}
+
+const getOAuthRefreshToken = `-- name: GetOAuthRefreshToken :one
+SELECT token, created_at, updated_at, user_id, expires_at, revoked_at, session_id, client_id, scopes FROM refresh_tokens
+WHERE token = $1 AND client_id = $2
+`
+
+type GetOAuthRefreshTokenParams struct {
+	Token    string        `json:"token"`
+	ClientID uuid.NullUUID `json:"client_id"`
+}
+
+func (q *Queries) GetOAuthRefreshToken(ctx context.Context, arg GetOAuthRefreshTokenParams) (RefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, getOAuthRefreshToken, arg.Token, arg.ClientID)
+	var i RefreshToken
+	err := row.Scan(
+		&i.Token,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+		&i.SessionID,
+		&i.ClientID,
+		pq.Array(&i.Scopes),
 	)
 	return i, err
 }
 
 const getRefreshToken = `-- name: GetRefreshToken :one
-SELECT token, created_at, updated_at, user_id, expires_at, revoked_at FROM refresh_tokens
+SELECT token, created_at, updated_at, user_id, expires_at, revoked_at, session_id, client_id, scopes FROM refresh_tokens
 WHERE token = $1 AND revoked_at IS NULL
 `
 
@@ -53,16 +123,84 @@ func (q *Queries) GetRefreshToken(ctx context.Context, token string) (RefreshTok
 		&i.UserID,
 		&i.ExpiresAt,
 		&i.RevokedAt,
+		&i.SessionID,
+		&i.ClientID,
+		pq.Array(&i.Scopes),
 	)
 	return i, err
 }
 
+const isSessionActive = `-- name: IsSessionActive :one
+SELECT EXISTS (
+  SELECT 1 FROM refresh_tokens
+  WHERE session_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+)
+`
+
+func (q *Queries) IsSessionActive(ctx context.Context, sessionID uuid.UUID) (bool, error) {
+	row := q.db.QueryRowContext(ctx, isSessionActive, sessionID)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+const listUserRefreshTokens = `-- name: ListUserRefreshTokens :many
+SELECT token, created_at, updated_at, user_id, expires_at, revoked_at, session_id, client_id, scopes FROM refresh_tokens
+WHERE user_id = $1
+ORDER BY created_at DESC
+`
+
+func (q *Queries) ListUserRefreshTokens(ctx context.Context, userID uuid.UUID) ([]RefreshToken, error) {
+	rows, err := q.db.QueryContext(ctx, listUserRefreshTokens, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []RefreshToken
+	for rows.Next() {
+		var i RefreshToken
+		if err := rows.Scan(
+			&i.Token,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.ExpiresAt,
+			&i.RevokedAt,
+			&i.SessionID,
+			&i.ClientID,
+			pq.Array(&i.Scopes),
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const revokeAllUserRefreshTokens = `-- name: RevokeAllUserRefreshTokens :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(),
+updated_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeAllUserRefreshTokens(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, revokeAllUserRefreshTokens, userID)
+	return err
+}
+
 const revokeRefreskToken = `-- name: RevokeRefreskToken :one
 UPDATE refresh_tokens
 SET revoked_at = NOW(),
 updated_at = NOW()
 WHERE token = $1
-RETURNING token, created_at, updated_at, user_id, expires_at, revoked_at
+RETURNING token, created_at, updated_at, user_id, expires_at, revoked_at, session_id, client_id, scopes
 `
 
 func (q *Queries) RevokeRefreskToken(ctx context.Context, token string) (RefreshToken, error) {
@@ -75,6 +213,41 @@ func (q *Queries) RevokeRefreskToken(ctx context.Context, token string) (Refresh
 		&i.UserID,
 		&i.ExpiresAt,
 		&i.RevokedAt,
+		&i.SessionID,
+		&i.ClientID,
+		pq.Array(&i.Scopes),
 	)
 	return i, err
 }
+
+const revokeSession = `-- name: RevokeSession :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(),
+updated_at = NOW()
+WHERE session_id = $1 AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeSession(ctx context.Context, sessionID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, revokeSession, sessionID)
+	return err
+}
+
+const rotateOAuthRefreshToken = `-- name: RotateOAuthRefreshToken :execrows
+UPDATE refresh_tokens
+SET revoked_at = NOW(),
+updated_at = NOW()
+WHERE token = $1 AND client_id = $2 AND revoked_at IS NULL
+`
+
+type RotateOAuthRefreshTokenParams struct {
+	Token    string        `json:"token"`
+	ClientID uuid.NullUUID `json:"client_id"`
+}
+
+func (q *Queries) RotateOAuthRefreshToken(ctx context.Context, arg RotateOAuthRefreshTokenParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, rotateOAuthRefreshToken, arg.Token, arg.ClientID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
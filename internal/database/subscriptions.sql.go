@@ -0,0 +1,145 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: subscriptions.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const expireSubscription = `-- name: ExpireSubscription :execrows
+UPDATE subscriptions
+SET status = 'expired',
+cancel_at_period_end = false,
+updated_at = NOW()
+WHERE user_id = $1 AND status IN ('active', 'past_due') AND current_period_end <= NOW()
+`
+
+func (q *Queries) ExpireSubscription(ctx context.Context, userID uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, expireSubscription, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getSubscriptionForUpdate = `-- name: GetSubscriptionForUpdate :one
+SELECT user_id, provider, plan, status, current_period_start, current_period_end, cancel_at_period_end, last_event_at, created_at, updated_at FROM subscriptions
+WHERE user_id = $1
+FOR UPDATE
+`
+
+func (q *Queries) GetSubscriptionForUpdate(ctx context.Context, userID uuid.UUID) (Subscription, error) {
+	row := q.db.QueryRowContext(ctx, getSubscriptionForUpdate, userID)
+	var i Subscription
+	err := row.Scan(
+		&i.UserID,
+		&i.Provider,
+		&i.Plan,
+		&i.Status,
+		&i.CurrentPeriodStart,
+		&i.CurrentPeriodEnd,
+		&i.CancelAtPeriodEnd,
+		&i.LastEventAt,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const listLapsedSubscriptions = `-- name: ListLapsedSubscriptions :many
+SELECT user_id FROM subscriptions
+WHERE status IN ('active', 'past_due') AND current_period_end <= NOW()
+ORDER BY current_period_end
+LIMIT $1
+`
+
+func (q *Queries) ListLapsedSubscriptions(ctx context.Context, limit int32) ([]uuid.UUID, error) {
+	rows, err := q.db.QueryContext(ctx, listLapsedSubscriptions, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var user_id uuid.UUID
+		if err := rows.Scan(&user_id); err != nil {
+			return nil, err
+		}
+		items = append(items, user_id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const upsertSubscription = `-- name: UpsertSubscription :one
+INSERT INTO subscriptions (
+  user_id, provider, plan, status, current_period_start, current_period_end,
+  cancel_at_period_end, last_event_at, created_at, updated_at
+)
+VALUES (
+  $1, $2, $3, $4, $5, $6, $7, $8, NOW(), NOW()
+)
+ON CONFLICT (user_id) DO UPDATE
+SET provider = EXCLUDED.provider,
+plan = EXCLUDED.plan,
+status = EXCLUDED.status,
+current_period_start = EXCLUDED.current_period_start,
+current_period_end = EXCLUDED.current_period_end,
+cancel_at_period_end = EXCLUDED.cancel_at_period_end,
+last_event_at = EXCLUDED.last_event_at,
+updated_at = NOW()
+WHERE subscriptions.last_event_at <= EXCLUDED.last_event_at
+RETURNING user_id, provider, plan, status, current_period_start, current_period_end, cancel_at_period_end, last_event_at, created_at, updated_at
+`
+
+type UpsertSubscriptionParams struct {
+	UserID             uuid.UUID    `json:"user_id"`
+	Provider           string       `json:"provider"`
+	Plan               string       `json:"plan"`
+	Status             string       `json:"status"`
+	CurrentPeriodStart sql.NullTime `json:"current_period_start"`
+	CurrentPeriodEnd   sql.NullTime `json:"current_period_end"`
+	CancelAtPeriodEnd  bool         `json:"cancel_at_period_end"`
+	LastEventAt        time.Time    `json:"last_event_at"`
+}
+
+// Stores the state after an event, unless an event newer than this one was
+// stored in the meantime, in which case no row is returned.
+func (q *Queries) UpsertSubscription(ctx context.Context, arg UpsertSubscriptionParams) (Subscription, error) {
+	row := q.db.QueryRowContext(ctx, upsertSubscription,
+		arg.UserID,
+		arg.Provider,
+		arg.Plan,
+		arg.Status,
+		arg.CurrentPeriodStart,
+		arg.CurrentPeriodEnd,
+		arg.CancelAtPeriodEnd,
+		arg.LastEventAt,
+	)
+	var i Subscription
+	err := row.Scan(
+		&i.UserID,
+		&i.Provider,
+		&i.Plan,
+		&i.Status,
+		&i.CurrentPeriodStart,
+		&i.CurrentPeriodEnd,
+		&i.CancelAtPeriodEnd,
+		&i.LastEventAt,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
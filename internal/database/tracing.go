@@ -0,0 +1,92 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracedDB runs queries on DB, each in a child span of the span in its
+// context, named after the sqlc query.
+type TracedDB struct {
+	DB     DBTX
+	Tracer trace.Tracer
+}
+
+// NewTraced returns Queries whose queries are traced with tracer.
+func NewTraced(db DBTX, tracer trace.Tracer) *Queries {
+	return New(&TracedDB{DB: db, Tracer: tracer})
+}
+
+// InTx is WithTx for Queries that may be traced: WithTx runs queries on tx
+// directly, InTx keeps tracing them the way q does.
+func (q *Queries) InTx(tx *sql.Tx) *Queries {
+	if traced, ok := q.db.(*TracedDB); ok {
+		return NewTraced(tx, traced.Tracer)
+	}
+	return q.WithTx(tx)
+}
+
+func (t *TracedDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := t.start(ctx, query)
+	result, err := t.DB.ExecContext(ctx, query, args...)
+	endSpan(span, err)
+	return result, err
+}
+
+func (t *TracedDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	ctx, span := t.start(ctx, query)
+	stmt, err := t.DB.PrepareContext(ctx, query)
+	endSpan(span, err)
+	return stmt, err
+}
+
+// QueryContext's span ends when the query returns, before its rows are read.
+func (t *TracedDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, span := t.start(ctx, query)
+	rows, err := t.DB.QueryContext(ctx, query, args...)
+	endSpan(span, err)
+	return rows, err
+}
+
+func (t *TracedDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, span := t.start(ctx, query)
+	row := t.DB.QueryRowContext(ctx, query, args...)
+	endSpan(span, row.Err())
+	return row
+}
+
+func (t *TracedDB) start(ctx context.Context, query string) (context.Context, trace.Span) {
+	name := queryName(query)
+	return t.Tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemNamePostgreSQL,
+			semconv.DBOperationName(name),
+			semconv.DBQueryText(query),
+		),
+	)
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// queryName reads the name sqlc puts at the top of every query, as in
+// "-- name: GetUser :one".
+func queryName(query string) string {
+	fields := strings.Fields(strings.TrimPrefix(query, "-- name:"))
+	if !strings.HasPrefix(query, "-- name:") || len(fields) == 0 {
+		return "query"
+	}
+	return fields[0]
+}
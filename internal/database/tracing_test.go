@@ -0,0 +1,57 @@
+package database_test
+
+import (
+	"chirpy/internal/database"
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// fakeDB answers every Exec with err.
+type fakeDB struct {
+	database.DBTX
+	err error
+}
+
+type result struct{}
+
+func (result) LastInsertId() (int64, error) { return 0, nil }
+func (result) RowsAffected() (int64, error) { return 1, nil }
+
+func (f fakeDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return result{}, f.err
+}
+
+func TestTracedQueriesGetSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+	ctx, parent := tracer.Start(context.Background(), "request")
+	err := database.NewTraced(fakeDB{}, tracer).DeleteUsers(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = database.NewTraced(fakeDB{err: errors.New("connection refused")}, tracer).DeleteUsers(ctx)
+	if err == nil {
+		t.Fatal("Expected the error to be returned")
+	}
+	parent.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("Expected two query spans and the parent, got %d", len(spans))
+	}
+	for _, span := range spans[:2] {
+		if span.Name() != "DeleteUsers" || span.Parent().SpanID() != parent.SpanContext().SpanID() {
+			t.Fatalf("Expected a DeleteUsers span under the request, got %q under %v", span.Name(), span.Parent().SpanID())
+		}
+	}
+	if spans[0].Status().Code == codes.Error || spans[1].Status().Code != codes.Error {
+		t.Fatalf("Expected only the failed query to be an error, got %v and %v", spans[0].Status(), spans[1].Status())
+	}
+}
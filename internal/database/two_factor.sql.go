@@ -0,0 +1,196 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: two_factor.sql
+
+package database
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+const confirmTOTP = `-- name: ConfirmTOTP :one
+UPDATE user_totp
+SET confirmed_at = NOW(),
+last_used_step = $2,
+updated_at = NOW()
+WHERE user_id = $1 AND confirmed_at IS NULL
+RETURNING user_id, secret, confirmed_at, last_used_step, created_at, updated_at
+`
+
+type ConfirmTOTPParams struct {
+	UserID       uuid.UUID `json:"user_id"`
+	LastUsedStep int64     `json:"last_used_step"`
+}
+
+func (q *Queries) ConfirmTOTP(ctx context.Context, arg ConfirmTOTPParams) (UserTotp, error) {
+	row := q.db.QueryRowContext(ctx, confirmTOTP, arg.UserID, arg.LastUsedStep)
+	var i UserTotp
+	err := row.Scan(
+		&i.UserID,
+		&i.Secret,
+		&i.ConfirmedAt,
+		&i.LastUsedStep,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const createRecoveryCode = `-- name: CreateRecoveryCode :exec
+INSERT INTO recovery_codes (id, user_id, hashed_code, created_at)
+VALUES (
+  gen_random_uuid(), $1, $2, NOW()
+)
+`
+
+type CreateRecoveryCodeParams struct {
+	UserID     uuid.UUID `json:"user_id"`
+	HashedCode string    `json:"hashed_code"`
+}
+
+func (q *Queries) CreateRecoveryCode(ctx context.Context, arg CreateRecoveryCodeParams) error {
+	_, err := q.db.ExecContext(ctx, createRecoveryCode, arg.UserID, arg.HashedCode)
+	return err
+}
+
+const deleteRecoveryCodes = `-- name: DeleteRecoveryCodes :exec
+DELETE FROM recovery_codes
+WHERE user_id = $1
+`
+
+func (q *Queries) DeleteRecoveryCodes(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteRecoveryCodes, userID)
+	return err
+}
+
+const deleteTOTP = `-- name: DeleteTOTP :exec
+DELETE FROM user_totp
+WHERE user_id = $1
+`
+
+func (q *Queries) DeleteTOTP(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteTOTP, userID)
+	return err
+}
+
+const getTOTP = `-- name: GetTOTP :one
+SELECT user_id, secret, confirmed_at, last_used_step, created_at, updated_at FROM user_totp
+WHERE user_id = $1
+`
+
+func (q *Queries) GetTOTP(ctx context.Context, userID uuid.UUID) (UserTotp, error) {
+	row := q.db.QueryRowContext(ctx, getTOTP, userID)
+	var i UserTotp
+	err := row.Scan(
+		&i.UserID,
+		&i.Secret,
+		&i.ConfirmedAt,
+		&i.LastUsedStep,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const listUnusedRecoveryCodes = `-- name: ListUnusedRecoveryCodes :many
+SELECT id, user_id, hashed_code, used_at, created_at FROM recovery_codes
+WHERE user_id = $1 AND used_at IS NULL
+`
+
+func (q *Queries) ListUnusedRecoveryCodes(ctx context.Context, userID uuid.UUID) ([]RecoveryCode, error) {
+	rows, err := q.db.QueryContext(ctx, listUnusedRecoveryCodes, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []RecoveryCode
+	for rows.Next() {
+		var i RecoveryCode
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.HashedCode,
+			&i.UsedAt,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const upsertPendingTOTP = `-- name: UpsertPendingTOTP :one
+INSERT INTO user_totp (user_id, secret, created_at, updated_at)
+VALUES (
+  $1, $2, NOW(), NOW()
+)
+ON CONFLICT (user_id) DO UPDATE
+SET secret = EXCLUDED.secret,
+last_used_step = 0,
+updated_at = NOW()
+WHERE user_totp.confirmed_at IS NULL
+RETURNING user_id, secret, confirmed_at, last_used_step, created_at, updated_at
+`
+
+type UpsertPendingTOTPParams struct {
+	UserID uuid.UUID `json:"user_id"`
+	Secret string    `json:"secret"`
+}
+
+func (q *Queries) UpsertPendingTOTP(ctx context.Context, arg UpsertPendingTOTPParams) (UserTotp, error) {
+	row := q.db.QueryRowContext(ctx, upsertPendingTOTP, arg.UserID, arg.Secret)
+	var i UserTotp
+	err := row.Scan(
+		&i.UserID,
+		&i.Secret,
+		&i.ConfirmedAt,
+		&i.LastUsedStep,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const useRecoveryCode = `-- name: UseRecoveryCode :execrows
+UPDATE recovery_codes
+SET used_at = NOW()
+WHERE id = $1 AND used_at IS NULL
+`
+
+func (q *Queries) UseRecoveryCode(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, useRecoveryCode, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const useTOTPStep = `-- name: UseTOTPStep :execrows
+UPDATE user_totp
+SET last_used_step = $2,
+updated_at = NOW()
+WHERE user_id = $1 AND last_used_step < $2
+`
+
+type UseTOTPStepParams struct {
+	UserID       uuid.UUID `json:"user_id"`
+	LastUsedStep int64     `json:"last_used_step"`
+}
+
+func (q *Queries) UseTOTPStep(ctx context.Context, arg UseTOTPStepParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, useTOTPStep, arg.UserID, arg.LastUsedStep)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
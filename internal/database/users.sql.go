@@ -7,16 +7,39 @@ package database
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/google/uuid"
 )
 
+const cancelUserDeletion = `-- name: CancelUserDeletion :exec
+UPDATE users SET delete_after = NULL, updated_at = NOW()
+WHERE id = $1
+`
+
+func (q *Queries) CancelUserDeletion(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, cancelUserDeletion, id)
+	return err
+}
+
+const countUsersByRole = `-- name: CountUsersByRole :one
+SELECT COUNT(*) FROM users
+WHERE role = $1
+`
+
+func (q *Queries) CountUsersByRole(ctx context.Context, role string) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countUsersByRole, role)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (id, created_at, updated_at, email, hashed_password)
 VALUES (
   gen_random_uuid(), NOW(), NOW(), $1, $2
 )
-RETURNING id, email, created_at, updated_at, hashed_password, is_chirpy_red
+RETURNING id, email, created_at, updated_at, hashed_password, is_chirpy_red, role, email_verified_at, delete_after
 `
 
 type CreateUserParams struct {
@@ -34,10 +57,27 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.UpdatedAt,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Role,
+		&i.EmailVerifiedAt,
+		&i.DeleteAfter,
 	)
 	return i, err
 }
 
+const deleteUser = `-- name: DeleteUser :execrows
+DELETE FROM users
+WHERE id = $1 AND delete_after <= NOW()
+`
+
+// Everything that references the user is removed through ON DELETE CASCADE.
+func (q *Queries) DeleteUser(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteUser, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const deleteUsers = `-- name: DeleteUsers :exec
 DELETE FROM users
 `
@@ -50,7 +90,7 @@ func (q *Queries) DeleteUsers(ctx context.Context) error {
 const disableUserChirpyRed = `-- name: DisableUserChirpyRed :one
 UPDATE users SET is_chirpy_red = false 
 WHERE id = $1
-RETURNING id, email, created_at, updated_at, hashed_password, is_chirpy_red
+RETURNING id, email, created_at, updated_at, hashed_password, is_chirpy_red, role, email_verified_at, delete_after
 `
 
 func (q *Queries) DisableUserChirpyRed(ctx context.Context, id uuid.UUID) (User, error) {
@@ -63,6 +103,9 @@ func (q *Queries) DisableUserChirpyRed(ctx context.Context, id uuid.UUID) (User,
 		&i.UpdatedAt,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Role,
+		&i.EmailVerifiedAt,
+		&i.DeleteAfter,
 	)
 	return i, err
 }
@@ -70,7 +113,7 @@ func (q *Queries) DisableUserChirpyRed(ctx context.Context, id uuid.UUID) (User,
 const enableUserChirpyRed = `-- name: EnableUserChirpyRed :one
 UPDATE users SET is_chirpy_red = true 
 WHERE id = $1
-RETURNING id, email, created_at, updated_at, hashed_password, is_chirpy_red
+RETURNING id, email, created_at, updated_at, hashed_password, is_chirpy_red, role, email_verified_at, delete_after
 `
 
 func (q *Queries) EnableUserChirpyRed(ctx context.Context, id uuid.UUID) (User, error) {
@@ -83,12 +126,15 @@ func (q *Queries) EnableUserChirpyRed(ctx context.Context, id uuid.UUID) (User,
 		&i.UpdatedAt,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Role,
+		&i.EmailVerifiedAt,
+		&i.DeleteAfter,
 	)
 	return i, err
 }
 
 const getUser = `-- name: GetUser :one
-SELECT id, email, created_at, updated_at, hashed_password, is_chirpy_red FROM users
+SELECT id, email, created_at, updated_at, hashed_password, is_chirpy_red, role, email_verified_at, delete_after FROM users
 WHERE email = $1
 `
 
@@ -102,12 +148,15 @@ func (q *Queries) GetUser(ctx context.Context, email string) (User, error) {
 		&i.UpdatedAt,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Role,
+		&i.EmailVerifiedAt,
+		&i.DeleteAfter,
 	)
 	return i, err
 }
 
 const getUserByID = `-- name: GetUserByID :one
-SELECT id, email, created_at, updated_at, hashed_password, is_chirpy_red FROM users
+SELECT id, email, created_at, updated_at, hashed_password, is_chirpy_red, role, email_verified_at, delete_after FROM users
 WHERE id = $1
 `
 
@@ -121,6 +170,115 @@ func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (User, error) {
 		&i.UpdatedAt,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Role,
+		&i.EmailVerifiedAt,
+		&i.DeleteAfter,
+	)
+	return i, err
+}
+
+const isUserActive = `-- name: IsUserActive :one
+SELECT EXISTS (
+  SELECT 1 FROM users
+  WHERE id = $1 AND delete_after IS NULL
+)
+`
+
+// Whether the user exists and is not scheduled for deletion.
+func (q *Queries) IsUserActive(ctx context.Context, id uuid.UUID) (bool, error) {
+	row := q.db.QueryRowContext(ctx, isUserActive, id)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+const listUsersDueForDeletion = `-- name: ListUsersDueForDeletion :many
+SELECT id, email FROM users
+WHERE delete_after <= NOW()
+ORDER BY delete_after
+LIMIT $1
+`
+
+type ListUsersDueForDeletionRow struct {
+	ID    uuid.UUID `json:"id"`
+	Email string    `json:"email"`
+}
+
+func (q *Queries) ListUsersDueForDeletion(ctx context.Context, limit int32) ([]ListUsersDueForDeletionRow, error) {
+	rows, err := q.db.QueryContext(ctx, listUsersDueForDeletion, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListUsersDueForDeletionRow
+	for rows.Next() {
+		var i ListUsersDueForDeletionRow
+		if err := rows.Scan(&i.ID, &i.Email); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const scheduleUserDeletion = `-- name: ScheduleUserDeletion :one
+UPDATE users SET delete_after = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING id, email, created_at, updated_at, hashed_password, is_chirpy_red, role, email_verified_at, delete_after
+`
+
+type ScheduleUserDeletionParams struct {
+	ID          uuid.UUID    `json:"id"`
+	DeleteAfter sql.NullTime `json:"delete_after"`
+}
+
+func (q *Queries) ScheduleUserDeletion(ctx context.Context, arg ScheduleUserDeletionParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, scheduleUserDeletion, arg.ID, arg.DeleteAfter)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Role,
+		&i.EmailVerifiedAt,
+		&i.DeleteAfter,
+	)
+	return i, err
+}
+
+const setUserRole = `-- name: SetUserRole :one
+UPDATE users SET role = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING id, email, created_at, updated_at, hashed_password, is_chirpy_red, role, email_verified_at, delete_after
+`
+
+type SetUserRoleParams struct {
+	ID   uuid.UUID `json:"id"`
+	Role string    `json:"role"`
+}
+
+func (q *Queries) SetUserRole(ctx context.Context, arg SetUserRoleParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setUserRole, arg.ID, arg.Role)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Role,
+		&i.EmailVerifiedAt,
+		&i.DeleteAfter,
 	)
 	return i, err
 }
@@ -128,7 +286,7 @@ func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (User, error) {
 const updateUser = `-- name: UpdateUser :one
 UPDATE users SET hashed_password = $2, email = $3
 WHERE id = $1
-RETURNING id, email, created_at, updated_at, hashed_password, is_chirpy_red
+RETURNING id, email, created_at, updated_at, hashed_password, is_chirpy_red, role, email_verified_at, delete_after
 `
 
 type UpdateUserParams struct {
@@ -147,6 +305,52 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, e
 		&i.UpdatedAt,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Role,
+		&i.EmailVerifiedAt,
+		&i.DeleteAfter,
+	)
+	return i, err
+}
+
+const updateUserPassword = `-- name: UpdateUserPassword :exec
+UPDATE users SET hashed_password = $2, updated_at = NOW()
+WHERE id = $1
+`
+
+type UpdateUserPasswordParams struct {
+	ID             uuid.UUID `json:"id"`
+	HashedPassword string    `json:"hashed_password"`
+}
+
+func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserPassword, arg.ID, arg.HashedPassword)
+	return err
+}
+
+const verifyUserEmail = `-- name: VerifyUserEmail :one
+UPDATE users SET email = $2, email_verified_at = NOW(), updated_at = NOW()
+WHERE id = $1
+RETURNING id, email, created_at, updated_at, hashed_password, is_chirpy_red, role, email_verified_at, delete_after
+`
+
+type VerifyUserEmailParams struct {
+	ID    uuid.UUID `json:"id"`
+	Email string    `json:"email"`
+}
+
+func (q *Queries) VerifyUserEmail(ctx context.Context, arg VerifyUserEmailParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, verifyUserEmail, arg.ID, arg.Email)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Role,
+		&i.EmailVerifiedAt,
+		&i.DeleteAfter,
 	)
 	return i, err
 }
@@ -0,0 +1,215 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: webauthn.sql
+
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const consumeWebAuthnSession = `-- name: ConsumeWebAuthnSession :one
+DELETE FROM webauthn_sessions
+WHERE id = $1 AND ceremony = $2 AND expires_at > NOW()
+RETURNING id, user_id, ceremony, data, created_at, expires_at
+`
+
+type ConsumeWebAuthnSessionParams struct {
+	ID       uuid.UUID `json:"id"`
+	Ceremony string    `json:"ceremony"`
+}
+
+func (q *Queries) ConsumeWebAuthnSession(ctx context.Context, arg ConsumeWebAuthnSessionParams) (WebauthnSession, error) {
+	row := q.db.QueryRowContext(ctx, consumeWebAuthnSession, arg.ID, arg.Ceremony)
+	var i WebauthnSession
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Ceremony,
+		&i.Data,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+	)
+	return i, err
+}
+
+const createWebAuthnCredential = `-- name: CreateWebAuthnCredential :one
+INSERT INTO webauthn_credentials (
+  id, user_id, name, credential_id, public_key, attestation_type, aaguid,
+  sign_count, transports, backup_eligible, backup_state, created_at, updated_at
+)
+VALUES (
+  gen_random_uuid(), $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NOW(), NOW()
+)
+RETURNING id, user_id, name, credential_id, public_key, attestation_type, aaguid, sign_count, transports, backup_eligible, backup_state, created_at, updated_at, last_used_at
+`
+
+type CreateWebAuthnCredentialParams struct {
+	UserID          uuid.UUID `json:"user_id"`
+	Name            string    `json:"name"`
+	CredentialID    []byte    `json:"credential_id"`
+	PublicKey       []byte    `json:"public_key"`
+	AttestationType string    `json:"attestation_type"`
+	Aaguid          []byte    `json:"aaguid"`
+	SignCount       int64     `json:"sign_count"`
+	Transports      []string  `json:"transports"`
+	BackupEligible  bool      `json:"backup_eligible"`
+	BackupState     bool      `json:"backup_state"`
+}
+
+func (q *Queries) CreateWebAuthnCredential(ctx context.Context, arg CreateWebAuthnCredentialParams) (WebauthnCredential, error) {
+	row := q.db.QueryRowContext(ctx, createWebAuthnCredential,
+		arg.UserID,
+		arg.Name,
+		arg.CredentialID,
+		arg.PublicKey,
+		arg.AttestationType,
+		arg.Aaguid,
+		arg.SignCount,
+		pq.Array(arg.Transports),
+		arg.BackupEligible,
+		arg.BackupState,
+	)
+	var i WebauthnCredential
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Name,
+		&i.CredentialID,
+		&i.PublicKey,
+		&i.AttestationType,
+		&i.Aaguid,
+		&i.SignCount,
+		pq.Array(&i.Transports),
+		&i.BackupEligible,
+		&i.BackupState,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.LastUsedAt,
+	)
+	return i, err
+}
+
+const createWebAuthnSession = `-- name: CreateWebAuthnSession :one
+INSERT INTO webauthn_sessions (id, user_id, ceremony, data, created_at, expires_at)
+VALUES (
+  gen_random_uuid(), $1, $2, $3, NOW(), $4
+)
+RETURNING id
+`
+
+type CreateWebAuthnSessionParams struct {
+	UserID    uuid.NullUUID   `json:"user_id"`
+	Ceremony  string          `json:"ceremony"`
+	Data      json.RawMessage `json:"data"`
+	ExpiresAt time.Time       `json:"expires_at"`
+}
+
+func (q *Queries) CreateWebAuthnSession(ctx context.Context, arg CreateWebAuthnSessionParams) (uuid.UUID, error) {
+	row := q.db.QueryRowContext(ctx, createWebAuthnSession,
+		arg.UserID,
+		arg.Ceremony,
+		arg.Data,
+		arg.ExpiresAt,
+	)
+	var id uuid.UUID
+	err := row.Scan(&id)
+	return id, err
+}
+
+const deleteExpiredWebAuthnSessions = `-- name: DeleteExpiredWebAuthnSessions :execrows
+DELETE FROM webauthn_sessions WHERE expires_at <= NOW()
+`
+
+func (q *Queries) DeleteExpiredWebAuthnSessions(ctx context.Context) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteExpiredWebAuthnSessions)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteWebAuthnCredential = `-- name: DeleteWebAuthnCredential :execrows
+DELETE FROM webauthn_credentials
+WHERE id = $1 AND user_id = $2
+`
+
+type DeleteWebAuthnCredentialParams struct {
+	ID     uuid.UUID `json:"id"`
+	UserID uuid.UUID `json:"user_id"`
+}
+
+func (q *Queries) DeleteWebAuthnCredential(ctx context.Context, arg DeleteWebAuthnCredentialParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteWebAuthnCredential, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const listWebAuthnCredentials = `-- name: ListWebAuthnCredentials :many
+SELECT id, user_id, name, credential_id, public_key, attestation_type, aaguid, sign_count, transports, backup_eligible, backup_state, created_at, updated_at, last_used_at FROM webauthn_credentials
+WHERE user_id = $1
+ORDER BY created_at
+`
+
+func (q *Queries) ListWebAuthnCredentials(ctx context.Context, userID uuid.UUID) ([]WebauthnCredential, error) {
+	rows, err := q.db.QueryContext(ctx, listWebAuthnCredentials, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []WebauthnCredential
+	for rows.Next() {
+		var i WebauthnCredential
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Name,
+			&i.CredentialID,
+			&i.PublicKey,
+			&i.AttestationType,
+			&i.Aaguid,
+			&i.SignCount,
+			pq.Array(&i.Transports),
+			&i.BackupEligible,
+			&i.BackupState,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.LastUsedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const updateWebAuthnCredentialUse = `-- name: UpdateWebAuthnCredentialUse :exec
+UPDATE webauthn_credentials
+SET sign_count = $2, backup_state = $3, last_used_at = NOW(), updated_at = NOW()
+WHERE credential_id = $1
+`
+
+type UpdateWebAuthnCredentialUseParams struct {
+	CredentialID []byte `json:"credential_id"`
+	SignCount    int64  `json:"sign_count"`
+	BackupState  bool   `json:"backup_state"`
+}
+
+func (q *Queries) UpdateWebAuthnCredentialUse(ctx context.Context, arg UpdateWebAuthnCredentialUseParams) error {
+	_, err := q.db.ExecContext(ctx, updateWebAuthnCredentialUse, arg.CredentialID, arg.SignCount, arg.BackupState)
+	return err
+}
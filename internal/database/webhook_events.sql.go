@@ -0,0 +1,203 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: webhook_events.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+)
+
+const claimFailedWebhookEvent = `-- name: ClaimFailedWebhookEvent :one
+UPDATE webhook_events
+SET status = 'processing',
+attempts = attempts + 1,
+error = NULL,
+updated_at = NOW()
+WHERE provider = $1 AND event_id = $2 AND status = 'failed'
+RETURNING provider, event_id, event_type, payload, status, error, attempts, received_at, updated_at, processed_at
+`
+
+type ClaimFailedWebhookEventParams struct {
+	Provider string `json:"provider"`
+	EventID  string `json:"event_id"`
+}
+
+func (q *Queries) ClaimFailedWebhookEvent(ctx context.Context, arg ClaimFailedWebhookEventParams) (WebhookEvent, error) {
+	row := q.db.QueryRowContext(ctx, claimFailedWebhookEvent, arg.Provider, arg.EventID)
+	var i WebhookEvent
+	err := row.Scan(
+		&i.Provider,
+		&i.EventID,
+		&i.EventType,
+		&i.Payload,
+		&i.Status,
+		&i.Error,
+		&i.Attempts,
+		&i.ReceivedAt,
+		&i.UpdatedAt,
+		&i.ProcessedAt,
+	)
+	return i, err
+}
+
+const claimWebhookEvent = `-- name: ClaimWebhookEvent :one
+INSERT INTO webhook_events (provider, event_id, event_type, payload, status, received_at, updated_at)
+VALUES (
+  $1, $2, $3, $4, 'processing', NOW(), NOW()
+)
+ON CONFLICT (provider, event_id) DO UPDATE
+SET status = 'processing',
+attempts = webhook_events.attempts + 1,
+error = NULL,
+updated_at = NOW()
+WHERE webhook_events.status = 'failed'
+OR (webhook_events.status = 'processing' AND webhook_events.updated_at < NOW() - INTERVAL '5 minutes')
+RETURNING provider, event_id, event_type, payload, status, error, attempts, received_at, updated_at, processed_at
+`
+
+type ClaimWebhookEventParams struct {
+	Provider  string `json:"provider"`
+	EventID   string `json:"event_id"`
+	EventType string `json:"event_type"`
+	Payload   string `json:"payload"`
+}
+
+// Records a newly received event, or takes over one whose earlier delivery
+// failed or was abandoned mid-way. Returns no rows for an event that is
+// already processed or being processed.
+func (q *Queries) ClaimWebhookEvent(ctx context.Context, arg ClaimWebhookEventParams) (WebhookEvent, error) {
+	row := q.db.QueryRowContext(ctx, claimWebhookEvent,
+		arg.Provider,
+		arg.EventID,
+		arg.EventType,
+		arg.Payload,
+	)
+	var i WebhookEvent
+	err := row.Scan(
+		&i.Provider,
+		&i.EventID,
+		&i.EventType,
+		&i.Payload,
+		&i.Status,
+		&i.Error,
+		&i.Attempts,
+		&i.ReceivedAt,
+		&i.UpdatedAt,
+		&i.ProcessedAt,
+	)
+	return i, err
+}
+
+const completeWebhookEvent = `-- name: CompleteWebhookEvent :exec
+UPDATE webhook_events
+SET status = 'processed',
+processed_at = NOW(),
+updated_at = NOW()
+WHERE provider = $1 AND event_id = $2
+`
+
+type CompleteWebhookEventParams struct {
+	Provider string `json:"provider"`
+	EventID  string `json:"event_id"`
+}
+
+func (q *Queries) CompleteWebhookEvent(ctx context.Context, arg CompleteWebhookEventParams) error {
+	_, err := q.db.ExecContext(ctx, completeWebhookEvent, arg.Provider, arg.EventID)
+	return err
+}
+
+const failWebhookEvent = `-- name: FailWebhookEvent :exec
+UPDATE webhook_events
+SET status = 'failed',
+error = $3,
+updated_at = NOW()
+WHERE provider = $1 AND event_id = $2
+`
+
+type FailWebhookEventParams struct {
+	Provider string         `json:"provider"`
+	EventID  string         `json:"event_id"`
+	Error    sql.NullString `json:"error"`
+}
+
+func (q *Queries) FailWebhookEvent(ctx context.Context, arg FailWebhookEventParams) error {
+	_, err := q.db.ExecContext(ctx, failWebhookEvent, arg.Provider, arg.EventID, arg.Error)
+	return err
+}
+
+const getWebhookEvent = `-- name: GetWebhookEvent :one
+SELECT provider, event_id, event_type, payload, status, error, attempts, received_at, updated_at, processed_at FROM webhook_events
+WHERE provider = $1 AND event_id = $2
+`
+
+type GetWebhookEventParams struct {
+	Provider string `json:"provider"`
+	EventID  string `json:"event_id"`
+}
+
+func (q *Queries) GetWebhookEvent(ctx context.Context, arg GetWebhookEventParams) (WebhookEvent, error) {
+	row := q.db.QueryRowContext(ctx, getWebhookEvent, arg.Provider, arg.EventID)
+	var i WebhookEvent
+	err := row.Scan(
+		&i.Provider,
+		&i.EventID,
+		&i.EventType,
+		&i.Payload,
+		&i.Status,
+		&i.Error,
+		&i.Attempts,
+		&i.ReceivedAt,
+		&i.UpdatedAt,
+		&i.ProcessedAt,
+	)
+	return i, err
+}
+
+const listWebhookEventsByStatus = `-- name: ListWebhookEventsByStatus :many
+SELECT provider, event_id, event_type, payload, status, error, attempts, received_at, updated_at, processed_at FROM webhook_events
+WHERE status = $1
+ORDER BY received_at DESC
+LIMIT $2
+`
+
+type ListWebhookEventsByStatusParams struct {
+	Status string `json:"status"`
+	Limit  int32  `json:"limit"`
+}
+
+func (q *Queries) ListWebhookEventsByStatus(ctx context.Context, arg ListWebhookEventsByStatusParams) ([]WebhookEvent, error) {
+	rows, err := q.db.QueryContext(ctx, listWebhookEventsByStatus, arg.Status, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []WebhookEvent
+	for rows.Next() {
+		var i WebhookEvent
+		if err := rows.Scan(
+			&i.Provider,
+			&i.EventID,
+			&i.EventType,
+			&i.Payload,
+			&i.Status,
+			&i.Error,
+			&i.Attempts,
+			&i.ReceivedAt,
+			&i.UpdatedAt,
+			&i.ProcessedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -0,0 +1,143 @@
+// Package export writes the archive users download to take their data with
+// them.
+package export
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"html/template"
+	"io"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Profile struct {
+	ID              uuid.UUID  `json:"id"`
+	Email           string     `json:"email"`
+	Role            string     `json:"role"`
+	IsChirpyRed     bool       `json:"is_chirpy_red"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+type Chirp struct {
+	ID                uuid.UUID  `json:"id"`
+	Body              string     `json:"body"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+	ImportedCreatedAt *time.Time `json:"imported_created_at,omitempty"`
+}
+
+// Session is a login or OAuth grant. Token values are never exported.
+type Session struct {
+	ID        uuid.UUID  `json:"id"`
+	ClientID  *uuid.UUID `json:"oauth_client_id,omitempty"`
+	Scopes    []string   `json:"scopes,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+}
+
+type APIKey struct {
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+type Passkey struct {
+	Name       string     `json:"name"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+type Data struct {
+	Profile  Profile
+	Chirps   []Chirp
+	Sessions []Session
+	APIKeys  []APIKey
+	Passkeys []Passkey
+}
+
+var chirpsIndex = template.Must(template.New("chirps").Parse(`<!DOCTYPE html>
+<html>
+  <head>
+    <meta charset="utf-8" />
+    <title>Chirps by {{.Profile.Email}}</title>
+  </head>
+  <body>
+    <h1>Chirps by {{.Profile.Email}}</h1>
+    <p>{{len .Chirps}} chirps, newest first.</p>
+    {{- range .Chirps}}
+    <article>
+      <p>{{.Body}}</p>
+      <time datetime="{{.CreatedAt.UTC.Format "2006-01-02T15:04:05Z07:00"}}">{{.CreatedAt.UTC.Format "January 2, 2006 15:04 MST"}}</time>
+    </article>
+    {{- end}}
+  </body>
+</html>
+`))
+
+const readme = `This archive holds your Chirpy data.
+
+profile.json   Your account
+chirps.json    Your chirps
+chirps.html    Your chirps, readable in a browser
+sessions.json  Logins and apps you authorized, without their tokens
+api_keys.json  Your personal API keys, without the keys themselves
+passkeys.json  Your registered passkeys
+`
+
+// Write writes data to w as a ZIP archive.
+func Write(w io.Writer, data Data) error {
+	archive := zip.NewWriter(w)
+
+	files := []struct {
+		name  string
+		write func(io.Writer) error
+	}{
+		{"README.txt", func(f io.Writer) error {
+			_, err := io.WriteString(f, readme)
+			return err
+		}},
+		{"profile.json", writeJSON(data.Profile)},
+		{"chirps.json", writeJSON(nonNil(data.Chirps))},
+		{"chirps.html", func(f io.Writer) error { return chirpsIndex.Execute(f, data) }},
+		{"sessions.json", writeJSON(nonNil(data.Sessions))},
+		{"api_keys.json", writeJSON(nonNil(data.APIKeys))},
+		{"passkeys.json", writeJSON(nonNil(data.Passkeys))},
+	}
+
+	for _, file := range files {
+		f, err := archive.Create(file.name)
+		if err != nil {
+			return err
+		}
+
+		err = file.write(f)
+		if err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+func writeJSON(v any) func(io.Writer) error {
+	return func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(v)
+	}
+}
+
+// nonNil makes empty lists show up as [] rather than null.
+func nonNil[T any](items []T) []T {
+	if items == nil {
+		return []T{}
+	}
+	return items
+}
@@ -0,0 +1,87 @@
+package export_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"chirpy/internal/export"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func readArchive(t *testing.T, data export.Data) map[string]string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	err := export.Write(&buf, data)
+	if err != nil {
+		t.Fatalf("Failed to write archive: %v", err)
+	}
+
+	reader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Failed to read archive: %v", err)
+	}
+
+	files := map[string]string{}
+	for _, file := range reader.File {
+		f, err := file.Open()
+		if err != nil {
+			t.Fatalf("Failed to open %s: %v", file.Name, err)
+		}
+		content, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", file.Name, err)
+		}
+		files[file.Name] = string(content)
+	}
+	return files
+}
+
+func TestWriteIncludesEveryFile(t *testing.T) {
+	now := time.Now()
+	files := readArchive(t, export.Data{
+		Profile: export.Profile{ID: uuid.New(), Email: "export@example.com", CreatedAt: now, UpdatedAt: now},
+		Chirps: []export.Chirp{
+			{ID: uuid.New(), Body: "hello world", CreatedAt: now, UpdatedAt: now},
+		},
+	})
+
+	for _, name := range []string{"README.txt", "profile.json", "chirps.json", "chirps.html", "sessions.json", "api_keys.json", "passkeys.json"} {
+		if _, ok := files[name]; !ok {
+			t.Fatalf("Expected %s in the archive", name)
+		}
+	}
+
+	var chirps []export.Chirp
+	err := json.Unmarshal([]byte(files["chirps.json"]), &chirps)
+	if err != nil {
+		t.Fatalf("Failed to decode chirps.json: %v", err)
+	}
+	if len(chirps) != 1 || chirps[0].Body != "hello world" {
+		t.Fatalf("Unexpected chirps %+v", chirps)
+	}
+
+	if strings.TrimSpace(files["sessions.json"]) != "[]" {
+		t.Fatalf("Expected no sessions to be an empty list, got %s", files["sessions.json"])
+	}
+}
+
+func TestWriteEscapesChirpsInHTML(t *testing.T) {
+	files := readArchive(t, export.Data{
+		Profile: export.Profile{Email: "export@example.com"},
+		Chirps:  []export.Chirp{{Body: "<script>alert(1)</script>"}},
+	})
+
+	if strings.Contains(files["chirps.html"], "<script>") {
+		t.Fatal("Expected chirp bodies to be escaped in chirps.html")
+	}
+	if !strings.Contains(files["chirps.html"], "&lt;script&gt;") {
+		t.Fatal("Expected the escaped chirp body in chirps.html")
+	}
+}
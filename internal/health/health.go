@@ -0,0 +1,141 @@
+// Package health tracks whether the server should be sent traffic.
+package health
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Statuses of a Report and of each check in it.
+const (
+	StatusOK       = "ok"
+	StatusFailed   = "failed"
+	StatusDraining = "draining"
+)
+
+// Check reports whether something the server depends on is usable. It should
+// give up once ctx is done.
+type Check func(ctx context.Context) error
+
+// CheckResult is the outcome of one check. Errors are logged rather than
+// returned, since readiness probes are public.
+type CheckResult struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+}
+
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// Ready reports whether every check passed and the server is not draining.
+func (r Report) Ready() bool {
+	return r.Status == StatusOK
+}
+
+// Readiness reports whether the server is ready for new requests: it runs the
+// registered checks, and stops being ready once Drain is called at shutdown,
+// so load balancers move traffic elsewhere while the requests in flight
+// finish.
+type Readiness struct {
+	// Timeout bounds each check. Zero leaves them bounded only by the
+	// caller's context.
+	Timeout time.Duration
+	// CacheFor is how long a report is reused, so frequent probes from
+	// several load balancers do not each reach the database.
+	CacheFor time.Duration
+
+	draining atomic.Bool
+
+	mu        sync.Mutex
+	checks    []namedCheck
+	report    Report
+	checkedAt time.Time
+}
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Register adds a check. Call it before the server starts.
+func (r *Readiness) Register(name string, check Check) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checks = append(r.checks, namedCheck{name: name, check: check})
+}
+
+// Drain marks the server as shutting down. There is no way back.
+func (r *Readiness) Drain() {
+	r.draining.Store(true)
+}
+
+// Draining reports whether Drain has been called.
+func (r *Readiness) Draining() bool {
+	return r.draining.Load()
+}
+
+// Check runs every registered check at once, or returns the last report if it
+// is more recent than CacheFor. Callers that arrive while checks are running
+// wait for them and share the result.
+func (r *Readiness) Check(ctx context.Context) Report {
+	if r.Draining() {
+		return Report{Status: StatusDraining}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.checkedAt.IsZero() && time.Since(r.checkedAt) < r.CacheFor {
+		return r.report
+	}
+
+	// The report is shared, so a probe that hangs up must not fail it.
+	ctx = context.WithoutCancel(ctx)
+
+	results := make([]CheckResult, len(r.checks))
+	var wg sync.WaitGroup
+	for i, c := range r.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = r.run(ctx, c)
+		}()
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]CheckResult, len(r.checks))}
+	for i, c := range r.checks {
+		report.Checks[c.name] = results[i]
+		if results[i].Status != StatusOK {
+			report.Status = StatusFailed
+		}
+	}
+
+	r.report = report
+	r.checkedAt = time.Now()
+	return report
+}
+
+func (r *Readiness) run(ctx context.Context, c namedCheck) CheckResult {
+	if r.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.Timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	err := c.check(ctx)
+	result := CheckResult{
+		Status:    StatusOK,
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		slog.WarnContext(ctx, "readiness check failed", "check", c.name, "error", err)
+		result.Status = StatusFailed
+	}
+	return result
+}
@@ -0,0 +1,71 @@
+package health_test
+
+import (
+	"chirpy/internal/health"
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReadinessRunsChecks(t *testing.T) {
+	readiness := &health.Readiness{Timeout: 10 * time.Millisecond}
+	readiness.Register("database", func(context.Context) error { return nil })
+	readiness.Register("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	readiness.Register("broken", func(context.Context) error { return errors.New("boom") })
+
+	report := readiness.Check(context.Background())
+	if report.Ready() || report.Status != health.StatusFailed {
+		t.Fatalf("Expected the report to fail, got %+v", report)
+	}
+
+	want := map[string]string{
+		"database": health.StatusOK,
+		"slow":     health.StatusFailed,
+		"broken":   health.StatusFailed,
+	}
+	for name, status := range want {
+		if got := report.Checks[name].Status; got != status {
+			t.Fatalf("Expected check %s to be %s, got %s", name, status, got)
+		}
+	}
+	if report.Checks["slow"].LatencyMS < 10 {
+		t.Fatalf("Expected the slow check to take at least its timeout, got %vms", report.Checks["slow"].LatencyMS)
+	}
+}
+
+func TestReadinessCachesReports(t *testing.T) {
+	var runs atomic.Int32
+	readiness := &health.Readiness{CacheFor: time.Hour}
+	readiness.Register("database", func(context.Context) error {
+		runs.Add(1)
+		return nil
+	})
+
+	for range 3 {
+		report := readiness.Check(context.Background())
+		if !report.Ready() {
+			t.Fatalf("Expected the report to pass, got %+v", report)
+		}
+	}
+	if runs.Load() != 1 {
+		t.Fatalf("Expected one run within the cache period, got %d", runs.Load())
+	}
+}
+
+func TestReadinessDrain(t *testing.T) {
+	var readiness health.Readiness
+	if !readiness.Check(context.Background()).Ready() {
+		t.Fatalf("Expected a Readiness without checks to be ready")
+	}
+
+	readiness.Drain()
+	report := readiness.Check(context.Background())
+	if report.Ready() || report.Status != health.StatusDraining {
+		t.Fatalf("Expected a draining report, got %+v", report)
+	}
+}
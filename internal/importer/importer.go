@@ -0,0 +1,265 @@
+// Package importer reads chirps out of the archives users bring with them:
+// chirps.json from a Chirpy export, JSON Lines, CSV, or tweets.js from a
+// Twitter archive.
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"time"
+)
+
+type Format string
+
+const (
+	// FormatJSON is a JSON array of records, like chirps.json in an export.
+	FormatJSON Format = "json"
+	// FormatJSONL is one JSON record per line.
+	FormatJSONL Format = "jsonl"
+	// FormatCSV has a header row with a body column and an optional
+	// created_at column.
+	FormatCSV Format = "csv"
+	// FormatTweets is tweets.js from a Twitter archive.
+	FormatTweets Format = "tweets"
+)
+
+var (
+	ErrUnknownFormat = errors.New("unknown import format")
+	ErrMissingBody   = errors.New("body is missing")
+)
+
+// Record is one chirp read from an archive. Line is the line number for JSON
+// Lines and CSV, and the position in the array for JSON and tweets.js, both
+// counting from 1. Records that could not be read carry Err instead of a body.
+type Record struct {
+	Line      int
+	Body      string
+	CreatedAt *time.Time
+	Err       error
+}
+
+// ParseFormat maps a format name, a file name or a Content-Type to a Format.
+func ParseFormat(value string) (Format, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if mediaType, _, found := strings.Cut(value, ";"); found {
+		value = strings.TrimSpace(mediaType)
+	}
+
+	switch {
+	case value == "json", value == "application/json", strings.HasSuffix(value, ".json"):
+		return FormatJSON, nil
+	case value == "jsonl", value == "ndjson", value == "application/jsonl", value == "application/x-ndjson",
+		strings.HasSuffix(value, ".jsonl"), strings.HasSuffix(value, ".ndjson"):
+		return FormatJSONL, nil
+	case value == "csv", value == "text/csv", strings.HasSuffix(value, ".csv"):
+		return FormatCSV, nil
+	case value == "tweets", value == "text/javascript", value == "application/javascript", strings.HasSuffix(value, ".js"):
+		return FormatTweets, nil
+	}
+	return "", fmt.Errorf("%w: %q", ErrUnknownFormat, value)
+}
+
+// Parse reads every record from r. Problems with single records are reported
+// on the record; the error is for archives that cannot be read at all.
+func Parse(r io.Reader, format Format) ([]Record, error) {
+	switch format {
+	case FormatJSON:
+		return parseJSON(r)
+	case FormatJSONL:
+		return parseJSONL(r)
+	case FormatCSV:
+		return parseCSV(r)
+	case FormatTweets:
+		return parseTweets(r)
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+}
+
+// jsonRecord is a chirp as a Chirpy export writes it. An exported chirp that
+// was itself imported keeps its original time in imported_created_at.
+type jsonRecord struct {
+	Body              *string    `json:"body"`
+	CreatedAt         *time.Time `json:"created_at"`
+	ImportedCreatedAt *time.Time `json:"imported_created_at"`
+}
+
+func (j jsonRecord) record(line int) Record {
+	if j.Body == nil {
+		return Record{Line: line, Err: ErrMissingBody}
+	}
+
+	createdAt := j.CreatedAt
+	if j.ImportedCreatedAt != nil {
+		createdAt = j.ImportedCreatedAt
+	}
+	return Record{Line: line, Body: *j.Body, CreatedAt: createdAt}
+}
+
+func parseJSON(r io.Reader) ([]Record, error) {
+	var items []json.RawMessage
+	err := json.NewDecoder(r).Decode(&items)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON array: %w", err)
+	}
+
+	records := make([]Record, 0, len(items))
+	for i, item := range items {
+		var j jsonRecord
+		err = json.Unmarshal(item, &j)
+		if err != nil {
+			records = append(records, Record{Line: i + 1, Err: err})
+			continue
+		}
+		records = append(records, j.record(i+1))
+	}
+	return records, nil
+}
+
+func parseJSONL(r io.Reader) ([]Record, error) {
+	var records []Record
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+
+		var j jsonRecord
+		err := json.Unmarshal(text, &j)
+		if err != nil {
+			records = append(records, Record{Line: line, Err: err})
+			continue
+		}
+		records = append(records, j.record(line))
+	}
+
+	err := scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+func parseCSV(r io.Reader) ([]Record, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV header: %w", err)
+	}
+
+	bodyColumn, createdAtColumn := -1, -1
+	for i, name := range header {
+		switch strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))) {
+		case "body":
+			bodyColumn = i
+		case "created_at":
+			createdAtColumn = i
+		}
+	}
+	if bodyColumn == -1 {
+		return nil, errors.New("CSV header has no body column")
+	}
+
+	var records []Record
+	for {
+		fields, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return records, nil
+		}
+
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			records = append(records, Record{Line: parseErr.StartLine, Err: parseErr.Err})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		line, _ := reader.FieldPos(0)
+		if bodyColumn >= len(fields) {
+			records = append(records, Record{Line: line, Err: ErrMissingBody})
+			continue
+		}
+
+		record := Record{Line: line, Body: fields[bodyColumn]}
+		if createdAtColumn != -1 && createdAtColumn < len(fields) && fields[createdAtColumn] != "" {
+			createdAt, err := time.Parse(time.RFC3339, fields[createdAtColumn])
+			if err != nil {
+				records = append(records, Record{Line: line, Err: fmt.Errorf("invalid created_at: %w", err)})
+				continue
+			}
+			record.CreatedAt = &createdAt
+		}
+		records = append(records, record)
+	}
+}
+
+// tweetRecord is an entry of tweets.js. Older archives have the tweet at the
+// top level, newer ones wrap it in "tweet".
+type tweetRecord struct {
+	Tweet     *tweetRecord `json:"tweet"`
+	FullText  *string      `json:"full_text"`
+	CreatedAt string       `json:"created_at"`
+}
+
+func parseTweets(r io.Reader) ([]Record, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// tweets.js assigns the array to a global: window.YTD.tweets.part0 = [...]
+	start := bytes.IndexByte(content, '[')
+	if start == -1 {
+		return nil, errors.New("tweets.js has no array of tweets")
+	}
+
+	var items []json.RawMessage
+	err = json.Unmarshal(content[start:], &items)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tweets.js: %w", err)
+	}
+
+	records := make([]Record, 0, len(items))
+	for i, item := range items {
+		var tweet tweetRecord
+		err = json.Unmarshal(item, &tweet)
+		if err != nil {
+			records = append(records, Record{Line: i + 1, Err: err})
+			continue
+		}
+		if tweet.Tweet != nil {
+			tweet = *tweet.Tweet
+		}
+
+		if tweet.FullText == nil {
+			records = append(records, Record{Line: i + 1, Err: ErrMissingBody})
+			continue
+		}
+
+		// Tweet text comes HTML-escaped.
+		record := Record{Line: i + 1, Body: html.UnescapeString(*tweet.FullText)}
+		if tweet.CreatedAt != "" {
+			createdAt, err := time.Parse(time.RubyDate, tweet.CreatedAt)
+			if err != nil {
+				records = append(records, Record{Line: i + 1, Err: fmt.Errorf("invalid created_at: %w", err)})
+				continue
+			}
+			record.CreatedAt = &createdAt
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
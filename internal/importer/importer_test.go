@@ -0,0 +1,131 @@
+package importer_test
+
+import (
+	"chirpy/internal/importer"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func parse(t *testing.T, format importer.Format, input string) []importer.Record {
+	t.Helper()
+
+	records, err := importer.Parse(strings.NewReader(input), format)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	return records
+}
+
+func TestParseJSONPrefersImportedCreatedAt(t *testing.T) {
+	records := parse(t, importer.FormatJSON, `[
+		{"body": "first", "created_at": "2024-05-01T10:00:00Z"},
+		{"body": "second", "created_at": "2024-05-02T10:00:00Z", "imported_created_at": "2019-01-01T00:00:00Z"},
+		{"created_at": "2024-05-03T10:00:00Z"}
+	]`)
+
+	if len(records) != 3 {
+		t.Fatalf("Expected 3 records, got %d", len(records))
+	}
+	if records[0].Body != "first" || !records[0].CreatedAt.Equal(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)) {
+		t.Fatalf("Unexpected first record %+v", records[0])
+	}
+	if !records[1].CreatedAt.Equal(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("Expected the original time of an imported chirp, got %v", records[1].CreatedAt)
+	}
+	if !errors.Is(records[2].Err, importer.ErrMissingBody) {
+		t.Fatalf("Expected ErrMissingBody, got %v", records[2].Err)
+	}
+}
+
+func TestParseJSONLReportsLineNumbers(t *testing.T) {
+	records := parse(t, importer.FormatJSONL, "{\"body\": \"one\"}\n\n{not json\n{\"body\": \"three\"}\n")
+
+	if len(records) != 3 {
+		t.Fatalf("Expected 3 records, got %d", len(records))
+	}
+	if records[0].Line != 1 || records[0].Body != "one" || records[0].CreatedAt != nil {
+		t.Fatalf("Unexpected first record %+v", records[0])
+	}
+	if records[1].Line != 3 || records[1].Err == nil {
+		t.Fatalf("Expected an error on line 3, got %+v", records[1])
+	}
+	if records[2].Line != 4 || records[2].Body != "three" {
+		t.Fatalf("Unexpected last record %+v", records[2])
+	}
+}
+
+func TestParseCSV(t *testing.T) {
+	records := parse(t, importer.FormatCSV, "created_at,body\n"+
+		"2024-05-01T10:00:00Z,\"hello, world\"\n"+
+		"yesterday,bad date\n"+
+		",\"spans\ntwo lines\"\n")
+
+	if len(records) != 3 {
+		t.Fatalf("Expected 3 records, got %d", len(records))
+	}
+	if records[0].Line != 2 || records[0].Body != "hello, world" || records[0].CreatedAt == nil {
+		t.Fatalf("Unexpected first record %+v", records[0])
+	}
+	if records[1].Line != 3 || records[1].Err == nil {
+		t.Fatalf("Expected an invalid created_at on line 3, got %+v", records[1])
+	}
+	if records[2].Line != 4 || records[2].Body != "spans\ntwo lines" || records[2].CreatedAt != nil {
+		t.Fatalf("Unexpected last record %+v", records[2])
+	}
+}
+
+func TestParseCSVRequiresBodyColumn(t *testing.T) {
+	_, err := importer.Parse(strings.NewReader("text\nhello\n"), importer.FormatCSV)
+	if err == nil {
+		t.Fatal("Expected a CSV without a body column to be rejected")
+	}
+}
+
+func TestParseTweets(t *testing.T) {
+	records := parse(t, importer.FormatTweets, `window.YTD.tweets.part0 = [
+		{"tweet": {"full_text": "fish &amp; chips", "created_at": "Wed Oct 10 20:19:24 +0000 2018"}},
+		{"full_text": "an old archive"},
+		{"tweet": {"id": "1"}}
+	]`)
+
+	if len(records) != 3 {
+		t.Fatalf("Expected 3 records, got %d", len(records))
+	}
+	if records[0].Body != "fish & chips" {
+		t.Fatalf("Expected the tweet text to be unescaped, got %q", records[0].Body)
+	}
+	if !records[0].CreatedAt.Equal(time.Date(2018, 10, 10, 20, 19, 24, 0, time.UTC)) {
+		t.Fatalf("Unexpected created_at %v", records[0].CreatedAt)
+	}
+	if records[1].Line != 2 || records[1].Body != "an old archive" {
+		t.Fatalf("Unexpected second record %+v", records[1])
+	}
+	if !errors.Is(records[2].Err, importer.ErrMissingBody) {
+		t.Fatalf("Expected ErrMissingBody, got %v", records[2].Err)
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	tests := map[string]importer.Format{
+		"jsonl":                   importer.FormatJSONL,
+		"application/x-ndjson":    importer.FormatJSONL,
+		"text/csv; charset=utf-8": importer.FormatCSV,
+		"chirps.json":             importer.FormatJSON,
+		"tweets.js":               importer.FormatTweets,
+		"application/javascript":  importer.FormatTweets,
+	}
+
+	for value, expected := range tests {
+		format, err := importer.ParseFormat(value)
+		if err != nil || format != expected {
+			t.Fatalf("ParseFormat(%q) = %q, %v; expected %q", value, format, err, expected)
+		}
+	}
+
+	_, err := importer.ParseFormat("application/pdf")
+	if !errors.Is(err, importer.ErrUnknownFormat) {
+		t.Fatalf("Expected ErrUnknownFormat, got %v", err)
+	}
+}
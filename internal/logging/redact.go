@@ -0,0 +1,94 @@
+package logging
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// Redacted replaces secrets in logs.
+const Redacted = "[REDACTED]"
+
+// sensitiveKeys are attribute names whose values are never logged, matched
+// case-insensitively against the whole key or its end, so refresh_token and
+// client_secret are covered too.
+var sensitiveKeys = []string{
+	"password",
+	"token",
+	"secret",
+	"api_key",
+	"apikey",
+	"authorization",
+	"cookie",
+	"signature",
+}
+
+// secretPatterns find credentials inside free text, such as error messages or
+// lines written through the standard log package.
+var secretPatterns = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	// Credentials after an auth scheme keep the scheme for context.
+	{regexp.MustCompile(`(?i)\b(bearer|apikey|basic)(\s+)[^\s,;"']+`), "${1}${2}" + Redacted},
+	// JWTs: header, payload and signature.
+	{regexp.MustCompile(`eyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]*\.[A-Za-z0-9_-]*`), Redacted},
+	// Personal API keys.
+	{regexp.MustCompile(`chirpy_[a-z2-7]{20,}`), Redacted},
+	// Webhook signing secrets.
+	{regexp.MustCompile(`whsec_[0-9a-f]+`), Redacted},
+	// Refresh tokens and other random hex tokens.
+	{regexp.MustCompile(`\b[0-9a-fA-F]{40,}\b`), Redacted},
+	// key=value pairs, as in query strings.
+	{regexp.MustCompile(`(?i)\b((?:password|token|secret|api_key|signature|code)=)[^\s&"']+`), "${1}" + Redacted},
+}
+
+// Redact removes anything that looks like a credential from text.
+func Redact(text string) string {
+	for _, secret := range secretPatterns {
+		text = secret.pattern.ReplaceAllString(text, secret.replacement)
+	}
+	return text
+}
+
+func isSensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	// Authorization and 2FA codes. Only the exact key, so status_code is
+	// still logged.
+	if key == "code" {
+		return true
+	}
+	for _, sensitive := range sensitiveKeys {
+		if key == sensitive || strings.HasSuffix(key, "_"+sensitive) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactAttr is the ReplaceAttr hook of the JSON handler. It sees every
+// attribute, the message included, after LogValuers have been resolved.
+func redactAttr(groups []string, attr slog.Attr) slog.Attr {
+	if attr.Value.Kind() == slog.KindGroup {
+		return attr
+	}
+
+	if len(groups) == 0 && (attr.Key == slog.TimeKey || attr.Key == slog.LevelKey) {
+		return attr
+	}
+
+	if isSensitiveKey(attr.Key) {
+		return slog.String(attr.Key, Redacted)
+	}
+
+	switch attr.Value.Kind() {
+	case slog.KindString:
+		return slog.String(attr.Key, Redact(attr.Value.String()))
+	case slog.KindAny:
+		// Structs and errors are logged as text so nothing inside them can
+		// get past the patterns.
+		return slog.String(attr.Key, Redact(fmt.Sprint(attr.Value.Any())))
+	}
+	return attr
+}
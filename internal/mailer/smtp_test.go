@@ -0,0 +1,141 @@
+package mailer_test
+
+import (
+	"bufio"
+	"chirpy/internal/mailer"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// smtpStandIn is a minimal SMTP server that accepts a single message and
+// records the envelope and data it received.
+type smtpStandIn struct {
+	listener net.Listener
+	from     string
+	to       []string
+	data     string
+	done     chan struct{}
+}
+
+func newSMTPStandIn(t *testing.T) *smtpStandIn {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	s := &smtpStandIn{listener: listener, done: make(chan struct{})}
+	go s.serve()
+	return s
+}
+
+func (s *smtpStandIn) addr() (string, string) {
+	host, port, _ := net.SplitHostPort(s.listener.Addr().String())
+	return host, port
+}
+
+func (s *smtpStandIn) serve() {
+	defer close(s.done)
+
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	reply := func(line string) { fmt.Fprintf(conn, "%s\r\n", line) }
+
+	reply("220 localhost ESMTP stand-in")
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		command := strings.ToUpper(line)
+
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(command, "MAIL FROM:"):
+			s.from = strings.Trim(line[len("MAIL FROM:"):], "<> ")
+			reply("250 OK")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			s.to = append(s.to, strings.Trim(line[len("RCPT TO:"):], "<> "))
+			reply("250 OK")
+		case command == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				dataLine, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if dataLine == ".\r\n" {
+					break
+				}
+				data.WriteString(dataLine)
+			}
+			s.data = data.String()
+			reply("250 OK")
+		case command == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+func TestSMTPMailerSend(t *testing.T) {
+	server := newSMTPStandIn(t)
+	host, port := server.addr()
+
+	m := mailer.NewSMTPMailer(host, port, "", "", "noreply@chirpy.test")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := m.Send(ctx, mailer.Message{
+		To:      "user@example.com",
+		Subject: "Confirm your email for Chirpy",
+		Body:    "Follow this link:\nhttp://localhost:8080/app/verify-email.html?token=abc",
+	})
+	if err != nil {
+		t.Fatalf("Failed to send email: %v", err)
+	}
+
+	<-server.done
+
+	if server.from != "noreply@chirpy.test" {
+		t.Fatalf("Unexpected envelope sender: %q", server.from)
+	}
+	if len(server.to) != 1 || server.to[0] != "user@example.com" {
+		t.Fatalf("Unexpected envelope recipients: %v", server.to)
+	}
+	if !strings.Contains(server.data, "Subject: Confirm your email for Chirpy\r\n") {
+		t.Fatalf("Expected subject header in message, got %q", server.data)
+	}
+	if !strings.Contains(server.data, "verify-email.html?token=abc") {
+		t.Fatalf("Expected verification link in message, got %q", server.data)
+	}
+}
+
+func TestSMTPMailerRejectsHeaderInjection(t *testing.T) {
+	m := mailer.NewSMTPMailer("127.0.0.1", "1", "", "", "noreply@chirpy.test")
+
+	err := m.Send(context.Background(), mailer.Message{
+		To:      "user@example.com\r\nBcc: everyone@example.com",
+		Subject: "Hello",
+	})
+	if err == nil {
+		t.Fatalf("Expected recipient with CRLF to be rejected")
+	}
+}
@@ -0,0 +1,126 @@
+// Package passkey runs the WebAuthn registration and login ceremonies for
+// passkeys. Credentials are discoverable, require user verification and are
+// registered without attestation, so a passkey login stands in for both the
+// password and the second factor.
+package passkey
+
+import (
+	"errors"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+)
+
+// ErrClonedAuthenticator is returned when an assertion's signature counter
+// does not move forward, which means the private key may have been copied.
+var ErrClonedAuthenticator = errors.New("signature counter did not increase, the authenticator may be cloned")
+
+// User is a chirpy user as the WebAuthn relying party sees them. The user
+// handle stored on the authenticator is the user's UUID.
+type User struct {
+	ID          uuid.UUID
+	Email       string
+	Credentials []webauthn.Credential
+}
+
+func (u *User) WebAuthnID() []byte {
+	return u.ID[:]
+}
+
+func (u *User) WebAuthnName() string {
+	return u.Email
+}
+
+func (u *User) WebAuthnDisplayName() string {
+	return u.Email
+}
+
+func (u *User) WebAuthnCredentials() []webauthn.Credential {
+	return u.Credentials
+}
+
+type Service struct {
+	webAuthn *webauthn.WebAuthn
+}
+
+// NewService creates a relying party for rpID, usually the host name of the
+// site, accepting ceremonies from the given origins.
+func NewService(rpID, rpDisplayName string, origins []string) (*Service, error) {
+	webAuthn, err := webauthn.New(&webauthn.Config{
+		RPID:          rpID,
+		RPDisplayName: rpDisplayName,
+		RPOrigins:     origins,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Service{webAuthn: webAuthn}, nil
+}
+
+// BeginRegistration returns the options for navigator.credentials.create and
+// the session to hand back to FinishRegistration. The user's existing
+// credentials are excluded so an authenticator is not registered twice.
+func (s *Service) BeginRegistration(user *User) (*protocol.CredentialCreation, *webauthn.SessionData, error) {
+	return s.webAuthn.BeginRegistration(user,
+		webauthn.WithExclusions(webauthn.Credentials(user.Credentials).CredentialDescriptors()),
+		webauthn.WithAuthenticatorSelection(protocol.AuthenticatorSelection{
+			ResidentKey:        protocol.ResidentKeyRequirementRequired,
+			RequireResidentKey: protocol.ResidentKeyRequired(),
+			UserVerification:   protocol.VerificationRequired,
+		}),
+		webauthn.WithConveyancePreference(protocol.PreferNoAttestation),
+	)
+}
+
+// FinishRegistration verifies the JSON-encoded PublicKeyCredential returned
+// by navigator.credentials.create and returns the credential to store.
+func (s *Service) FinishRegistration(user *User, session webauthn.SessionData, response []byte) (*webauthn.Credential, error) {
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(response)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.webAuthn.CreateCredential(user, session, parsed)
+}
+
+// BeginLogin returns the options for navigator.credentials.get. No user is
+// named: the authenticator offers the passkeys it holds for this site.
+func (s *Service) BeginLogin() (*protocol.CredentialAssertion, *webauthn.SessionData, error) {
+	return s.webAuthn.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+}
+
+// FinishLogin verifies the JSON-encoded PublicKeyCredential returned by
+// navigator.credentials.get. lookup loads the user named by the credential's
+// user handle, along with their credentials. The returned credential carries
+// the updated signature counter and backup state to store.
+func (s *Service) FinishLogin(session webauthn.SessionData, response []byte, lookup func(userID uuid.UUID) (*User, error)) (*User, *webauthn.Credential, error) {
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(response)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var user *User
+	_, credential, err := s.webAuthn.ValidatePasskeyLogin(func(_, userHandle []byte) (webauthn.User, error) {
+		userID, err := uuid.FromBytes(userHandle)
+		if err != nil {
+			return nil, err
+		}
+
+		user, err = lookup(userID)
+		if err != nil {
+			return nil, err
+		}
+		return user, nil
+	}, session, parsed)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if credential.Authenticator.CloneWarning {
+		return nil, nil, ErrClonedAuthenticator
+	}
+
+	return user, credential, nil
+}
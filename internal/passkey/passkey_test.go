@@ -0,0 +1,291 @@
+package passkey_test
+
+import (
+	"chirpy/internal/passkey"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+)
+
+const (
+	testRPID   = "chirpy.example"
+	testOrigin = "https://chirpy.example"
+)
+
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttestedData = 0x40
+)
+
+var b64 = base64.RawURLEncoding
+
+// softwareAuthenticator is a passkey authenticator that keeps its P-256 key
+// in memory and answers ceremonies the way a browser would relay them.
+type softwareAuthenticator struct {
+	t            *testing.T
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+	signCount    uint32
+	skipUV       bool
+}
+
+func newSoftwareAuthenticator(t *testing.T) *softwareAuthenticator {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	credentialID := make([]byte, 16)
+	_, err = rand.Read(credentialID)
+	if err != nil {
+		t.Fatalf("Failed to generate credential ID: %v", err)
+	}
+
+	return &softwareAuthenticator{t: t, key: key, credentialID: credentialID}
+}
+
+func (a *softwareAuthenticator) flags() byte {
+	flags := byte(flagUserPresent)
+	if !a.skipUV {
+		flags |= flagUserVerified
+	}
+	return flags
+}
+
+func (a *softwareAuthenticator) authenticatorData(flags byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(testRPID))
+	data := append([]byte{}, rpIDHash[:]...)
+	data = append(data, flags)
+	return binary.BigEndian.AppendUint32(data, a.signCount)
+}
+
+func (a *softwareAuthenticator) clientData(ceremony, challenge string) []byte {
+	clientData, err := json.Marshal(map[string]string{
+		"type":      ceremony,
+		"challenge": challenge,
+		"origin":    testOrigin,
+	})
+	if err != nil {
+		a.t.Fatalf("Failed to encode client data: %v", err)
+	}
+	return clientData
+}
+
+// create answers navigator.credentials.create with a "none" attestation.
+func (a *softwareAuthenticator) create(session *webauthn.SessionData) []byte {
+	a.t.Helper()
+	a.userHandle = session.UserID
+
+	publicKey, err := webauthncbor.Marshal(map[int]any{
+		1:  2,  // kty: EC2
+		3:  -7, // alg: ES256
+		-1: 1,  // crv: P-256
+		-2: a.key.PublicKey.X.FillBytes(make([]byte, 32)),
+		-3: a.key.PublicKey.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		a.t.Fatalf("Failed to encode public key: %v", err)
+	}
+
+	authData := a.authenticatorData(a.flags() | flagAttestedData)
+	authData = append(authData, make([]byte, 16)...) // AAGUID
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(a.credentialID)))
+	authData = append(authData, a.credentialID...)
+	authData = append(authData, publicKey...)
+
+	attestationObject, err := webauthncbor.Marshal(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": authData,
+	})
+	if err != nil {
+		a.t.Fatalf("Failed to encode attestation object: %v", err)
+	}
+
+	return a.respond(map[string]any{
+		"clientDataJSON":    b64.EncodeToString(a.clientData("webauthn.create", session.Challenge)),
+		"attestationObject": b64.EncodeToString(attestationObject),
+		"transports":        []string{"internal"},
+	})
+}
+
+// get answers navigator.credentials.get, counting the signature.
+func (a *softwareAuthenticator) get(session *webauthn.SessionData) []byte {
+	a.t.Helper()
+	a.signCount++
+
+	clientData := a.clientData("webauthn.get", session.Challenge)
+	authData := a.authenticatorData(a.flags())
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		a.t.Fatalf("Failed to sign assertion: %v", err)
+	}
+
+	return a.respond(map[string]any{
+		"clientDataJSON":    b64.EncodeToString(clientData),
+		"authenticatorData": b64.EncodeToString(authData),
+		"signature":         b64.EncodeToString(signature),
+		"userHandle":        b64.EncodeToString(a.userHandle),
+	})
+}
+
+func (a *softwareAuthenticator) respond(response map[string]any) []byte {
+	body, err := json.Marshal(map[string]any{
+		"id":       b64.EncodeToString(a.credentialID),
+		"rawId":    b64.EncodeToString(a.credentialID),
+		"type":     "public-key",
+		"response": response,
+	})
+	if err != nil {
+		a.t.Fatalf("Failed to encode credential: %v", err)
+	}
+	return body
+}
+
+func newTestService(t *testing.T) *passkey.Service {
+	t.Helper()
+
+	service, err := passkey.NewService(testRPID, "Chirpy", []string{testOrigin})
+	if err != nil {
+		t.Fatalf("Failed to create passkey service: %v", err)
+	}
+	return service
+}
+
+func register(t *testing.T, service *passkey.Service, user *passkey.User, authenticator *softwareAuthenticator) {
+	t.Helper()
+
+	_, session, err := service.BeginRegistration(user)
+	if err != nil {
+		t.Fatalf("Failed to begin registration: %v", err)
+	}
+
+	credential, err := service.FinishRegistration(user, *session, authenticator.create(session))
+	if err != nil {
+		t.Fatalf("Failed to finish registration: %v", err)
+	}
+
+	user.Credentials = append(user.Credentials, *credential)
+}
+
+func login(t *testing.T, service *passkey.Service, user *passkey.User, authenticator *softwareAuthenticator) (*passkey.User, *webauthn.Credential, error) {
+	t.Helper()
+
+	_, session, err := service.BeginLogin()
+	if err != nil {
+		t.Fatalf("Failed to begin login: %v", err)
+	}
+
+	return service.FinishLogin(*session, authenticator.get(session), func(userID uuid.UUID) (*passkey.User, error) {
+		if userID != user.ID {
+			return nil, errors.New("unknown user")
+		}
+		return user, nil
+	})
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	service := newTestService(t)
+	user := &passkey.User{ID: uuid.New(), Email: "passkey@example.com"}
+	authenticator := newSoftwareAuthenticator(t)
+
+	register(t, service, user, authenticator)
+
+	credential := user.Credentials[0]
+	if string(credential.ID) != string(authenticator.credentialID) {
+		t.Fatal("Expected the stored credential ID to match the authenticator's")
+	}
+	if len(credential.Transport) != 1 || credential.Transport[0] != "internal" {
+		t.Fatalf("Expected the internal transport to be recorded, got %v", credential.Transport)
+	}
+
+	loggedIn, updated, err := login(t, service, user, authenticator)
+	if err != nil {
+		t.Fatalf("Failed to log in: %v", err)
+	}
+	if loggedIn.ID != user.ID {
+		t.Fatalf("Expected user %s, got %s", user.ID, loggedIn.ID)
+	}
+	if updated.Authenticator.SignCount != 1 {
+		t.Fatalf("Expected sign count 1, got %d", updated.Authenticator.SignCount)
+	}
+}
+
+func TestLoginRejectsRepeatedSignCount(t *testing.T) {
+	service := newTestService(t)
+	user := &passkey.User{ID: uuid.New(), Email: "passkey@example.com"}
+	authenticator := newSoftwareAuthenticator(t)
+
+	register(t, service, user, authenticator)
+
+	_, updated, err := login(t, service, user, authenticator)
+	if err != nil {
+		t.Fatalf("Failed to log in: %v", err)
+	}
+	user.Credentials[0] = *updated
+
+	// A copy of the key that has not seen the last login.
+	authenticator.signCount--
+	_, _, err = login(t, service, user, authenticator)
+	if !errors.Is(err, passkey.ErrClonedAuthenticator) {
+		t.Fatalf("Expected ErrClonedAuthenticator, got %v", err)
+	}
+}
+
+func TestLoginRejectsAnotherSessionsChallenge(t *testing.T) {
+	service := newTestService(t)
+	user := &passkey.User{ID: uuid.New(), Email: "passkey@example.com"}
+	authenticator := newSoftwareAuthenticator(t)
+
+	register(t, service, user, authenticator)
+
+	_, first, err := service.BeginLogin()
+	if err != nil {
+		t.Fatalf("Failed to begin login: %v", err)
+	}
+	_, second, err := service.BeginLogin()
+	if err != nil {
+		t.Fatalf("Failed to begin login: %v", err)
+	}
+
+	_, _, err = service.FinishLogin(*second, authenticator.get(first), func(uuid.UUID) (*passkey.User, error) {
+		return user, nil
+	})
+	if err == nil {
+		t.Fatal("Expected an assertion for another challenge to be rejected")
+	}
+}
+
+func TestRegistrationRequiresUserVerification(t *testing.T) {
+	service := newTestService(t)
+	user := &passkey.User{ID: uuid.New(), Email: "passkey@example.com"}
+	authenticator := newSoftwareAuthenticator(t)
+	authenticator.skipUV = true
+
+	_, session, err := service.BeginRegistration(user)
+	if err != nil {
+		t.Fatalf("Failed to begin registration: %v", err)
+	}
+
+	_, err = service.FinishRegistration(user, *session, authenticator.create(session))
+	if err == nil {
+		t.Fatal("Expected registration without user verification to be rejected")
+	}
+}
@@ -0,0 +1,112 @@
+// Package tracing sets up OpenTelemetry tracing: the exporter, the W3C trace
+// context propagator, and the tracer the rest of the server starts spans with.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "chirpy"
+
+// Exporters for Config.Exporter.
+const (
+	// ExporterNone records nothing. Trace context is still propagated.
+	ExporterNone = "none"
+	// ExporterStdout writes spans as JSON to Config.File, or stdout. The
+	// name "console" from the OpenTelemetry spec works too.
+	ExporterStdout = "stdout"
+	// ExporterOTLP sends spans over OTLP/HTTP. The endpoint and headers come
+	// from the standard OTEL_EXPORTER_OTLP_* variables, and default to a
+	// collector on localhost:4318.
+	ExporterOTLP = "otlp"
+)
+
+type Config struct {
+	Exporter    string
+	File        string
+	ServiceName string
+	// SampleRatio is the share of new traces that are recorded. Requests
+	// that arrive with a sampled traceparent are always recorded.
+	SampleRatio float64
+}
+
+// Tracer is what the server starts its spans with.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Setup installs the global tracer provider and propagator. The returned
+// function flushes buffered spans and must be called before exiting.
+func Setup(ctx context.Context, cfg Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	var exporter sdktrace.SpanExporter
+	var closer io.Closer
+	switch cfg.Exporter {
+	case "", ExporterNone:
+		return func(context.Context) error { return nil }, nil
+
+	case ExporterStdout, "console":
+		var w io.Writer = os.Stdout
+		if cfg.File != "" {
+			f, err := os.OpenFile(cfg.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+			if err != nil {
+				return nil, err
+			}
+			w, closer = f, f
+		}
+
+		var err error
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(w))
+		if err != nil {
+			return nil, err
+		}
+
+	case ExporterOTLP:
+		var err error
+		exporter, err = otlptracehttp.New(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", cfg.Exporter)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		semconv.ServiceName(cfg.ServiceName),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if closer != nil {
+			closer.Close()
+		}
+		return err
+	}, nil
+}
@@ -0,0 +1,46 @@
+package tracing_test
+
+import (
+	"chirpy/internal/tracing"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStdoutExporterWritesSpansToFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "spans.json")
+	shutdown, err := tracing.Setup(context.Background(), tracing.Config{
+		Exporter:    tracing.ExporterStdout,
+		File:        file,
+		ServiceName: "chirpy-test",
+		SampleRatio: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, span := tracing.Tracer().Start(context.Background(), "GET /api/healthz")
+	span.End()
+
+	err = shutdown(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spans, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(spans), `"Name":"GET /api/healthz"`) || !strings.Contains(string(spans), "chirpy-test") {
+		t.Fatalf("Expected the span in the file, got %s", spans)
+	}
+}
+
+func TestUnknownExporter(t *testing.T) {
+	_, err := tracing.Setup(context.Background(), tracing.Config{Exporter: "carrier-pigeon"})
+	if err == nil {
+		t.Fatal("Expected an unknown exporter to be rejected")
+	}
+}
@@ -0,0 +1,244 @@
+package webhooks
+
+import (
+	"bytes"
+	"chirpy/internal/auth"
+	"chirpy/internal/database"
+	"chirpy/internal/tracing"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Headers sent with every delivery. The signature is computed as described
+// in auth.SignWebhook over the timestamp and the body.
+const (
+	HeaderEvent     = "X-Chirpy-Event"
+	HeaderDelivery  = "X-Chirpy-Delivery"
+	HeaderTimestamp = "X-Chirpy-Timestamp"
+	HeaderSignature = "X-Chirpy-Signature"
+)
+
+const (
+	firstRetryDelay = 30 * time.Second
+	maxRetryDelay   = 12 * time.Hour
+)
+
+// Delivery is one event on its way to one subscription.
+type Delivery struct {
+	ID        uuid.UUID
+	EventID   uuid.UUID
+	EventType string
+	Payload   []byte
+	URL       string
+	Secret    string
+}
+
+// Deliver POSTs the event to the subscriber and returns the response status,
+// or 0 when there was no response. Anything but a 2xx is an error.
+func Deliver(ctx context.Context, client *http.Client, delivery Delivery, now time.Time) (status int, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "webhook "+delivery.EventType,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodPost,
+			semconv.ServerAddress(serverAddress(delivery.URL)),
+			attribute.String("webhook.delivery_id", delivery.ID.String()),
+		),
+	)
+	defer func() {
+		if status != 0 {
+			span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		}
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Chirpy-Webhooks/1.0")
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderDelivery, delivery.ID.String())
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set(HeaderSignature, auth.SignWebhook(delivery.Secret, now, delivery.Payload))
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	// Reading a little of the body lets the connection be reused.
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("subscriber responded %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// serverAddress is the host of a subscriber URL. The URL itself can carry
+// credentials in its query, so it is not recorded.
+func serverAddress(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return parsed.Hostname()
+}
+
+// Backoff returns how long to wait after the given number of failed
+// attempts: 30 seconds, doubling each time, up to 12 hours.
+func Backoff(attempts int) time.Duration {
+	delay := firstRetryDelay
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryDelay)
+}
+
+// Dispatcher sends queued deliveries. Several dispatchers, in one process or
+// many, can run against the same database: each batch is leased so only one
+// of them sends it.
+type Dispatcher struct {
+	Queries *database.Queries
+	Client  *http.Client
+	// Workers is how many deliveries are sent at once.
+	Workers   int
+	BatchSize int
+	// MaxAttempts is how often a delivery is tried before it is given up on.
+	MaxAttempts int
+	// DisableAfter is how many failed attempts in a row disable a
+	// subscription.
+	DisableAfter int
+}
+
+// NewDispatcher returns a Dispatcher that only delivers to public addresses,
+// unless allowPrivateNetworks is set for local development.
+func NewDispatcher(q *database.Queries, allowPrivateNetworks bool) *Dispatcher {
+	return &Dispatcher{
+		Queries:      q,
+		Client:       newClient(allowPrivateNetworks),
+		Workers:      4,
+		BatchSize:    50,
+		MaxAttempts:  10,
+		DisableAfter: 20,
+	}
+}
+
+// DeliverDue sends every delivery that is due, a batch at a time.
+func (d *Dispatcher) DeliverDue(ctx context.Context) error {
+	// The lease outlasts a batch even if every request times out.
+	lease := d.Client.Timeout * time.Duration(d.BatchSize/d.Workers+1) * 2
+
+	for {
+		rows, err := d.Queries.ClaimDueWebhookDeliveries(ctx, database.ClaimDueWebhookDeliveriesParams{
+			LeaseSeconds: int32(lease / time.Second),
+			BatchSize:    int32(d.BatchSize),
+		})
+		if err != nil {
+			return err
+		}
+
+		jobs := make(chan database.ClaimDueWebhookDeliveriesRow)
+		var wg sync.WaitGroup
+		for range d.Workers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for row := range jobs {
+					d.attempt(ctx, row)
+				}
+			}()
+		}
+		for _, row := range rows {
+			jobs <- row
+		}
+		close(jobs)
+		wg.Wait()
+
+		if len(rows) < d.BatchSize {
+			return nil
+		}
+	}
+}
+
+func (d *Dispatcher) attempt(ctx context.Context, row database.ClaimDueWebhookDeliveriesRow) {
+	responseCode, err := Deliver(ctx, d.Client, Delivery{
+		ID:        row.ID,
+		EventID:   row.EventID,
+		EventType: row.EventType,
+		Payload:   []byte(row.Payload),
+		URL:       row.Url,
+		Secret:    row.Secret,
+	}, time.Now())
+	responseStatus := sql.NullInt32{Int32: int32(responseCode), Valid: responseCode != 0}
+
+	if err == nil {
+		err = d.Queries.MarkWebhookDelivered(ctx, database.MarkWebhookDeliveredParams{
+			ID:             row.ID,
+			ResponseStatus: responseStatus,
+		})
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to mark webhook delivery as delivered", "delivery_id", row.ID, "error", err)
+			return
+		}
+
+		err = d.Queries.ResetWebhookFailures(ctx, row.SubscriptionID)
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to reset webhook subscription failures", "subscription_id", row.SubscriptionID, "error", err)
+		}
+		return
+	}
+
+	attempts := int(row.Attempts) + 1
+	status := "pending"
+	if attempts >= d.MaxAttempts {
+		status = "failed"
+	}
+
+	dbErr := d.Queries.MarkWebhookAttemptFailed(ctx, database.MarkWebhookAttemptFailedParams{
+		ID:             row.ID,
+		Status:         status,
+		NextAttemptAt:  time.Now().Add(Backoff(attempts)),
+		ResponseStatus: responseStatus,
+		Error:          sql.NullString{String: err.Error(), Valid: true},
+	})
+	if dbErr != nil {
+		slog.ErrorContext(ctx, "failed to record failed webhook delivery", "delivery_id", row.ID, "error", dbErr)
+		return
+	}
+
+	failures, dbErr := d.Queries.RecordWebhookFailure(ctx, database.RecordWebhookFailureParams{
+		ID:          row.SubscriptionID,
+		MaxFailures: int32(d.DisableAfter),
+	})
+	if dbErr != nil {
+		slog.ErrorContext(ctx, "failed to record webhook subscription failure", "subscription_id", row.SubscriptionID, "error", dbErr)
+		return
+	}
+	if int(failures) == d.DisableAfter {
+		slog.WarnContext(ctx, "webhook subscription disabled after failures in a row", "subscription_id", row.SubscriptionID, "failures", d.DisableAfter)
+	}
+}
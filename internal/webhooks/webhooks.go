@@ -0,0 +1,122 @@
+// Package webhooks tells API clients about events through the webhooks they
+// subscribe to. Events are queued in an outbox in the same transaction as the
+// change they report, then sent by a Dispatcher.
+package webhooks
+
+import (
+	"chirpy/internal/auth"
+	"chirpy/internal/database"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	EventChirpCreated = "chirp.created"
+	EventChirpDeleted = "chirp.deleted"
+)
+
+// EventTypes lists the events clients can subscribe to.
+var EventTypes = []string{EventChirpCreated, EventChirpDeleted}
+
+// eventScopes are the scopes a client needs from a user to be told about
+// that user's events.
+var eventScopes = map[string]string{
+	EventChirpCreated: auth.ScopeChirpsRead,
+	EventChirpDeleted: auth.ScopeChirpsRead,
+}
+
+func IsEventType(eventType string) bool {
+	return slices.Contains(EventTypes, eventType)
+}
+
+var ErrInvalidURL = errors.New("webhook URLs must use https on a public host")
+
+// ValidateURL accepts https URLs. Hosts that are IP addresses must be public,
+// and localhost is refused. Hostnames are checked again by the delivery
+// client once they resolve, since DNS can change after this check.
+//
+// With allowPrivateNetworks, for local development, any host is accepted, and
+// http too on the loopback interface.
+func ValidateURL(raw string, allowPrivateNetworks bool) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || u.User != nil {
+		return ErrInvalidURL
+	}
+
+	host := u.Hostname()
+	addr, err := netip.ParseAddr(host)
+	isIP := err == nil
+	isLoopback := host == "localhost" || (isIP && addr.IsLoopback())
+
+	if allowPrivateNetworks {
+		if u.Scheme == "https" || (u.Scheme == "http" && isLoopback) {
+			return nil
+		}
+		return ErrInvalidURL
+	}
+
+	if u.Scheme != "https" || isLoopback || (isIP && !IsPublicAddr(addr)) {
+		return ErrInvalidURL
+	}
+	return nil
+}
+
+// NewSecret returns a signing secret for a new subscription.
+func NewSecret() (string, error) {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(key), nil
+}
+
+// Event is the body of every delivery.
+type Event struct {
+	ID        uuid.UUID `json:"id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+// Enqueue queues an event about userID for every enabled subscription to its
+// type, of the clients that user has granted the scope to read it. Other
+// clients are never told about the user. q must be bound to the transaction
+// making the change, so the event is only sent if the change is committed.
+func Enqueue(ctx context.Context, q *database.Queries, eventType string, userID uuid.UUID, data any) error {
+	scope, ok := eventScopes[eventType]
+	if !ok {
+		return fmt.Errorf("unknown webhook event %q", eventType)
+	}
+
+	event := Event{
+		ID:        uuid.New(),
+		Type:      eventType,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.EnqueueWebhookDeliveries(ctx, database.EnqueueWebhookDeliveriesParams{
+		EventID:   event.ID,
+		EventType: eventType,
+		Payload:   string(payload),
+		UserID:    userID,
+		Scope:     scope,
+	})
+	return err
+}
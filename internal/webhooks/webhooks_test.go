@@ -0,0 +1,38 @@
+package webhooks_test
+
+import (
+	"chirpy/internal/auth"
+	"chirpy/internal/database"
+	"chirpy/internal/webhooks"
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+)
+
+func TestEnqueueOnlyReachesClientsTheUserGranted(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open mock database: %v", err)
+	}
+	defer db.Close()
+
+	userID := uuid.New()
+	mock.ExpectExec("EnqueueWebhookDeliveries").
+		WithArgs(sqlmock.AnyArg(), webhooks.EventChirpCreated, sqlmock.AnyArg(), userID.String(), auth.ScopeChirpsRead).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err = webhooks.Enqueue(context.Background(), database.New(db), webhooks.EventChirpCreated, userID, map[string]string{"body": "hi"})
+	if err != nil {
+		t.Fatalf("Failed to enqueue: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+
+	err = webhooks.Enqueue(context.Background(), database.New(db), "user.updated", userID, nil)
+	if err == nil {
+		t.Fatal("Expected an unknown event to be refused")
+	}
+}
@@ -0,0 +1,71 @@
+package worker
+
+import (
+	"chirpy/internal/database"
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+)
+
+const accountDeletionBatchSize = 100
+
+// PurgeDeletedAccounts returns a job that deletes the accounts whose deletion
+// grace period is over. Chirps, tokens, credentials and everything else that
+// references the user go with it through ON DELETE CASCADE. Login attempts
+// are keyed by email, so they are removed explicitly.
+func PurgeDeletedAccounts(db *sql.DB, q *database.Queries, interval time.Duration) Job {
+	return Job{
+		Name:     "purge-deleted-accounts",
+		Interval: interval,
+		Run: func(ctx context.Context) error {
+			for {
+				users, err := q.ListUsersDueForDeletion(ctx, accountDeletionBatchSize)
+				if err != nil {
+					return err
+				}
+
+				for _, user := range users {
+					err = deleteAccount(ctx, db, q, user)
+					if err != nil {
+						return err
+					}
+				}
+
+				if len(users) < accountDeletionBatchSize {
+					return nil
+				}
+			}
+		},
+	}
+}
+
+func deleteAccount(ctx context.Context, db *sql.DB, q *database.Queries, user database.ListUsersDueForDeletionRow) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	qtx := q.InTx(tx)
+
+	// A login since the user was listed cancels the deletion, in which case
+	// nothing is deleted and the transaction is rolled back.
+	deleted, err := qtx.DeleteUser(ctx, user.ID)
+	if err != nil || deleted == 0 {
+		return err
+	}
+
+	err = qtx.DeleteLoginAttemptsByEmail(ctx, user.Email)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	slog.InfoContext(ctx, "deleted account", "user_id", user.ID)
+	return nil
+}
@@ -0,0 +1,48 @@
+package worker_test
+
+import (
+	"chirpy/internal/database"
+	"chirpy/internal/worker"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+)
+
+func TestPurgeDeletedAccounts(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open mock database: %v", err)
+	}
+	defer db.Close()
+
+	due, loggedIn := uuid.New(), uuid.New()
+	mock.ExpectQuery("ListUsersDueForDeletion").WillReturnRows(
+		sqlmock.NewRows([]string{"id", "email"}).
+			AddRow(due.String(), "due@example.com").
+			AddRow(loggedIn.String(), "back@example.com"),
+	)
+
+	// The account goes with its login attempts, which are keyed by email.
+	mock.ExpectBegin()
+	mock.ExpectExec("DeleteUser").WithArgs(due.String()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DeleteLoginAttemptsByEmail").WithArgs("due@example.com").WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectCommit()
+
+	// A login since the listing cancelled this deletion, so nothing matches
+	// and nothing else is deleted.
+	mock.ExpectBegin()
+	mock.ExpectExec("DeleteUser").WithArgs(loggedIn.String()).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	job := worker.PurgeDeletedAccounts(db, database.New(db), time.Hour)
+	err = job.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Expected the purge to succeed, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
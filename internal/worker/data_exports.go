@@ -0,0 +1,221 @@
+package worker
+
+import (
+	"bytes"
+	"chirpy/internal/database"
+	"chirpy/internal/export"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PurgeExpiredExports returns a job that deletes data export archives once
+// their download window has passed.
+func PurgeExpiredExports(q *database.Queries, interval time.Duration) Job {
+	return Job{
+		Name:     "purge-expired-exports",
+		Interval: interval,
+		Run: func(ctx context.Context) error {
+			deleted, err := q.DeleteExpiredDataExports(ctx)
+			if err != nil {
+				return err
+			}
+
+			if deleted > 0 {
+				slog.InfoContext(ctx, "deleted expired data exports", "count", deleted)
+			}
+			return nil
+		},
+	}
+}
+
+// DataExportBuildTimeout is how long building one export may take.
+const DataExportBuildTimeout = time.Minute
+
+// MaxDataExportSize bounds an archive. Archives are built in memory, stored
+// in one column and read back whole to be downloaded, so a larger one fails
+// instead.
+const MaxDataExportSize = 64 << 20
+
+var errDataExportTooLarge = fmt.Errorf("data export is larger than %d bytes", MaxDataExportSize)
+
+// cappedBuffer is a bytes.Buffer that refuses to grow past limit.
+type cappedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if b.Len()+len(p) > b.limit {
+		return 0, errDataExportTooLarge
+	}
+	return b.Buffer.Write(p)
+}
+
+// BuildDataExports returns a job that builds pending data exports. Each
+// export is claimed first, so several workers never build the same one, and
+// an export whose worker stopped halfway is claimed again once the build
+// would have timed out. A run stops claiming after half its interval, so with
+// an interval of at least DataExportBuildTimeout it never looks stuck.
+func BuildDataExports(q *database.Queries, interval time.Duration) Job {
+	lease := int32((DataExportBuildTimeout + time.Minute) / time.Second)
+	return Job{
+		Name:     "build-data-exports",
+		Interval: interval,
+		Run: func(ctx context.Context) error {
+			for start := time.Now(); ctx.Err() == nil && time.Since(start) < interval/2; {
+				claimed, err := q.ClaimPendingDataExport(ctx, lease)
+				if errors.Is(err, sql.ErrNoRows) {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+
+				buildDataExport(ctx, q, claimed.ID, claimed.UserID)
+			}
+			return nil
+		},
+	}
+}
+
+// buildDataExport builds and stores one export. A build that has started is
+// not cut short by shutdown, which waits for it; one still running at the
+// shutdown deadline is claimed again after a restart.
+func buildDataExport(ctx context.Context, q *database.Queries, exportID, userID uuid.UUID) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), DataExportBuildTimeout)
+	defer cancel()
+
+	archive := cappedBuffer{limit: MaxDataExportSize}
+	err := writeDataExport(ctx, q, &archive, userID)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to build data export", "export_id", exportID, "error", err)
+
+		// The build may have failed by running out of time, so marking it
+		// gets a moment of its own.
+		failCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+		defer cancel()
+		err = q.FailDataExport(failCtx, exportID)
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to mark data export as failed", "export_id", exportID, "error", err)
+		}
+		return
+	}
+
+	err = q.CompleteDataExport(ctx, database.CompleteDataExportParams{
+		ID:      exportID,
+		Archive: archive.Bytes(),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to store data export", "export_id", exportID, "error", err)
+	}
+}
+
+// writeDataExport writes the archive of everything userID has stored.
+func writeDataExport(ctx context.Context, q *database.Queries, archive io.Writer, userID uuid.UUID) error {
+	user, err := q.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	data := export.Data{
+		Profile: export.Profile{
+			ID:          user.ID,
+			Email:       user.Email,
+			Role:        user.Role,
+			IsChirpyRed: user.IsChirpyRed,
+			CreatedAt:   user.CreatedAt,
+			UpdatedAt:   user.UpdatedAt,
+		},
+	}
+	if user.EmailVerifiedAt.Valid {
+		data.Profile.EmailVerifiedAt = &user.EmailVerifiedAt.Time
+	}
+
+	chirps, err := q.ListChirpsByAuthorID(ctx, database.ListChirpsByAuthorIDParams{
+		UserID:    userID,
+		SortOrder: "desc",
+	})
+	if err != nil {
+		return err
+	}
+	for _, chirp := range chirps {
+		data.Chirps = append(data.Chirps, export.Chirp{
+			ID:                chirp.ID,
+			Body:              chirp.Body,
+			CreatedAt:         chirp.CreatedAt,
+			UpdatedAt:         chirp.UpdatedAt,
+			ImportedCreatedAt: chirp.ImportedCreatedAt,
+		})
+	}
+
+	// Refresh tokens rotate, so a session starts with the oldest token issued
+	// under it and its current state is that of the newest. Tokens come newest
+	// first.
+	tokens, err := q.ListUserRefreshTokens(ctx, userID)
+	if err != nil {
+		return err
+	}
+	sessions := map[uuid.UUID]int{}
+	for _, token := range tokens {
+		if i, ok := sessions[token.SessionID]; ok {
+			data.Sessions[i].CreatedAt = token.CreatedAt
+			continue
+		}
+
+		session := export.Session{
+			ID:        token.SessionID,
+			Scopes:    token.Scopes,
+			CreatedAt: token.CreatedAt,
+			ExpiresAt: token.ExpiresAt,
+		}
+		if token.ClientID.Valid {
+			session.ClientID = &token.ClientID.UUID
+		}
+		if token.RevokedAt.Valid {
+			session.RevokedAt = &token.RevokedAt.Time
+		}
+		sessions[token.SessionID] = len(data.Sessions)
+		data.Sessions = append(data.Sessions, session)
+	}
+
+	apiKeys, err := q.ListAPIKeys(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, key := range apiKeys {
+		apiKey := export.APIKey{
+			Name:      key.Name,
+			Prefix:    key.Prefix,
+			Scopes:    key.Scopes,
+			CreatedAt: key.CreatedAt,
+		}
+		if key.LastUsedAt.Valid {
+			apiKey.LastUsedAt = &key.LastUsedAt.Time
+		}
+		data.APIKeys = append(data.APIKeys, apiKey)
+	}
+
+	credentials, err := q.ListWebAuthnCredentials(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, credential := range credentials {
+		passkey := export.Passkey{
+			Name:      credential.Name,
+			CreatedAt: credential.CreatedAt,
+		}
+		if credential.LastUsedAt.Valid {
+			passkey.LastUsedAt = &credential.LastUsedAt.Time
+		}
+		data.Passkeys = append(data.Passkeys, passkey)
+	}
+
+	return export.Write(archive, data)
+}
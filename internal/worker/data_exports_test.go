@@ -0,0 +1,40 @@
+package worker_test
+
+import (
+	"chirpy/internal/database"
+	"chirpy/internal/worker"
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+)
+
+func TestBuildDataExportsMarksFailedBuilds(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open mock database: %v", err)
+	}
+	defer db.Close()
+
+	exportID, userID := uuid.New(), uuid.New()
+	lease := int64((worker.DataExportBuildTimeout + time.Minute) / time.Second)
+	mock.ExpectQuery("ClaimPendingDataExport").WithArgs(lease).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "user_id"}).AddRow(exportID.String(), userID.String()),
+	)
+	mock.ExpectQuery("GetUserByID").WithArgs(userID.String()).WillReturnError(errors.New("boom"))
+	mock.ExpectExec("FailDataExport").WithArgs(exportID.String()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("ClaimPendingDataExport").WillReturnError(sql.ErrNoRows)
+
+	job := worker.BuildDataExports(database.New(db), time.Minute)
+	err = job.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Expected the run to succeed once no exports are pending, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
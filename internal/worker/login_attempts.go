@@ -0,0 +1,28 @@
+package worker
+
+import (
+	"chirpy/internal/database"
+	"context"
+	"log/slog"
+	"time"
+)
+
+// PurgeLoginAttempts returns a job that deletes login attempts older than
+// retention, which should cover every login throttle window.
+func PurgeLoginAttempts(q *database.Queries, retention, interval time.Duration) Job {
+	return Job{
+		Name:     "purge-login-attempts",
+		Interval: interval,
+		Run: func(ctx context.Context) error {
+			deleted, err := q.DeleteLoginAttemptsBefore(ctx, time.Now().Add(-retention))
+			if err != nil {
+				return err
+			}
+
+			if deleted > 0 {
+				slog.InfoContext(ctx, "deleted old login attempts", "count", deleted)
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,72 @@
+package worker
+
+import (
+	"chirpy/internal/database"
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const subscriptionExpiryBatchSize = 100
+
+// ExpireLapsedSubscriptions returns a job that ends subscriptions whose paid
+// period is over without a renewal, including canceled and past due ones, and
+// takes Chirpy Red away from their users.
+func ExpireLapsedSubscriptions(db *sql.DB, q *database.Queries, interval time.Duration) Job {
+	return Job{
+		Name:     "expire-lapsed-subscriptions",
+		Interval: interval,
+		Run: func(ctx context.Context) error {
+			for {
+				userIDs, err := q.ListLapsedSubscriptions(ctx, subscriptionExpiryBatchSize)
+				if err != nil {
+					return err
+				}
+
+				for _, userID := range userIDs {
+					err = expireSubscription(ctx, db, q, userID)
+					if err != nil {
+						return err
+					}
+				}
+
+				if len(userIDs) < subscriptionExpiryBatchSize {
+					return nil
+				}
+			}
+		},
+	}
+}
+
+func expireSubscription(ctx context.Context, db *sql.DB, q *database.Queries, userID uuid.UUID) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	qtx := q.InTx(tx)
+
+	// A renewal since the subscription was listed keeps it going, in which
+	// case nothing changes.
+	expired, err := qtx.ExpireSubscription(ctx, userID)
+	if err != nil || expired == 0 {
+		return err
+	}
+
+	_, err = qtx.DisableUserChirpyRed(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	slog.InfoContext(ctx, "expired subscription", "user_id", userID)
+	return nil
+}
@@ -0,0 +1,28 @@
+package worker
+
+import (
+	"chirpy/internal/database"
+	"context"
+	"log/slog"
+	"time"
+)
+
+// PurgeExpiredWebAuthnSessions returns a job that deletes passkey ceremonies
+// that were begun but never finished in time.
+func PurgeExpiredWebAuthnSessions(q *database.Queries, interval time.Duration) Job {
+	return Job{
+		Name:     "purge-expired-webauthn-sessions",
+		Interval: interval,
+		Run: func(ctx context.Context) error {
+			deleted, err := q.DeleteExpiredWebAuthnSessions(ctx)
+			if err != nil {
+				return err
+			}
+
+			if deleted > 0 {
+				slog.InfoContext(ctx, "deleted expired webauthn sessions", "count", deleted)
+			}
+			return nil
+		},
+	}
+}
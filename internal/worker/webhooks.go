@@ -0,0 +1,15 @@
+package worker
+
+import (
+	"chirpy/internal/webhooks"
+	"time"
+)
+
+// DeliverWebhooks returns a job that sends the outbound webhooks that are due.
+func DeliverWebhooks(dispatcher *webhooks.Dispatcher, interval time.Duration) Job {
+	return Job{
+		Name:     "deliver-webhooks",
+		Interval: interval,
+		Run:      dispatcher.DeliverDue,
+	}
+}
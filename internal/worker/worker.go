@@ -0,0 +1,94 @@
+// Package worker runs periodic background jobs next to the HTTP server.
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Job is a task that runs every Interval. Errors are logged and the job runs
+// again on its next tick.
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Run      func(ctx context.Context) error
+}
+
+// Group is a set of running jobs.
+type Group struct {
+	wg   sync.WaitGroup
+	jobs []*runningJob
+}
+
+type runningJob struct {
+	Job
+	// heartbeat is when the job last started or finished a run, in Unix
+	// nanoseconds.
+	heartbeat atomic.Int64
+	stopped   atomic.Bool
+}
+
+// Start runs each job once right away and then on its interval until ctx is
+// cancelled. Wait on the returned Group for running jobs to finish.
+func Start(ctx context.Context, jobs ...Job) *Group {
+	g := &Group{}
+	for _, job := range jobs {
+		running := &runningJob{Job: job}
+		running.heartbeat.Store(time.Now().UnixNano())
+		g.jobs = append(g.jobs, running)
+
+		g.wg.Add(1)
+		go func() {
+			defer g.wg.Done()
+			defer running.stopped.Store(true)
+			run(ctx, running)
+		}()
+	}
+	return g
+}
+
+// Wait blocks until every job has stopped.
+func (g *Group) Wait() {
+	g.wg.Wait()
+}
+
+// Check returns an error naming the first job that has stopped, or that has
+// spent more than two of its intervals on one run, which means it is stuck.
+// It has the shape of a health.Check.
+func (g *Group) Check(ctx context.Context) error {
+	now := time.Now()
+	for _, job := range g.jobs {
+		if job.stopped.Load() {
+			return fmt.Errorf("job %s has stopped", job.Name)
+		}
+		since := now.Sub(time.Unix(0, job.heartbeat.Load()))
+		if since > 2*job.Interval {
+			return fmt.Errorf("job %s has not made progress for %s", job.Name, since.Round(time.Second))
+		}
+	}
+	return nil
+}
+
+func run(ctx context.Context, job *runningJob) {
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+
+	for {
+		job.heartbeat.Store(time.Now().UnixNano())
+		err := job.Run(ctx)
+		job.heartbeat.Store(time.Now().UnixNano())
+		if err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "job failed", "job", job.Name, "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package worker_test
+
+import (
+	"chirpy/internal/worker"
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStartRunsJobsUntilCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var runs atomic.Int32
+	wg := worker.Start(ctx, worker.Job{
+		Name:     "count",
+		Interval: time.Millisecond,
+		Run: func(context.Context) error {
+			if runs.Add(1) == 3 {
+				cancel()
+			}
+			return nil
+		},
+	})
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the job to stop once the context was cancelled")
+	}
+
+	if runs.Load() != 3 {
+		t.Fatalf("Expected 3 runs, got %d", runs.Load())
+	}
+}
+
+func TestStartKeepsRunningAfterErrors(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var runs atomic.Int32
+	wg := worker.Start(ctx, worker.Job{
+		Name:     "failing",
+		Interval: time.Millisecond,
+		Run: func(context.Context) error {
+			if runs.Add(1) == 2 {
+				cancel()
+			}
+			return errors.New("boom")
+		},
+	})
+	wg.Wait()
+
+	if runs.Load() != 2 {
+		t.Fatalf("Expected the job to run again after failing, got %d runs", runs.Load())
+	}
+}
+
+func TestCheckReportsStuckAndStoppedJobs(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	release := make(chan struct{})
+	g := worker.Start(ctx,
+		worker.Job{
+			Name:     "idle",
+			Interval: time.Hour,
+			Run:      func(context.Context) error { return nil },
+		},
+		worker.Job{
+			Name:     "stuck",
+			Interval: 10 * time.Millisecond,
+			Run: func(context.Context) error {
+				<-release
+				return nil
+			},
+		},
+	)
+
+	if err := g.Check(ctx); err != nil {
+		t.Fatalf("Expected jobs that just started to be healthy, got %v", err)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	err := g.Check(ctx)
+	if err == nil || !strings.Contains(err.Error(), "stuck") {
+		t.Fatalf("Expected the stuck job to be reported, got %v", err)
+	}
+
+	close(release)
+	cancel()
+	g.Wait()
+	err = g.Check(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "stopped") {
+		t.Fatalf("Expected stopped jobs to be reported, got %v", err)
+	}
+}
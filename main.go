@@ -2,14 +2,30 @@ package main
 
 import (
 	"chirpy/handlers"
+	"chirpy/internal/auth"
+	"chirpy/internal/billing"
 	"chirpy/internal/config"
 	"chirpy/internal/database"
+	"chirpy/internal/logging"
+	"chirpy/internal/mailer"
+	"chirpy/internal/passkey"
+	"chirpy/internal/tracing"
+	"chirpy/internal/webhooks"
+	"chirpy/internal/worker"
 	"chirpy/metrics"
 	"chirpy/middlewares"
+	"context"
 	"database/sql"
 	"log"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
@@ -21,10 +37,71 @@ func main() {
 		log.Fatal(err)
 	}
 
+	// Everything logged from here on, including through the log package, is
+	// JSON with credentials redacted.
+	logLevel, err := logging.ParseLevel(os.Getenv("LOG_LEVEL"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	slog.SetDefault(logging.New(os.Stderr, logLevel))
+
+	serviceName := os.Getenv("OTEL_SERVICE_NAME")
+	if serviceName == "" {
+		serviceName = "chirpy"
+	}
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		Exporter:    os.Getenv("OTEL_TRACES_EXPORTER"),
+		File:        os.Getenv("OTEL_TRACES_FILE"),
+		ServiceName: serviceName,
+		SampleRatio: envFloat("OTEL_TRACES_SAMPLE_RATIO", 1),
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	// API Config
 	apiConfig := &config.APIConfig{
-		JWTSecret: os.Getenv("JWT_SECRET"),
-		PolkaKey:  os.Getenv("POLKA_KEY"),
+		JWTSecret:    os.Getenv("JWT_SECRET"),
+		BaseURL:      os.Getenv("BASE_URL"),
+		MetricsToken: os.Getenv("METRICS_TOKEN"),
+	}
+	if apiConfig.BaseURL == "" {
+		apiConfig.BaseURL = "http://localhost:8080"
+	}
+	apiConfig.BillingProviders = newBillingProviders()
+	lockoutDuration := envDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute)
+	apiConfig.AccountLoginThrottle = auth.LoginThrottle{
+		Window:          lockoutDuration,
+		FreeAttempts:    3,
+		BaseDelay:       time.Second,
+		MaxDelay:        time.Minute,
+		LockoutAfter:    envInt("LOGIN_MAX_FAILURES", 10),
+		LockoutDuration: lockoutDuration,
+	}
+	apiConfig.IPLoginThrottle = auth.LoginThrottle{
+		Window:          lockoutDuration,
+		FreeAttempts:    20,
+		BaseDelay:       time.Second,
+		MaxDelay:        time.Minute,
+		LockoutAfter:    envInt("LOGIN_MAX_FAILURES_PER_IP", 100),
+		LockoutDuration: lockoutDuration,
+	}
+	apiConfig.TrustProxyHeaders = os.Getenv("TRUST_PROXY_HEADERS") == "true"
+	apiConfig.PasskeyRateLimit = envInt("PASSKEY_RATE_LIMIT", 10)
+	apiConfig.WebhookAllowPrivateNetworks = os.Getenv("WEBHOOK_ALLOW_PRIVATE_NETWORKS") == "true"
+	apiConfig.PasswordParams, err = config.PasswordParamsFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	apiConfig.PasswordPolicy, err = config.PasswordPolicyFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	apiConfig.AccountDeletionGracePeriod = envDuration("ACCOUNT_DELETION_GRACE_PERIOD", 14*24*time.Hour)
+	if restrictions := os.Getenv("UNVERIFIED_RESTRICTIONS"); restrictions != "" {
+		for _, action := range strings.Split(restrictions, ",") {
+			apiConfig.UnverifiedRestrictions = append(apiConfig.UnverifiedRestrictions, strings.TrimSpace(action))
+		}
 	}
 
 	dbURL := os.Getenv("DB_URL")
@@ -33,47 +110,261 @@ func main() {
 		log.Fatal(err)
 	}
 
-	dbQueries := database.New(db)
+	dbQueries := database.NewTraced(db, tracing.Tracer())
+
+	// The first SIGINT or SIGTERM starts a graceful shutdown, a second one
+	// kills the process.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	workers := worker.Start(workerCtx,
+		worker.PurgeDeletedAccounts(db, dbQueries, time.Hour),
+		worker.BuildDataExports(dbQueries, time.Minute),
+		worker.PurgeExpiredExports(dbQueries, time.Hour),
+		worker.PurgeExpiredWebAuthnSessions(dbQueries, time.Hour),
+		worker.PurgeLoginAttempts(dbQueries, max(apiConfig.AccountLoginThrottle.Window, apiConfig.IPLoginThrottle.Window), time.Hour),
+		worker.ExpireLapsedSubscriptions(db, dbQueries, 10*time.Minute),
+		worker.DeliverWebhooks(webhooks.NewDispatcher(dbQueries, apiConfig.WebhookAllowPrivateNetworks), 5*time.Second),
+	)
 	apiMetrics := metrics.NewAPIMetrics()
+	readiness := newReadiness(db, workers)
 
-	mux := http.ServeMux{}
+	apiMiddlewares := middlewares.NewMiddlewares(apiMetrics, apiConfig, dbQueries)
+	apiHandlers := handlers.NewAPIHandler(apiConfig, apiMetrics, db, dbQueries, newMailer(), newPasskeyService(apiConfig.BaseURL), readiness)
+	adminHandlers := handlers.NewAdminHandlers(os.Getenv("PLATFORM"), apiMetrics, db, dbQueries)
 
-	apiMiddlewares := middlewares.NewMiddlewares(apiMetrics)
-	apiHandlers := handlers.NewAPIHandler(apiConfig, dbQueries)
-	adminHandlers := handlers.NewAdminHandlers(os.Getenv("PLATFORM"), apiMetrics, dbQueries)
+	mux := newRouter(apiMiddlewares, apiHandlers, adminHandlers)
 
-	mux.HandleFunc("GET /api/healthz", apiHandlers.HealthCheck)
+	srv := &http.Server{
+		Addr:              ":8080",
+		Handler:           newServerHandler(apiMiddlewares, mux),
+		ReadHeaderTimeout: envDuration("HTTP_READ_HEADER_TIMEOUT", 5*time.Second),
+		ReadTimeout:       envDuration("HTTP_READ_TIMEOUT", 30*time.Second),
+		WriteTimeout:      envDuration("HTTP_WRITE_TIMEOUT", time.Minute),
+		IdleTimeout:       envDuration("HTTP_IDLE_TIMEOUT", 2*time.Minute),
+		MaxHeaderBytes:    envInt("HTTP_MAX_HEADER_BYTES", 64<<10),
+	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- srv.ListenAndServe()
+	}()
+	slog.Info("listening", "addr", srv.Addr)
+
+	select {
+	case err = <-serverErr:
+		slog.Error("server failed", "error", err)
+	case <-ctx.Done():
+		stop()
+		slog.Info("shutting down")
+
+		// Fail readiness checks first and keep serving for a while, so load
+		// balancers stop sending requests before the listener closes.
+		readiness.Drain()
+		time.Sleep(envDuration("SHUTDOWN_DRAIN_DELAY", 5*time.Second))
+	}
 
-	// chirps
-	mux.HandleFunc("GET /api/chirps", apiHandlers.ListChirps)
-	mux.HandleFunc("GET /api/chirps/{chirpID}", apiHandlers.GetChirp)
-	mux.HandleFunc("POST /api/chirps", apiHandlers.CreateChirp)
-	mux.HandleFunc("DELETE /api/chirps/{chirpID}", apiHandlers.DeleteChirp)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), envDuration("SHUTDOWN_TIMEOUT", 30*time.Second))
+	defer cancel()
+	shutdown(shutdownCtx, srv, stopWorkers, workers, db, shutdownTracing)
+	if err != nil {
+		os.Exit(1)
+	}
+}
 
-	// auth
-	mux.HandleFunc("POST /api/login", apiHandlers.Login)
-	mux.HandleFunc("POST /api/refresh", apiHandlers.RefreshAccessToken)
-	mux.HandleFunc("POST /api/revoke", apiHandlers.RevokeRefreshToken)
+// shutdown waits for requests in flight and background jobs to finish, then
+// closes the database and flushes spans. Whatever has not finished by the
+// deadline in ctx is cut short.
+func shutdown(ctx context.Context, srv *http.Server, stopWorkers context.CancelFunc, workers *worker.Group, db *sql.DB, shutdownTracing func(context.Context) error) {
+	err := srv.Shutdown(ctx)
+	if err != nil {
+		slog.Error("requests did not finish before the shutdown deadline", "error", err)
+		srv.Close()
+	}
 
-	// users
-	mux.HandleFunc("POST /api/users", apiHandlers.CreateUser)
-	mux.HandleFunc("PUT /api/users", apiHandlers.UpdateUser)
+	stopWorkers()
+	done := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		slog.Error("background jobs did not stop before the shutdown deadline")
+	}
 
-	// webhook
-	mux.HandleFunc("POST /api/polka/webhooks", apiHandlers.Webhook)
+	err = db.Close()
+	if err != nil {
+		slog.Error("failed to close database", "error", err)
+	}
 
-	mux.Handle("/app/", apiMiddlewares.MiddlewareMetricsInc(http.StripPrefix("/app", http.FileServer(http.Dir("./app")))))
+	err = shutdownTracing(ctx)
+	if err != nil {
+		slog.Error("failed to flush traces", "error", err)
+	}
+	slog.Info("shut down")
+}
 
-	fs := http.FileServer(http.Dir("./app/assets/"))
-	mux.Handle("/app/assets", http.StripPrefix("/app/assets", fs))
+// newMailer returns an SMTP mailer when MAILER=smtp. Otherwise messages are
+// written to MAIL_LOG_FILE. There is no fallback to stderr: messages carry
+// live reset, sign-in and verification links, which do not belong in the
+// logs.
+func newMailer() mailer.Mailer {
+	if os.Getenv("MAILER") == "smtp" {
+		return mailer.NewSMTPMailer(
+			os.Getenv("SMTP_HOST"),
+			os.Getenv("SMTP_PORT"),
+			os.Getenv("SMTP_USERNAME"),
+			os.Getenv("SMTP_PASSWORD"),
+			os.Getenv("MAIL_FROM"),
+		)
+	}
 
-	mux.HandleFunc("GET /admin/metrics", adminHandlers.GetMetrics)
-	mux.HandleFunc("POST /admin/reset", adminHandlers.Reset)
+	mailLogFile := os.Getenv("MAIL_LOG_FILE")
+	if mailLogFile == "" {
+		log.Fatal("set MAILER=smtp to send email, or MAIL_LOG_FILE to write it to a file")
+	}
 
-	srv := &http.Server{Addr: ":8080", Handler: &mux}
+	f, err := os.OpenFile(mailLogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return mailer.NewLogMailer(f)
+}
+
+// newBillingProviders sets up the payment providers that have credentials.
+// Polka is signed with POLKA_WEBHOOK_SECRETS, or authenticated with POLKA_KEY
+// when POLKA_AUTH_MODE=api_key. Without POLKA_AUTH_MODE, Polka uses whichever
+// of the two is set, preferring signatures, so deployments that predate
+// signing keep working with only POLKA_KEY. Stripe is signed with STRIPE_WEBHOOK_SECRETS.
+func newBillingProviders() map[string]billing.Provider {
+	var providers []billing.Provider
+
+	polka := &billing.Polka{
+		AuthMode:  os.Getenv("POLKA_AUTH_MODE"),
+		APIKey:    os.Getenv("POLKA_KEY"),
+		Secrets:   envList("POLKA_WEBHOOK_SECRETS"),
+		Tolerance: envDuration("POLKA_SIGNATURE_TOLERANCE", 5*time.Minute),
+	}
+	switch polka.AuthMode {
+	case "":
+		if len(polka.Secrets) > 0 {
+			polka.AuthMode = billing.PolkaAuthHMAC
+			providers = append(providers, polka)
+		} else if polka.APIKey != "" {
+			slog.Warn("Polka webhooks are authenticated with POLKA_KEY; set POLKA_WEBHOOK_SECRETS to verify signatures instead")
+			polka.AuthMode = billing.PolkaAuthAPIKey
+			providers = append(providers, polka)
+		}
+	case billing.PolkaAuthHMAC:
+		if len(polka.Secrets) == 0 {
+			log.Fatal("POLKA_WEBHOOK_SECRETS is required when POLKA_AUTH_MODE=hmac")
+		}
+		providers = append(providers, polka)
+	case billing.PolkaAuthAPIKey:
+		if polka.APIKey == "" {
+			log.Fatal("POLKA_KEY is required when POLKA_AUTH_MODE=api_key")
+		}
+		providers = append(providers, polka)
+	default:
+		log.Fatalf("invalid POLKA_AUTH_MODE %q", polka.AuthMode)
+	}
+
+	stripe := &billing.Stripe{
+		Secrets:   envList("STRIPE_WEBHOOK_SECRETS"),
+		Tolerance: envDuration("STRIPE_SIGNATURE_TOLERANCE", 5*time.Minute),
+	}
+	if len(stripe.Secrets) > 0 {
+		providers = append(providers, stripe)
+	}
+
+	if len(providers) == 0 {
+		slog.Warn("no payment provider is configured, billing webhooks are disabled")
+	}
+
+	byName := make(map[string]billing.Provider, len(providers))
+	for _, provider := range providers {
+		byName[provider.Name()] = provider
+	}
+	return byName
+}
+
+// newPasskeyService sets up the WebAuthn relying party. WEBAUTHN_RP_ID defaults
+// to the host of BASE_URL and WEBAUTHN_ORIGINS, a comma-separated list, to
+// BASE_URL itself.
+func newPasskeyService(baseURL string) *passkey.Service {
+	rpID := os.Getenv("WEBAUTHN_RP_ID")
+	if rpID == "" {
+		parsed, err := url.Parse(baseURL)
+		if err != nil {
+			log.Fatalf("invalid BASE_URL: %v", err)
+		}
+		rpID = parsed.Hostname()
+	}
+
+	origins := []string{baseURL}
+	if value := os.Getenv("WEBAUTHN_ORIGINS"); value != "" {
+		origins = nil
+		for _, origin := range strings.Split(value, ",") {
+			origins = append(origins, strings.TrimSpace(origin))
+		}
+	}
+
+	service, err := passkey.NewService(rpID, "Chirpy", origins)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return service
+}
+
+func envInt(name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		log.Fatalf("invalid %s: %v", name, err)
+	}
+	return parsed
+}
+
+// envList splits a comma-separated variable, dropping empty entries.
+func envList(name string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(name), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func envFloat(name string, fallback float64) float64 {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Fatalf("invalid %s: %v", name, err)
+	}
+	return parsed
+}
+
+func envDuration(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
 
-	err = srv.ListenAndServe()
+	parsed, err := time.ParseDuration(value)
 	if err != nil {
-		panic(err)
+		log.Fatalf("invalid %s: %v", name, err)
 	}
+	return parsed
 }
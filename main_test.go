@@ -0,0 +1,43 @@
+package main
+
+import (
+	"chirpy/internal/billing"
+	"testing"
+)
+
+func TestNewBillingProvidersPolkaAuthMode(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		secrets string
+		want    string
+	}{
+		{name: "signing secrets", secrets: "secret", want: billing.PolkaAuthHMAC},
+		{name: "only an API key", key: "polka-key", want: billing.PolkaAuthAPIKey},
+		{name: "both", key: "polka-key", secrets: "secret", want: billing.PolkaAuthHMAC},
+		{name: "neither"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("POLKA_AUTH_MODE", "")
+			t.Setenv("POLKA_KEY", tc.key)
+			t.Setenv("POLKA_WEBHOOK_SECRETS", tc.secrets)
+			t.Setenv("STRIPE_WEBHOOK_SECRETS", "")
+
+			provider, ok := newBillingProviders()["polka"]
+			if tc.want == "" {
+				if ok {
+					t.Fatalf("Expected Polka to be disabled")
+				}
+				return
+			}
+			if !ok {
+				t.Fatalf("Expected Polka to be enabled")
+			}
+			if mode := provider.(*billing.Polka).AuthMode; mode != tc.want {
+				t.Fatalf("Expected auth mode %s, got %s", tc.want, mode)
+			}
+		})
+	}
+}
@@ -1,16 +1,31 @@
 package metrics
 
 import (
+	"database/sql"
 	"fmt"
+	"io"
 	"sync/atomic"
+	"time"
 )
 
 type API struct {
 	FileserverHits atomic.Int32
+
+	// Requests counts and times requests by route pattern, method and
+	// status.
+	Requests         CounterVec
+	RequestDurations HistogramVec
+	InFlight         atomic.Int64
+
+	ChirpsCreated     CounterVec
+	Logins            CounterVec
+	WebhooksProcessed CounterVec
 }
 
 func NewAPIMetrics() *API {
-	return &API{}
+	return &API{
+		RequestDurations: HistogramVec{Buckets: DefaultBuckets},
+	}
 }
 
 func (c *API) IncMetric() {
@@ -27,3 +42,54 @@ func (c *API) ResetMetrics() bool {
 	success := c.FileserverHits.CompareAndSwap(hits, 0)
 	return success
 }
+
+// ObserveRequest records a finished request. route is the pattern it
+// matched without its method, so the number of series stays bounded.
+func (c *API) ObserveRequest(route, method string, status int, duration time.Duration) {
+	labels := []Label{{"route", route}, {"method", method}, {"status", fmt.Sprint(status)}}
+	c.Requests.Inc(labels...)
+	c.RequestDurations.Observe(duration.Seconds(), labels...)
+}
+
+// ChirpsCreatedBy counts n chirps created through source: api or import.
+func (c *API) ChirpsCreatedBy(source string, n int) {
+	c.ChirpsCreated.Add(float64(n), Label{"source", source})
+}
+
+// LoginAttempt counts a login by whether it succeeded.
+func (c *API) LoginAttempt(succeeded bool) {
+	result := "failure"
+	if succeeded {
+		result = "success"
+	}
+	c.Logins.Inc(Label{"result", result})
+}
+
+// WebhookProcessed counts an incoming webhook by provider and result:
+// processed, duplicate or failed.
+func (c *API) WebhookProcessed(provider, result string) {
+	c.WebhooksProcessed.Inc(Label{"provider", provider}, Label{"result", result})
+}
+
+// WritePrometheus writes every metric in the Prometheus text exposition
+// format, along with the connection pool stats in db.
+func (c *API) WritePrometheus(w io.Writer, db sql.DBStats) {
+	c.Requests.write(w, "chirpy_http_requests_total", "HTTP requests by route, method and status.")
+	c.RequestDurations.write(w, "chirpy_http_request_duration_seconds", "HTTP request latency by route, method and status.")
+	writeValue(w, "chirpy_http_requests_in_flight", "HTTP requests being served.", "gauge", float64(c.InFlight.Load()))
+	writeValue(w, "chirpy_fileserver_hits", "Requests to /app since the last reset.", "gauge", float64(c.FileserverHits.Load()))
+
+	writeValue(w, "chirpy_db_max_open_connections", "Maximum number of open database connections.", "gauge", float64(db.MaxOpenConnections))
+	writeValue(w, "chirpy_db_open_connections", "Open database connections.", "gauge", float64(db.OpenConnections))
+	writeValue(w, "chirpy_db_in_use_connections", "Database connections in use.", "gauge", float64(db.InUse))
+	writeValue(w, "chirpy_db_idle_connections", "Idle database connections.", "gauge", float64(db.Idle))
+	writeValue(w, "chirpy_db_wait_count_total", "Times a query waited for a database connection.", "counter", float64(db.WaitCount))
+	writeValue(w, "chirpy_db_wait_duration_seconds_total", "Time spent waiting for database connections.", "counter", db.WaitDuration.Seconds())
+	writeValue(w, "chirpy_db_max_idle_closed_total", "Connections closed because of the idle limit.", "counter", float64(db.MaxIdleClosed))
+	writeValue(w, "chirpy_db_max_idle_time_closed_total", "Connections closed because they were idle too long.", "counter", float64(db.MaxIdleTimeClosed))
+	writeValue(w, "chirpy_db_max_lifetime_closed_total", "Connections closed because they reached their maximum lifetime.", "counter", float64(db.MaxLifetimeClosed))
+
+	c.ChirpsCreated.write(w, "chirpy_chirps_created_total", "Chirps created, by source.")
+	c.Logins.write(w, "chirpy_logins_total", "Login attempts by result.")
+	c.WebhooksProcessed.write(w, "chirpy_webhooks_processed_total", "Incoming webhooks by provider and result.")
+}
@@ -0,0 +1,168 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// PrometheusContentType is the content type of the text exposition format.
+const PrometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets are the upper bounds, in seconds, of request duration
+// histogram buckets.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Label is a label name and value pair.
+type Label struct {
+	Name  string
+	Value string
+}
+
+// labelSet renders labels the way they appear between braces in the
+// exposition format. It doubles as the key of a series.
+func labelSet(labels []Label) string {
+	var b strings.Builder
+	for i, label := range labels {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(label.Name)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabelValue(label.Value))
+		b.WriteByte('"')
+	}
+	return b.String()
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// CounterVec is a counter per combination of label values.
+type CounterVec struct {
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+func (c *CounterVec) Add(value float64, labels ...Label) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.values == nil {
+		c.values = make(map[string]float64)
+	}
+	c.values[labelSet(labels)] += value
+}
+
+func (c *CounterVec) Inc(labels ...Label) {
+	c.Add(1, labels...)
+}
+
+func (c *CounterVec) write(w io.Writer, name, help string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	writeHeader(w, name, help, "counter")
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s%s %s\n", name, braces(key), formatFloat(c.values[key]))
+	}
+}
+
+type histogram struct {
+	// counts are per bucket, not cumulative; they are summed when written.
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// HistogramVec is a histogram per combination of label values.
+type HistogramVec struct {
+	Buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*histogram
+}
+
+func (h *HistogramVec) Observe(value float64, labels ...Label) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.series == nil {
+		h.series = make(map[string]*histogram)
+	}
+	key := labelSet(labels)
+	series, ok := h.series[key]
+	if !ok {
+		series = &histogram{counts: make([]uint64, len(h.Buckets))}
+		h.series[key] = series
+	}
+
+	for i, bound := range h.Buckets {
+		if value <= bound {
+			series.counts[i]++
+			break
+		}
+	}
+	series.sum += value
+	series.count++
+}
+
+func (h *HistogramVec) write(w io.Writer, name, help string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	writeHeader(w, name, help, "histogram")
+	for _, key := range sortedKeys(h.series) {
+		series := h.series[key]
+		prefix := key
+		if prefix != "" {
+			prefix += ","
+		}
+
+		var cumulative uint64
+		for i, bound := range h.Buckets {
+			cumulative += series.counts[i]
+			fmt.Fprintf(w, "%s_bucket{%sle=\"%s\"} %d\n", name, prefix, formatFloat(bound), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket{%sle=\"+Inf\"} %d\n", name, prefix, series.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", name, braces(key), formatFloat(series.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", name, braces(key), series.count)
+	}
+}
+
+func writeHeader(w io.Writer, name, help, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, kind)
+}
+
+// writeValue writes a metric with a single unlabelled value.
+func writeValue(w io.Writer, name, help, kind string, value float64) {
+	writeHeader(w, name, help, kind)
+	fmt.Fprintf(w, "%s %s\n", name, formatFloat(value))
+}
+
+func braces(key string) string {
+	if key == "" {
+		return ""
+	}
+	return "{" + key + "}"
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
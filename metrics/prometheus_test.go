@@ -0,0 +1,59 @@
+package metrics_test
+
+import (
+	"chirpy/metrics"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWritePrometheus(t *testing.T) {
+	apiMetrics := metrics.NewAPIMetrics()
+	apiMetrics.ObserveRequest("/api/chirps/{chirpID}", "GET", 200, 30*time.Millisecond)
+	apiMetrics.ObserveRequest("/api/chirps/{chirpID}", "GET", 200, 2*time.Second)
+	apiMetrics.ObserveRequest("/api/chirps", "POST", 400, time.Millisecond)
+	apiMetrics.LoginAttempt(false)
+	apiMetrics.ChirpsCreatedBy("import", 3)
+	apiMetrics.WebhookProcessed("polka", "processed")
+
+	var b strings.Builder
+	apiMetrics.WritePrometheus(&b, sql.DBStats{OpenConnections: 4, InUse: 1, Idle: 3})
+	output := b.String()
+
+	for _, line := range []string{
+		"# TYPE chirpy_http_requests_total counter",
+		`chirpy_http_requests_total{route="/api/chirps/{chirpID}",method="GET",status="200"} 2`,
+		`chirpy_http_requests_total{route="/api/chirps",method="POST",status="400"} 1`,
+		"# TYPE chirpy_http_request_duration_seconds histogram",
+		`chirpy_http_request_duration_seconds_bucket{route="/api/chirps/{chirpID}",method="GET",status="200",le="0.025"} 0`,
+		`chirpy_http_request_duration_seconds_bucket{route="/api/chirps/{chirpID}",method="GET",status="200",le="0.05"} 1`,
+		`chirpy_http_request_duration_seconds_bucket{route="/api/chirps/{chirpID}",method="GET",status="200",le="2.5"} 2`,
+		`chirpy_http_request_duration_seconds_bucket{route="/api/chirps/{chirpID}",method="GET",status="200",le="+Inf"} 2`,
+		`chirpy_http_request_duration_seconds_sum{route="/api/chirps/{chirpID}",method="GET",status="200"} 2.03`,
+		`chirpy_http_request_duration_seconds_count{route="/api/chirps/{chirpID}",method="GET",status="200"} 2`,
+		"chirpy_http_requests_in_flight 0",
+		"chirpy_db_open_connections 4",
+		"chirpy_db_idle_connections 3",
+		`chirpy_logins_total{result="failure"} 1`,
+		`chirpy_chirps_created_total{source="import"} 3`,
+		`chirpy_webhooks_processed_total{provider="polka",result="processed"} 1`,
+	} {
+		if !strings.Contains(output, line+"\n") {
+			t.Errorf("Expected line %q in:\n%s", line, output)
+		}
+	}
+}
+
+func TestLabelValuesAreEscaped(t *testing.T) {
+	apiMetrics := metrics.NewAPIMetrics()
+	apiMetrics.WebhookProcessed("a\"b\\c\nd", "failed")
+
+	var b strings.Builder
+	apiMetrics.WritePrometheus(&b, sql.DBStats{})
+
+	want := `chirpy_webhooks_processed_total{provider="a\"b\\c\nd",result="failed"} 1`
+	if !strings.Contains(b.String(), want) {
+		t.Fatalf("Expected %q in:\n%s", want, b.String())
+	}
+}
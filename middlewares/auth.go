@@ -0,0 +1,226 @@
+package middlewares
+
+import (
+	"chirpy/internal/auth"
+	"chirpy/utils"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+var (
+	errMissingCredentials = errors.New("missing credentials")
+	errAccountDeleted     = errors.New("account is scheduled for deletion")
+)
+
+// RequireAuth rejects requests without a valid bearer token and stores the
+// authenticated Principal in the request context.
+func (m *Middlewares) RequireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, err := m.authenticate(r)
+		if err != nil {
+			respondUnauthorized(w, err)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+	})
+}
+
+// OptionalAuth lets anonymous requests through, but a request that does send
+// credentials must send valid ones.
+func (m *Middlewares) OptionalAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, err := m.authenticate(r)
+		if errors.Is(err, errMissingCredentials) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if err != nil {
+			respondUnauthorized(w, err)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+	})
+}
+
+// RequirePermission authenticates the request and rejects principals whose
+// role does not grant permission. Roles come from the access token, so a role
+// change takes effect once the user's current token expires.
+func (m *Middlewares) RequirePermission(permission auth.Permission, next http.Handler) http.Handler {
+	return m.RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, _ := auth.PrincipalFromContext(r.Context())
+		if !principal.Role.Can(permission) {
+			slog.WarnContext(r.Context(), "permission denied", "user_id", principal.UserID, "role", principal.Role, "permission", permission)
+			utils.RespondError(w, http.StatusForbidden, "Forbidden")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}))
+}
+
+// RequireScope rejects principals that were not granted scope. Requests
+// without a principal pass through: whether a route needs credentials at all
+// is up to RequireAuth or OptionalAuth in front of it.
+func (m *Middlewares) RequireScope(scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := auth.PrincipalFromContext(r.Context())
+		if ok && !principal.HasScope(scope) {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="chirpy", error="insufficient_scope", scope=%q`, scope))
+			utils.RespondError(w, http.StatusForbidden, "Insufficient scope")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireSession authenticates the request and only accepts first-party
+// sessions. Routes that manage credentials use it so a delegated key cannot
+// mint or revoke other credentials.
+func (m *Middlewares) RequireSession(next http.Handler) http.Handler {
+	return m.RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, _ := auth.PrincipalFromContext(r.Context())
+		if !principal.IsSession() {
+			utils.RespondError(w, http.StatusForbidden, "This endpoint requires a user session")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}))
+}
+
+func (m *Middlewares) authenticate(r *http.Request) (*auth.Principal, error) {
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		return nil, errMissingCredentials
+	}
+
+	if scheme, _, _ := strings.Cut(authHeader, " "); strings.EqualFold(scheme, "apikey") {
+		return m.authenticateAPIKey(r)
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := auth.ParseJWT(token, m.APIConfig.JWTSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	// Access tokens outlive the sign-out that scheduling a deletion does, so
+	// the account is checked on every request, as it is for API keys.
+	userActive, err := m.DBQueries.IsUserActive(r.Context(), userID)
+	if err != nil {
+		return nil, err
+	}
+	if !userActive {
+		return nil, errAccountDeleted
+	}
+
+	// Revoking an OAuth grant revokes its session, which has to cut off the
+	// access tokens already issued for it, not only its refresh tokens.
+	if claims.ClientID != "" {
+		sessionID, err := uuid.Parse(claims.SessionID)
+		if err != nil {
+			return nil, err
+		}
+		active, err := m.DBQueries.IsSessionActive(r.Context(), sessionID)
+		if err != nil {
+			return nil, err
+		}
+		if !active {
+			return nil, errors.New("OAuth grant has been revoked")
+		}
+	}
+
+	role, ok := auth.ParseRole(claims.Role)
+	if !ok {
+		role = auth.RoleUser
+	}
+
+	return &auth.Principal{
+		UserID: userID,
+		// Sessions never carry a client or scopes. An OAuth token whose
+		// scopes are empty is still delegated.
+		Delegated: claims.ClientID != "" || claims.Scopes != nil,
+		Scopes:    claims.Scopes,
+		SessionID: claims.SessionID,
+		Tier:      claims.Tier,
+		Role:      role,
+		ClientID:  claims.ClientID,
+	}, nil
+}
+
+func (m *Middlewares) authenticateAPIKey(r *http.Request) (*auth.Principal, error) {
+	key, err := auth.GetAPIKey(r.Header)
+	if err != nil {
+		return nil, err
+	}
+
+	apiKey, err := m.DBQueries.GetActiveAPIKeyByHash(r.Context(), auth.HashToken(key))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.New("unknown, revoked or expired API key")
+		}
+		return nil, err
+	}
+
+	user, err := m.DBQueries.GetUserByID(r.Context(), apiKey.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.DeleteAfter.Valid {
+		return nil, errAccountDeleted
+	}
+
+	err = m.DBQueries.TouchAPIKey(r.Context(), apiKey.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to update API key last use", "error", err)
+	}
+
+	tier := auth.TierFree
+	if user.IsChirpyRed {
+		tier = auth.TierChirpyRed
+	}
+
+	// Keys never carry the user's role: admin routes need a session.
+	scopes := apiKey.Scopes
+	if scopes == nil {
+		scopes = []string{}
+	}
+
+	return &auth.Principal{
+		UserID:    user.ID,
+		Delegated: true,
+		Scopes:    scopes,
+		Tier:      tier,
+		Role:      auth.RoleUser,
+	}, nil
+}
+
+func respondUnauthorized(w http.ResponseWriter, err error) {
+	challenge := `Bearer realm="chirpy"`
+	if !errors.Is(err, errMissingCredentials) {
+		slog.Error("failed to authenticate request", "error", err)
+		challenge += `, error="invalid_token"`
+	}
+
+	w.Header().Set("WWW-Authenticate", challenge)
+	utils.RespondError(w, http.StatusUnauthorized, "Unauthorized")
+}
@@ -0,0 +1,309 @@
+package middlewares_test
+
+import (
+	"chirpy/internal/auth"
+	"chirpy/internal/config"
+	"chirpy/internal/database"
+	"chirpy/metrics"
+	"chirpy/middlewares"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+)
+
+const testSecret = "test-secret"
+
+func newTestMiddlewares() *middlewares.Middlewares {
+	return middlewares.NewMiddlewares(metrics.NewAPIMetrics(), &config.APIConfig{JWTSecret: testSecret}, nil)
+}
+
+// newAuthTestMiddlewares returns middlewares backed by a mock database, for
+// tests that authenticate requests. Every expectation must be met by the end
+// of the test.
+func newAuthTestMiddlewares(t *testing.T) (*middlewares.Middlewares, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open mock database: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		db.Close()
+	})
+
+	return middlewares.NewMiddlewares(metrics.NewAPIMetrics(), &config.APIConfig{JWTSecret: testSecret}, database.New(db)), mock
+}
+
+// expectUser expects an access token's account to be looked up.
+func expectUser(mock sqlmock.Sqlmock, userID any, active bool) {
+	mock.ExpectQuery("IsUserActive").WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(active))
+}
+
+func TestRequireAuthInjectsPrincipal(t *testing.T) {
+	userID := uuid.New()
+	token, err := auth.MakeJWTWithClaims(userID, testSecret, time.Minute, auth.Claims{
+		SessionID: "session-1",
+		Tier:      auth.TierChirpyRed,
+	})
+	if err != nil {
+		t.Fatalf("Failed to make JWT: %v", err)
+	}
+
+	m, mock := newAuthTestMiddlewares(t)
+	expectUser(mock, userID.String(), true)
+
+	var got *auth.Principal
+	handler := m.RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = auth.PrincipalFromContext(r.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/chirps", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	if got == nil {
+		t.Fatalf("Expected principal in request context")
+	}
+	if got.UserID != userID || got.SessionID != "session-1" || got.Tier != auth.TierChirpyRed {
+		t.Fatalf("Unexpected principal: %+v", got)
+	}
+}
+
+func TestRequireAuthRejectsRequests(t *testing.T) {
+	expired, err := auth.MakeJWT(uuid.New(), testSecret, -time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to make JWT: %v", err)
+	}
+	wrongSecret, err := auth.MakeJWT(uuid.New(), "other-secret", time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to make JWT: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		authorization string
+		challenge     string
+	}{
+		{"missing header", "", `Bearer realm="chirpy"`},
+		{"malformed header", "Token abc", `Bearer realm="chirpy", error="invalid_token"`},
+		{"expired token", "Bearer " + expired, `Bearer realm="chirpy", error="invalid_token"`},
+		{"wrong secret", "Bearer " + wrongSecret, `Bearer realm="chirpy", error="invalid_token"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := newTestMiddlewares().RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				t.Fatalf("Handler should not be called")
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/api/chirps", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusUnauthorized {
+				t.Fatalf("Expected status 401, got %d", rec.Code)
+			}
+			if got := rec.Header().Get("WWW-Authenticate"); got != tt.challenge {
+				t.Fatalf("Expected WWW-Authenticate %q, got %q", tt.challenge, got)
+			}
+			if !strings.Contains(rec.Body.String(), "error") {
+				t.Fatalf("Expected JSON error body, got %q", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestOptionalAuthAllowsAnonymous(t *testing.T) {
+	called := false
+	handler := newTestMiddlewares().OptionalAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		if _, ok := auth.PrincipalFromContext(r.Context()); ok {
+			t.Fatalf("Expected no principal for anonymous request")
+		}
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/chirps", nil))
+
+	if !called || rec.Code != http.StatusOK {
+		t.Fatalf("Expected anonymous request to reach the handler, got status %d", rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/chirps", nil)
+	req.Header.Set("Authorization", "Bearer not-a-jwt")
+	rec = httptest.NewRecorder()
+	called = false
+	handler.ServeHTTP(rec, req)
+
+	if called || rec.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected invalid credentials to be rejected, got status %d", rec.Code)
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	tests := []struct {
+		role       auth.Role
+		permission auth.Permission
+		status     int
+	}{
+		{auth.RoleUser, auth.PermissionViewMetrics, http.StatusForbidden},
+		{auth.RoleModerator, auth.PermissionModerateChirps, http.StatusOK},
+		{auth.RoleModerator, auth.PermissionResetDatabase, http.StatusForbidden},
+		{auth.RoleAdmin, auth.PermissionResetDatabase, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.role)+" "+string(tt.permission), func(t *testing.T) {
+			userID := uuid.New()
+			token, err := auth.MakeJWTWithClaims(userID, testSecret, time.Minute, auth.Claims{Role: string(tt.role)})
+			if err != nil {
+				t.Fatalf("Failed to make JWT: %v", err)
+			}
+
+			m, mock := newAuthTestMiddlewares(t)
+			expectUser(mock, userID.String(), true)
+			handler := m.RequirePermission(tt.permission, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			req := httptest.NewRequest(http.MethodGet, "/admin/metrics", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d", tt.status, rec.Code)
+			}
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	newTestMiddlewares().RequirePermission(auth.PermissionViewMetrics, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).
+		ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/metrics", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected anonymous admin request to get 401, got %d", rec.Code)
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	handler := newTestMiddlewares().RequireScope(auth.ScopeChirpsWrite, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		name      string
+		principal *auth.Principal
+		status    int
+	}{
+		{"anonymous", nil, http.StatusOK},
+		{"session", &auth.Principal{UserID: uuid.New()}, http.StatusOK},
+		{"key with scope", &auth.Principal{UserID: uuid.New(), Scopes: []string{auth.ScopeChirpsRead, auth.ScopeChirpsWrite}}, http.StatusOK},
+		{"key without scope", &auth.Principal{UserID: uuid.New(), Scopes: []string{auth.ScopeChirpsRead}}, http.StatusForbidden},
+		{"key without any scopes", &auth.Principal{UserID: uuid.New(), Scopes: []string{}}, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/chirps", nil)
+			if tt.principal != nil {
+				req = req.WithContext(auth.WithPrincipal(req.Context(), tt.principal))
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d", tt.status, rec.Code)
+			}
+			if tt.status == http.StatusForbidden && !strings.Contains(rec.Header().Get("WWW-Authenticate"), `error="insufficient_scope"`) {
+				t.Fatalf("Expected insufficient_scope challenge, got %q", rec.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestOAuthAccessTokens(t *testing.T) {
+	m, mock := newAuthTestMiddlewares(t)
+
+	sessionID := uuid.New()
+	oauthToken := func(scopes []string) string {
+		token, err := auth.MakeJWTWithClaims(uuid.New(), testSecret, time.Minute, auth.Claims{
+			Scopes:    scopes,
+			SessionID: sessionID.String(),
+			ClientID:  uuid.NewString(),
+		})
+		if err != nil {
+			t.Fatalf("Failed to make JWT: %v", err)
+		}
+		return token
+	}
+	serve := func(handler http.Handler, token string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/tokens", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	expectSession := func(active bool) {
+		expectUser(mock, sqlmock.AnyArg(), true)
+		mock.ExpectQuery("IsSessionActive").
+			WithArgs(sessionID.String()).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(active))
+	}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	expectSession(true)
+	if status := serve(m.RequireAuth(m.RequireScope(auth.ScopeChirpsWrite, ok)), oauthToken([]string{auth.ScopeChirpsWrite})); status != http.StatusOK {
+		t.Fatalf("Expected a token of an active grant to be accepted, got %d", status)
+	}
+
+	// Empty scopes are dropped from the JWT, which must not turn the token
+	// into a session.
+	expectSession(true)
+	if status := serve(m.RequireSession(ok), oauthToken([]string{})); status != http.StatusForbidden {
+		t.Fatalf("Expected a token without scopes to be refused a session route, got %d", status)
+	}
+	expectSession(true)
+	if status := serve(m.RequireAuth(m.RequireScope(auth.ScopeProfileWrite, ok)), oauthToken(nil)); status != http.StatusForbidden {
+		t.Fatalf("Expected a token without scopes to have none, got %d", status)
+	}
+
+	expectSession(false)
+	if status := serve(m.RequireAuth(ok), oauthToken([]string{auth.ScopeChirpsWrite})); status != http.StatusUnauthorized {
+		t.Fatalf("Expected a token of a revoked grant to be rejected, got %d", status)
+	}
+}
+
+func TestAccessTokensOfAccountsScheduledForDeletion(t *testing.T) {
+	m, mock := newAuthTestMiddlewares(t)
+
+	userID := uuid.New()
+	token, err := auth.MakeJWTWithClaims(userID, testSecret, time.Minute, auth.Claims{SessionID: "session-1"})
+	if err != nil {
+		t.Fatalf("Failed to make JWT: %v", err)
+	}
+	expectUser(mock, userID.String(), false)
+
+	handler := m.RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatalf("Handler should not be called")
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/api/users/me", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected the token of an account scheduled for deletion to be rejected, got %d", rec.Code)
+	}
+}
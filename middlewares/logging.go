@@ -0,0 +1,58 @@
+package middlewares
+
+import (
+	"chirpy/internal/logging"
+	"chirpy/utils"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// validRequestID limits the request IDs taken from callers to ones that are
+// safe to put in logs and headers.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestID stores the caller's X-Request-ID, or a new one when it is missing
+// or malformed, in the request context and echoes it in the response.
+func (m *Middlewares) RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = uuid.NewString()
+		}
+
+		w.Header().Set(RequestIDHeader, id)
+		serveWithContext(next, w, r, logging.WithRequestID(r.Context(), id))
+	})
+}
+
+// AccessLog logs every request once it is done. Only the path is logged, not
+// the query string, which can carry tokens.
+func (m *Middlewares) AccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		level := slog.LevelInfo
+		if recorder.status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+
+		slog.LogAttrs(r.Context(), level, "request",
+			slog.String("method", r.Method),
+			slog.String("route", routeLabel(r.Pattern)),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", recorder.status),
+			slog.Int("bytes", recorder.bytes),
+			slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("client_ip", utils.ClientIP(r, m.APIConfig.TrustProxyHeaders)),
+			slog.String("user_agent", r.UserAgent()),
+		)
+	})
+}
@@ -0,0 +1,68 @@
+package middlewares_test
+
+import (
+	"bytes"
+	"chirpy/internal/logging"
+	"chirpy/middlewares"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestIDIsAcceptedOrGenerated(t *testing.T) {
+	var got string
+	handler := newTestMiddlewares().RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = logging.RequestID(r.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/chirps", nil)
+	req.Header.Set(middlewares.RequestIDHeader, "lb-1234")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if got != "lb-1234" || rec.Header().Get(middlewares.RequestIDHeader) != "lb-1234" {
+		t.Fatalf("Expected the caller's request ID, got %q", got)
+	}
+
+	req.Header.Set(middlewares.RequestIDHeader, "bad id\nwith newline")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if got == "" || got == "bad id\nwith newline" || rec.Header().Get(middlewares.RequestIDHeader) != got {
+		t.Fatalf("Expected a generated request ID, got %q", got)
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	var b bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(logging.New(&b, slog.LevelInfo))
+	defer slog.SetDefault(defaultLogger)
+
+	m := newTestMiddlewares()
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/chirps/{chirpID}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("missing"))
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/chirps/42?token=s3cret", nil)
+	req.Header.Set(middlewares.RequestIDHeader, "req-7")
+	m.RequestID(m.AccessLog(mux)).ServeHTTP(httptest.NewRecorder(), req)
+
+	var record map[string]any
+	err := json.Unmarshal(b.Bytes(), &record)
+	if err != nil {
+		t.Fatalf("Expected one JSON access log line, got %q", b.String())
+	}
+
+	if record["request_id"] != "req-7" || record["route"] != "/api/chirps/{chirpID}" || record["path"] != "/api/chirps/42" {
+		t.Fatalf("Unexpected access log %v", record)
+	}
+	if record["status"] != float64(http.StatusNotFound) || record["bytes"] != float64(len("missing")) {
+		t.Fatalf("Unexpected access log %v", record)
+	}
+	if _, ok := record["duration_ms"]; !ok {
+		t.Fatalf("Expected a duration in %v", record)
+	}
+}
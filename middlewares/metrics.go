@@ -1,17 +1,27 @@
 package middlewares
 
 import (
+	"chirpy/internal/auth"
+	"chirpy/internal/config"
+	"chirpy/internal/database"
 	"chirpy/metrics"
+	"crypto/subtle"
 	"net/http"
+	"strings"
+	"time"
 )
 
 type Middlewares struct {
 	APIMetrics *metrics.API
+	APIConfig  *config.APIConfig
+	DBQueries  *database.Queries
 }
 
-func NewMiddlewares(apiMetrics *metrics.API) *Middlewares {
+func NewMiddlewares(apiMetrics *metrics.API, apiConfig *config.APIConfig, dbQueries *database.Queries) *Middlewares {
 	return &Middlewares{
 		APIMetrics: apiMetrics,
+		APIConfig:  apiConfig,
+		DBQueries:  dbQueries,
 	}
 }
 
@@ -22,3 +32,83 @@ func (m *Middlewares) MiddlewareMetricsInc(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// InstrumentRequests records the count, latency and status of every request
+// and how many are in flight. It wraps the whole mux: the mux sets r.Pattern
+// on the request it is given, so the matched route is known once it returns.
+func (m *Middlewares) InstrumentRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.APIMetrics.InFlight.Add(1)
+		defer m.APIMetrics.InFlight.Add(-1)
+
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		m.APIMetrics.ObserveRequest(routeLabel(r.Pattern), methodLabel(r.Method), recorder.status, time.Since(start))
+	})
+}
+
+// RequireMetricsToken guards the metrics endpoint with APIConfig.MetricsToken
+// as a bearer token. Without a token configured it is open.
+func (m *Middlewares) RequireMetricsToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if m.APIConfig.MetricsToken != "" {
+			token, err := auth.GetBearerToken(r.Header)
+			if err != nil || subtle.ConstantTimeCompare([]byte(token), []byte(m.APIConfig.MetricsToken)) != 1 {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// routeLabel drops the method from a pattern such as "GET /api/chirps/{chirpID}".
+// Requests that matched no route share one label instead of one per path.
+func routeLabel(pattern string) string {
+	if pattern == "" {
+		return "unmatched"
+	}
+	if _, path, found := strings.Cut(pattern, " "); found {
+		return path
+	}
+	return pattern
+}
+
+// methodLabel keeps made-up methods from creating new series.
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		return method
+	}
+	return "OTHER"
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	bytes       int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if !s.wroteHeader {
+		s.status = status
+		s.wroteHeader = true
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	s.wroteHeader = true
+	n, err := s.ResponseWriter.Write(b)
+	s.bytes += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
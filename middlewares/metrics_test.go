@@ -0,0 +1,68 @@
+package middlewares_test
+
+import (
+	"chirpy/internal/config"
+	"chirpy/metrics"
+	"chirpy/middlewares"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestInstrumentRequestsLabelsByRoutePattern(t *testing.T) {
+	apiMetrics := metrics.NewAPIMetrics()
+	m := middlewares.NewMiddlewares(apiMetrics, &config.APIConfig{}, nil)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/chirps/{chirpID}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	mux.HandleFunc("POST /api/chirps", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("{}"))
+	})
+	handler := m.InstrumentRequests(mux)
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/api/chirps/1", nil),
+		httptest.NewRequest(http.MethodGet, "/api/chirps/2", nil),
+		httptest.NewRequest(http.MethodPost, "/api/chirps", nil),
+		httptest.NewRequest("BREW", "/coffee", nil),
+	} {
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	var b strings.Builder
+	apiMetrics.WritePrometheus(&b, sql.DBStats{})
+	output := b.String()
+
+	for _, line := range []string{
+		`chirpy_http_requests_total{route="/api/chirps/{chirpID}",method="GET",status="404"} 2`,
+		`chirpy_http_requests_total{route="/api/chirps",method="POST",status="200"} 1`,
+		`chirpy_http_requests_total{route="unmatched",method="OTHER",status="404"} 1`,
+	} {
+		if !strings.Contains(output, line+"\n") {
+			t.Errorf("Expected line %q in:\n%s", line, output)
+		}
+	}
+}
+
+func TestRequireMetricsToken(t *testing.T) {
+	m := middlewares.NewMiddlewares(metrics.NewAPIMetrics(), &config.APIConfig{MetricsToken: "scrape"}, nil)
+	handler := m.RequireMetricsToken(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected status 401 without a token, got %d", rec.Code)
+	}
+
+	req.Header.Set("Authorization", "Bearer scrape")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 with the token, got %d", rec.Code)
+	}
+}
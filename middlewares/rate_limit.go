@@ -0,0 +1,61 @@
+package middlewares
+
+import (
+	"chirpy/utils"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimit lets each client IP make limit requests to next per window and
+// answers the rest with 429. Counts are kept in memory, so every instance of
+// the server has its own. A limit of 0 or less disables it.
+func (m *Middlewares) RateLimit(limit int, window time.Duration, next http.Handler) http.Handler {
+	if limit <= 0 {
+		return next
+	}
+
+	limiter := &rateLimiter{limit: limit, window: window, counts: map[string]int{}}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		retryAfter, ok := limiter.allow(utils.ClientIP(r, m.APIConfig.TrustProxyHeaders), time.Now())
+		if !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			utils.RespondError(w, http.StatusTooManyRequests, "Too many requests, try again later")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rateLimiter counts requests per client in fixed windows. All counts are
+// dropped when a window ends, which keeps the map from growing with every
+// client ever seen.
+type rateLimiter struct {
+	limit  int
+	window time.Duration
+
+	mu          sync.Mutex
+	windowStart time.Time
+	counts      map[string]int
+}
+
+// allow counts a request from client and reports whether it is within the
+// limit, or else how long until the next window starts.
+func (l *rateLimiter) allow(client string, now time.Time) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.windowStart) >= l.window {
+		l.windowStart = now
+		clear(l.counts)
+	}
+
+	if l.counts[client] >= l.limit {
+		return l.windowStart.Add(l.window).Sub(now), false
+	}
+	l.counts[client]++
+	return 0, true
+}
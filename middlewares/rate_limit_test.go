@@ -0,0 +1,42 @@
+package middlewares_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimitPerClientIP(t *testing.T) {
+	m := newTestMiddlewares()
+	handler := m.RateLimit(2, time.Minute, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	request := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/login/passkey/begin", nil)
+		req.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for i := range 2 {
+		if rec := request("192.0.2.1:1234"); rec.Code != http.StatusNoContent {
+			t.Fatalf("Expected request %d to be let through, got %d", i+1, rec.Code)
+		}
+	}
+
+	rec := request("192.0.2.1:5678")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected the third request to get 429, got %d", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Fatal("Expected a Retry-After header")
+	}
+
+	// Other clients have their own budget.
+	if rec := request("192.0.2.2:1234"); rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected another client to be let through, got %d", rec.Code)
+	}
+}
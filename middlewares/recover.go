@@ -0,0 +1,53 @@
+package middlewares
+
+import (
+	"chirpy/internal/logging"
+	"chirpy/utils"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+)
+
+// Recover turns a panic in a handler into a 500 that carries the request ID,
+// so a caller reporting the error can quote it, and logs the panic with its
+// stack trace. It sits inside AccessLog and InstrumentRequests so they record
+// the 500 like any other response.
+//
+// http.ErrAbortHandler is panicked again: handlers use it to have net/http cut
+// the connection, and net/http knows not to log it.
+func (m *Middlewares) Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+
+			slog.ErrorContext(r.Context(), "panic serving request",
+				"panic", v,
+				"stack", string(debug.Stack()),
+			)
+
+			// Part of a response has gone out already and a 500 can no longer
+			// be sent, so the connection is cut instead of leaving the client
+			// with a truncated body that looks complete.
+			if recorder.wroteHeader {
+				panic(http.ErrAbortHandler)
+			}
+
+			utils.RespondJSON(w, http.StatusInternalServerError, struct {
+				Error     string `json:"error"`
+				RequestID string `json:"request_id,omitempty"`
+			}{
+				Error:     "Internal server error",
+				RequestID: logging.RequestID(r.Context()),
+			})
+		}()
+
+		next.ServeHTTP(recorder, r)
+	})
+}
@@ -0,0 +1,89 @@
+package middlewares_test
+
+import (
+	"bytes"
+	"chirpy/internal/logging"
+	"chirpy/middlewares"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRecoverRespondsWithRequestID(t *testing.T) {
+	var b bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(logging.New(&b, slog.LevelInfo))
+	defer slog.SetDefault(defaultLogger)
+
+	m := newTestMiddlewares()
+	handler := m.RequestID(m.Recover(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var chirps map[string]string
+		chirps["boom"] = "nil map"
+	})))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/chirps", nil)
+	req.Header.Set(middlewares.RequestIDHeader, "req-9")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected status 500, got %d", rec.Code)
+	}
+	var body struct {
+		Error     string `json:"error"`
+		RequestID string `json:"request_id"`
+	}
+	err := json.NewDecoder(rec.Body).Decode(&body)
+	if err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if body.RequestID != "req-9" || body.Error == "" {
+		t.Fatalf("Unexpected response %+v", body)
+	}
+
+	var record map[string]any
+	err = json.Unmarshal(b.Bytes(), &record)
+	if err != nil {
+		t.Fatalf("Expected one JSON log line, got %q", b.String())
+	}
+	stack, _ := record["stack"].(string)
+	if record["request_id"] != "req-9" || !strings.Contains(stack, "recover_test.go") {
+		t.Fatalf("Expected the panic to be logged with its stack, got %v", record)
+	}
+}
+
+func TestRecoverRepanics(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{"abort handler", func(w http.ResponseWriter, r *http.Request) {
+			panic(http.ErrAbortHandler)
+		}},
+		{"response already started", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(`{"partial":`))
+			panic("boom")
+		}},
+	}
+
+	defaultLogger := slog.Default()
+	slog.SetDefault(logging.New(&bytes.Buffer{}, slog.LevelInfo))
+	defer slog.SetDefault(defaultLogger)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if v := recover(); v != http.ErrAbortHandler {
+					t.Fatalf("Expected http.ErrAbortHandler, got %v", v)
+				}
+			}()
+
+			handler := newTestMiddlewares().Recover(tt.handler)
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/chirps", nil))
+		})
+	}
+}
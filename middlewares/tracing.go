@@ -0,0 +1,51 @@
+package middlewares
+
+import (
+	"chirpy/internal/tracing"
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Trace starts a server span for every request, continuing the trace in the
+// caller's traceparent header if there is one. The span is named after the
+// route pattern the request matched, such as "GET /api/chirps/{chirpID}".
+func (m *Middlewares) Trace(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracing.Tracer().Start(ctx, r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(methodLabel(r.Method)),
+				semconv.URLPath(r.URL.Path),
+			),
+		)
+		defer span.End()
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		serveWithContext(next, recorder, r, ctx)
+
+		if r.Pattern != "" {
+			span.SetName(r.Pattern)
+			span.SetAttributes(semconv.HTTPRoute(routeLabel(r.Pattern)))
+		}
+		span.SetAttributes(semconv.HTTPResponseStatusCode(recorder.status))
+		if recorder.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(recorder.status))
+		}
+	})
+}
+
+// serveWithContext serves r with ctx. The mux records the route it matched on
+// the request it is given, so the pattern is copied back for the middlewares
+// further out that read it.
+func serveWithContext(next http.Handler, w http.ResponseWriter, r *http.Request, ctx context.Context) {
+	req := r.WithContext(ctx)
+	next.ServeHTTP(w, req)
+	r.Pattern = req.Pattern
+}
@@ -0,0 +1,59 @@
+package middlewares_test
+
+import (
+	"bytes"
+	"chirpy/internal/logging"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTraceNamesSpansAfterRoutes(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	var b bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(logging.New(&b, slog.LevelInfo))
+	defer slog.SetDefault(defaultLogger)
+
+	m := newTestMiddlewares()
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/chirps/{chirpID}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/chirps/42", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	m.RequestID(m.Trace(m.AccessLog(mux))).ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("Expected one span, got %d", len(spans))
+	}
+	span := spans[0]
+	if span.Name() != "GET /api/chirps/{chirpID}" {
+		t.Fatalf("Expected the span to be named after the route, got %q", span.Name())
+	}
+	if span.SpanContext().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" || span.Parent().SpanID().String() != "00f067aa0ba902b7" {
+		t.Fatalf("Expected the caller's trace to continue, got %v with parent %v", span.SpanContext().TraceID(), span.Parent().SpanID())
+	}
+
+	// The access log, outside the span, still sees the route and the trace.
+	var record map[string]any
+	err := json.Unmarshal(b.Bytes(), &record)
+	if err != nil {
+		t.Fatalf("Expected one JSON access log line, got %q", b.String())
+	}
+	if record["route"] != "/api/chirps/{chirpID}" || record["trace_id"] != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("Unexpected access log %v", record)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"chirpy/internal/health"
+	"chirpy/internal/worker"
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrations are the goose migrations this build expects the database to
+// have run.
+//
+//go:embed sql/schema/*.sql
+var migrations embed.FS
+
+// newReadiness returns the checks /api/readyz runs: the database answers, its
+// schema is migrated far enough for this build, and the background jobs are
+// making progress. Each check gets READINESS_CHECK_TIMEOUT and results are
+// reused for READINESS_CACHE_TTL.
+func newReadiness(db *sql.DB, workers *worker.Group) *health.Readiness {
+	expected, err := latestMigration(migrations)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	readiness := &health.Readiness{
+		Timeout:  envDuration("READINESS_CHECK_TIMEOUT", 2*time.Second),
+		CacheFor: envDuration("READINESS_CACHE_TTL", 2*time.Second),
+	}
+	readiness.Register("database", db.PingContext)
+	readiness.Register("migrations", checkMigrations(db, expected))
+	readiness.Register("workers", workers.Check)
+	return readiness
+}
+
+// checkMigrations fails while the database is behind expected. A database
+// that is ahead passes: during a deploy the new release migrates it while the
+// old one is still serving.
+func checkMigrations(db *sql.DB, expected int64) health.Check {
+	return func(ctx context.Context) error {
+		var version int64
+		err := db.QueryRowContext(ctx, "SELECT COALESCE(MAX(version_id), 0) FROM goose_db_version").Scan(&version)
+		if err != nil {
+			return err
+		}
+		if version < expected {
+			return fmt.Errorf("database is at migration %d, expected %d", version, expected)
+		}
+		return nil
+	}
+}
+
+// latestMigration returns the highest version among goose migrations named
+// like 001_users.sql.
+func latestMigration(fsys fs.FS) (int64, error) {
+	files, err := fs.Glob(fsys, "sql/schema/*.sql")
+	if err != nil {
+		return 0, err
+	}
+
+	var latest int64
+	for _, file := range files {
+		prefix, _, _ := strings.Cut(strings.TrimPrefix(file, "sql/schema/"), "_")
+		version, err := strconv.ParseInt(prefix, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("migration %s has no version", file)
+		}
+		latest = max(latest, version)
+	}
+	if latest == 0 {
+		return 0, fmt.Errorf("no migrations found")
+	}
+	return latest, nil
+}
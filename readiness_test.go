@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestLatestMigration(t *testing.T) {
+	latest, err := latestMigration(fstest.MapFS{
+		"sql/schema/001_users.sql":  {},
+		"sql/schema/010_tokens.sql": {},
+		"sql/schema/002_chirps.sql": {},
+	})
+	if err != nil || latest != 10 {
+		t.Fatalf("Expected migration 10, got %d, %v", latest, err)
+	}
+
+	_, err = latestMigration(fstest.MapFS{"sql/schema/users.sql": {}})
+	if err == nil {
+		t.Fatalf("Expected an error for a migration without a version")
+	}
+
+	// The embedded migrations are the ones the build ships with.
+	_, err = latestMigration(migrations)
+	if err != nil {
+		t.Fatalf("Failed to read the embedded migrations: %v", err)
+	}
+}
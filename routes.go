@@ -0,0 +1,124 @@
+package main
+
+import (
+	"chirpy/handlers"
+	"chirpy/internal/auth"
+	"chirpy/middlewares"
+	"net/http"
+	"time"
+)
+
+// router is a ServeMux that remembers the patterns registered on it, so tests
+// can walk every route.
+type router struct {
+	*http.ServeMux
+	patterns []string
+}
+
+func (r *router) Handle(pattern string, handler http.Handler) {
+	r.patterns = append(r.patterns, pattern)
+	r.ServeMux.Handle(pattern, handler)
+}
+
+func (r *router) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	r.Handle(pattern, http.HandlerFunc(handler))
+}
+
+// newRouter registers every route of the server.
+func newRouter(apiMiddlewares *middlewares.Middlewares, apiHandlers *handlers.APIHandlerStruct, adminHandlers *handlers.AdminHandlerStruct) *router {
+	mux := &router{ServeMux: http.NewServeMux()}
+	passkeyRateLimit := apiMiddlewares.APIConfig.PasskeyRateLimit
+
+	mux.HandleFunc("GET /api/healthz", apiHandlers.HealthCheck)
+	mux.HandleFunc("GET /api/readyz", apiHandlers.ReadinessCheck)
+
+	// chirps
+	mux.Handle("GET /api/chirps", apiMiddlewares.OptionalAuth(apiMiddlewares.RequireScope(auth.ScopeChirpsRead, http.HandlerFunc(apiHandlers.ListChirps))))
+	mux.Handle("GET /api/chirps/{chirpID}", apiMiddlewares.OptionalAuth(apiMiddlewares.RequireScope(auth.ScopeChirpsRead, http.HandlerFunc(apiHandlers.GetChirp))))
+	mux.Handle("POST /api/chirps", apiMiddlewares.RequireAuth(apiMiddlewares.RequireScope(auth.ScopeChirpsWrite, http.HandlerFunc(apiHandlers.CreateChirp))))
+	mux.Handle("POST /api/chirps/import", apiMiddlewares.RequireAuth(apiMiddlewares.RequireScope(auth.ScopeChirpsWrite, http.HandlerFunc(apiHandlers.ImportChirps))))
+	mux.Handle("DELETE /api/chirps/{chirpID}", apiMiddlewares.RequireAuth(apiMiddlewares.RequireScope(auth.ScopeChirpsWrite, http.HandlerFunc(apiHandlers.DeleteChirp))))
+
+	// auth
+	mux.HandleFunc("POST /api/login", apiHandlers.Login)
+	mux.HandleFunc("POST /api/refresh", apiHandlers.RefreshAccessToken)
+	mux.HandleFunc("POST /api/revoke", apiHandlers.RevokeRefreshToken)
+	mux.HandleFunc("POST /api/login/2fa", apiHandlers.CompleteTwoFactorLogin)
+	mux.HandleFunc("POST /api/login/magic-link", apiHandlers.RequestMagicLink)
+	mux.HandleFunc("POST /api/login/magic-link/verify", apiHandlers.MagicLinkLogin)
+	mux.Handle("POST /api/login/passkey/begin", apiMiddlewares.RateLimit(passkeyRateLimit, time.Minute, http.HandlerFunc(apiHandlers.BeginPasskeyLogin)))
+	mux.HandleFunc("POST /api/login/passkey/finish", apiHandlers.FinishPasskeyLogin)
+	mux.HandleFunc("POST /api/password-reset/request", apiHandlers.RequestPasswordReset)
+	mux.HandleFunc("POST /api/password-reset/confirm", apiHandlers.ConfirmPasswordReset)
+
+	// users
+	mux.HandleFunc("POST /api/users", apiHandlers.CreateUser)
+	mux.Handle("PUT /api/users", apiMiddlewares.RequireAuth(apiMiddlewares.RequireScope(auth.ScopeProfileWrite, http.HandlerFunc(apiHandlers.UpdateUser))))
+	mux.Handle("DELETE /api/users/me", apiMiddlewares.RequireSession(http.HandlerFunc(apiHandlers.DeleteAccount)))
+	mux.HandleFunc("POST /api/users/verify-email", apiHandlers.VerifyEmail)
+	mux.Handle("POST /api/users/me/export", apiMiddlewares.RequireSession(http.HandlerFunc(apiHandlers.RequestDataExport)))
+	mux.Handle("GET /api/users/me/export/{exportID}", apiMiddlewares.OptionalAuth(http.HandlerFunc(apiHandlers.GetDataExport)))
+	mux.Handle("POST /api/users/me/verify-email/resend", apiMiddlewares.RequireSession(http.HandlerFunc(apiHandlers.ResendEmailVerification)))
+	mux.Handle("POST /api/users/me/2fa", apiMiddlewares.RequireSession(http.HandlerFunc(apiHandlers.EnrollTwoFactor)))
+	mux.Handle("POST /api/users/me/2fa/confirm", apiMiddlewares.RequireSession(http.HandlerFunc(apiHandlers.ConfirmTwoFactor)))
+	mux.Handle("DELETE /api/users/me/2fa", apiMiddlewares.RequireSession(http.HandlerFunc(apiHandlers.DisableTwoFactor)))
+	mux.Handle("POST /api/users/me/passkeys/begin", apiMiddlewares.RateLimit(passkeyRateLimit, time.Minute, apiMiddlewares.RequireSession(http.HandlerFunc(apiHandlers.BeginPasskeyRegistration))))
+	mux.Handle("POST /api/users/me/passkeys/finish", apiMiddlewares.RequireSession(http.HandlerFunc(apiHandlers.FinishPasskeyRegistration)))
+	mux.Handle("GET /api/users/me/passkeys", apiMiddlewares.RequireSession(http.HandlerFunc(apiHandlers.ListPasskeys)))
+	mux.Handle("DELETE /api/users/me/passkeys/{passkeyID}", apiMiddlewares.RequireSession(http.HandlerFunc(apiHandlers.DeletePasskey)))
+
+	// personal API keys
+	mux.Handle("POST /api/tokens", apiMiddlewares.RequireSession(http.HandlerFunc(apiHandlers.CreateAPIKey)))
+	mux.Handle("GET /api/tokens", apiMiddlewares.RequireSession(http.HandlerFunc(apiHandlers.ListAPIKeys)))
+	mux.Handle("DELETE /api/tokens/{tokenID}", apiMiddlewares.RequireSession(http.HandlerFunc(apiHandlers.RevokeAPIKey)))
+
+	// OAuth clients and authorization server
+	mux.Handle("POST /api/oauth/clients", apiMiddlewares.RequireSession(http.HandlerFunc(apiHandlers.CreateOAuthClient)))
+	mux.Handle("GET /api/oauth/clients", apiMiddlewares.RequireSession(http.HandlerFunc(apiHandlers.ListOAuthClients)))
+	mux.HandleFunc("GET /api/oauth/clients/{clientID}", apiHandlers.GetOAuthClientInfo)
+	mux.Handle("DELETE /api/oauth/clients/{clientID}", apiMiddlewares.RequireSession(http.HandlerFunc(apiHandlers.DeleteOAuthClient)))
+	mux.Handle("POST /api/oauth/clients/{clientID}/webhooks", apiMiddlewares.RequireSession(http.HandlerFunc(apiHandlers.CreateWebhookSubscription)))
+	mux.Handle("GET /api/oauth/clients/{clientID}/webhooks", apiMiddlewares.RequireSession(http.HandlerFunc(apiHandlers.ListWebhookSubscriptions)))
+	mux.Handle("POST /api/oauth/clients/{clientID}/webhooks/{webhookID}/enable", apiMiddlewares.RequireSession(http.HandlerFunc(apiHandlers.EnableWebhookSubscription)))
+	mux.Handle("DELETE /api/oauth/clients/{clientID}/webhooks/{webhookID}", apiMiddlewares.RequireSession(http.HandlerFunc(apiHandlers.DeleteWebhookSubscription)))
+	mux.Handle("GET /api/oauth/clients/{clientID}/webhooks/{webhookID}/deliveries", apiMiddlewares.RequireSession(http.HandlerFunc(apiHandlers.ListWebhookDeliveries)))
+	mux.HandleFunc("GET /api/oauth/authorize", apiHandlers.Authorize)
+	mux.Handle("POST /api/oauth/authorize", apiMiddlewares.RequireSession(http.HandlerFunc(apiHandlers.Consent)))
+	mux.HandleFunc("POST /api/oauth/token", apiHandlers.Token)
+	mux.HandleFunc("POST /api/oauth/revoke", apiHandlers.RevokeOAuthToken)
+	mux.HandleFunc("POST /api/oauth/introspect", apiHandlers.IntrospectOAuthToken)
+
+	// payment provider webhooks
+	mux.HandleFunc("POST /api/billing/{provider}/webhooks", apiHandlers.BillingWebhook)
+	mux.HandleFunc("POST /api/polka/webhooks", apiHandlers.Webhook)
+
+	mux.Handle("/app/", apiMiddlewares.MiddlewareMetricsInc(http.StripPrefix("/app", http.FileServer(http.Dir("./app")))))
+
+	fs := http.FileServer(http.Dir("./app/assets/"))
+	mux.Handle("/app/assets", http.StripPrefix("/app/assets", fs))
+
+	mux.Handle("GET /metrics", apiMiddlewares.RequireMetricsToken(http.HandlerFunc(adminHandlers.PrometheusMetrics)))
+	mux.Handle("GET /admin/metrics", apiMiddlewares.RequirePermission(auth.PermissionViewMetrics, http.HandlerFunc(adminHandlers.GetMetrics)))
+	mux.Handle("POST /admin/reset", apiMiddlewares.RequirePermission(auth.PermissionResetDatabase, http.HandlerFunc(adminHandlers.Reset)))
+	mux.Handle("DELETE /admin/chirps/{chirpID}", apiMiddlewares.RequirePermission(auth.PermissionModerateChirps, http.HandlerFunc(adminHandlers.ModerateDeleteChirp)))
+	mux.Handle("GET /admin/webhooks/events", apiMiddlewares.RequirePermission(auth.PermissionManageWebhooks, http.HandlerFunc(apiHandlers.ListWebhookEvents)))
+	mux.Handle("POST /admin/webhooks/events/{provider}/{eventID}/replay", apiMiddlewares.RequirePermission(auth.PermissionManageWebhooks, http.HandlerFunc(apiHandlers.ReplayWebhookEvent)))
+	mux.Handle("PUT /admin/users/{userID}/role", apiMiddlewares.RequirePermission(auth.PermissionManageRoles, http.HandlerFunc(adminHandlers.UpdateUserRole)))
+
+	return mux
+}
+
+// newServerHandler wraps the routes in the middlewares every request goes
+// through.
+func newServerHandler(apiMiddlewares *middlewares.Middlewares, mux http.Handler) http.Handler {
+	// Listed from the innermost out: every request gets an ID first, then a
+	// span, and is logged and measured inside both. Panics are recovered
+	// inside all of them, so they are logged and measured as the 500 they
+	// become.
+	handler := apiMiddlewares.Recover(mux)
+	handler = apiMiddlewares.InstrumentRequests(handler)
+	handler = apiMiddlewares.AccessLog(handler)
+	handler = apiMiddlewares.Trace(handler)
+	handler = apiMiddlewares.RequestID(handler)
+	return handler
+}
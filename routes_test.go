@@ -0,0 +1,158 @@
+package main
+
+import (
+	"chirpy/handlers"
+	"chirpy/internal/auth"
+	"chirpy/internal/config"
+	"chirpy/internal/database"
+	"chirpy/internal/health"
+	"chirpy/internal/logging"
+	"chirpy/metrics"
+	"chirpy/middlewares"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+)
+
+var pathParameter = regexp.MustCompile(`\{[^}]+\}`)
+
+// newActiveUsers returns queries for the middlewares, and a function to call
+// before each request so its access token's account is found active.
+// Routes that do not authenticate leave the expectation for the next request.
+func newActiveUsers(t *testing.T) (*database.Queries, func()) {
+	t.Helper()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open mock database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return database.New(db), func() {
+		mock.ExpectQuery("IsUserActive").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	}
+}
+
+// TestMalformedIDsAreRejected sends garbage in every path parameter of every
+// route, as a signed-in admin so authorization lets it through, and expects a
+// client error back. The handlers have no database: one that queries before
+// checking its parameters panics, and shows up here as a 500.
+func TestMalformedIDsAreRejected(t *testing.T) {
+	defaultLogger := slog.Default()
+	slog.SetDefault(logging.New(io.Discard, slog.LevelError))
+	defer slog.SetDefault(defaultLogger)
+
+	apiConfig := &config.APIConfig{JWTSecret: "test-secret"}
+	apiMetrics := metrics.NewAPIMetrics()
+	users, expectActiveUser := newActiveUsers(t)
+	apiMiddlewares := middlewares.NewMiddlewares(apiMetrics, apiConfig, users)
+	mux := newRouter(apiMiddlewares,
+		handlers.NewAPIHandler(apiConfig, apiMetrics, nil, nil, nil, nil, &health.Readiness{}),
+		handlers.NewAdminHandlers("dev", apiMetrics, nil, nil),
+	)
+	handler := newServerHandler(apiMiddlewares, mux)
+
+	token, err := auth.MakeJWTWithClaims(uuid.New(), apiConfig.JWTSecret, time.Minute, auth.Claims{
+		SessionID: "session-1",
+		Role:      string(auth.RoleAdmin),
+	})
+	if err != nil {
+		t.Fatalf("Failed to make JWT: %v", err)
+	}
+
+	malformed := []string{
+		"not-a-uuid",
+		"42",
+		"00000000-0000-0000-0000",
+		"%27%20OR%201%3D1--",
+		"%00",
+		strings.Repeat("a", 4096),
+	}
+
+	tested := 0
+	for _, pattern := range mux.patterns {
+		method, path, found := strings.Cut(pattern, " ")
+		if !found || !pathParameter.MatchString(path) {
+			continue
+		}
+		tested++
+
+		for _, id := range malformed {
+			target := pathParameter.ReplaceAllString(path, id)
+			t.Run(method+" "+target[:min(len(target), 80)], func(t *testing.T) {
+				req := httptest.NewRequest(method, target, strings.NewReader("{}"))
+				req.Header.Set("Authorization", "Bearer "+token)
+				expectActiveUser()
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, req)
+
+				if rec.Code < 400 || rec.Code >= 500 {
+					t.Fatalf("%s: expected a 4xx, got %d: %s", pattern, rec.Code, rec.Body.String())
+				}
+			})
+		}
+	}
+
+	if tested == 0 {
+		t.Fatalf("Expected routes with path parameters")
+	}
+}
+
+// TestWebhookEventReplayIsAdminOnly checks that only admins reach the replay
+// handler. It has no database, so a request that got through would panic and
+// show up as a 500.
+func TestWebhookEventReplayIsAdminOnly(t *testing.T) {
+	defaultLogger := slog.Default()
+	slog.SetDefault(logging.New(io.Discard, slog.LevelError))
+	defer slog.SetDefault(defaultLogger)
+
+	apiConfig := &config.APIConfig{JWTSecret: "test-secret"}
+	apiMetrics := metrics.NewAPIMetrics()
+	users, expectActiveUser := newActiveUsers(t)
+	apiMiddlewares := middlewares.NewMiddlewares(apiMetrics, apiConfig, users)
+	handler := newServerHandler(apiMiddlewares, newRouter(apiMiddlewares,
+		handlers.NewAPIHandler(apiConfig, apiMetrics, nil, nil, nil, nil, &health.Readiness{}),
+		handlers.NewAdminHandlers("dev", apiMetrics, nil, nil),
+	))
+
+	tests := []struct {
+		name string
+		role auth.Role
+		want int
+	}{
+		{name: "anonymous", want: http.StatusUnauthorized},
+		{name: "user", role: auth.RoleUser, want: http.StatusForbidden},
+		{name: "moderator", role: auth.RoleModerator, want: http.StatusForbidden},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/admin/webhooks/events/polka/evt-1/replay", nil)
+			if tc.role != "" {
+				token, err := auth.MakeJWTWithClaims(uuid.New(), apiConfig.JWTSecret, time.Minute, auth.Claims{
+					SessionID: "session-1",
+					Role:      string(tc.role),
+				})
+				if err != nil {
+					t.Fatalf("Failed to make JWT: %v", err)
+				}
+				req.Header.Set("Authorization", "Bearer "+token)
+				expectActiveUser()
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tc.want {
+				t.Fatalf("Expected %d, got %d: %s", tc.want, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
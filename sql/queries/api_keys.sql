@@ -0,0 +1,28 @@
+-- name: CreateAPIKey :one
+INSERT INTO api_keys (id, user_id, name, prefix, key_hash, scopes, expires_at, created_at, updated_at)
+VALUES (
+  gen_random_uuid(), $1, $2, $3, $4, $5, $6, NOW(), NOW()
+)
+RETURNING *;
+
+-- name: ListAPIKeys :many
+SELECT * FROM api_keys
+WHERE user_id = $1 AND revoked_at IS NULL
+ORDER BY created_at DESC;
+
+-- name: GetActiveAPIKeyByHash :one
+SELECT * FROM api_keys
+WHERE key_hash = $1
+AND revoked_at IS NULL
+AND (expires_at IS NULL OR expires_at > NOW());
+
+-- name: TouchAPIKey :exec
+UPDATE api_keys
+SET last_used_at = NOW()
+WHERE id = $1;
+
+-- name: RevokeAPIKey :execrows
+UPDATE api_keys
+SET revoked_at = NOW(),
+updated_at = NOW()
+WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL;
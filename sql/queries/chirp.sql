@@ -24,3 +24,17 @@ WHERE id = $1;
 
 -- name: DeleteChirp :exec
 DELETE FROM chirps where id = $1 AND user_id = $2;
+
+-- name: ModerateDeleteChirp :one
+DELETE FROM chirps WHERE id = $1
+RETURNING *;
+
+-- name: ImportChirps :many
+-- Inserts a batch of chirps. imported_created_at holds timestamps formatted
+-- for Postgres, with an empty string for chirps that have none.
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, imported_created_at)
+SELECT gen_random_uuid(), NOW(), NOW(), i.body, sqlc.arg('user_id'), NULLIF(i.imported_created_at, '')::TIMESTAMP
+FROM (
+  SELECT unnest(sqlc.arg('bodies')::TEXT[]) AS body, unnest(sqlc.arg('imported_created_at')::TEXT[]) AS imported_created_at
+) AS i
+RETURNING *;
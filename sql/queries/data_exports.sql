@@ -0,0 +1,47 @@
+-- name: CreateDataExport :one
+INSERT INTO data_exports (id, user_id, status, created_at, expires_at)
+VALUES (
+  gen_random_uuid(), $1, 'pending', NOW(), $2
+)
+RETURNING id, user_id, status, created_at, completed_at, expires_at;
+
+-- name: CountPendingDataExports :one
+SELECT COUNT(*) FROM data_exports
+WHERE user_id = $1 AND status = 'pending';
+
+-- name: ClaimPendingDataExport :one
+-- Leases the oldest pending export that no worker is building, or whose
+-- worker stopped before finishing, so each export is built by one worker.
+UPDATE data_exports
+SET started_at = NOW()
+WHERE id = (
+  SELECT pending.id FROM data_exports AS pending
+  WHERE pending.status = 'pending'
+  AND (pending.started_at IS NULL OR pending.started_at < NOW() - sqlc.arg('lease_seconds')::INTEGER * INTERVAL '1 second')
+  ORDER BY pending.created_at
+  LIMIT 1
+  FOR UPDATE SKIP LOCKED
+)
+RETURNING id, user_id;
+
+-- name: GetDataExport :one
+SELECT id, user_id, status, created_at, completed_at, expires_at FROM data_exports
+WHERE id = $1 AND user_id = $2 AND expires_at > NOW();
+
+-- name: GetDataExportArchive :one
+SELECT archive FROM data_exports
+WHERE id = $1 AND status = 'ready' AND expires_at > NOW();
+
+-- name: CompleteDataExport :exec
+UPDATE data_exports
+SET status = 'ready', archive = $2, completed_at = NOW()
+WHERE id = $1;
+
+-- name: FailDataExport :exec
+UPDATE data_exports
+SET status = 'failed', completed_at = NOW()
+WHERE id = $1;
+
+-- name: DeleteExpiredDataExports :execrows
+DELETE FROM data_exports
+WHERE expires_at <= NOW();
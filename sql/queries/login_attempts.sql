@@ -0,0 +1,33 @@
+-- name: RecordLoginAttempt :exec
+INSERT INTO login_attempts (id, email, ip_address, succeeded, created_at)
+VALUES (
+  gen_random_uuid(), $1, $2, $3, NOW()
+);
+
+-- name: GetLoginFailuresByEmail :one
+-- Failures since the account's last successful login, within the window.
+SELECT COUNT(*) AS failures, COALESCE(MAX(f.created_at), 'epoch')::timestamp AS last_failure
+FROM login_attempts f
+WHERE f.email = sqlc.arg('email')
+AND NOT f.succeeded
+AND f.created_at > sqlc.arg('since')
+AND f.created_at > COALESCE(
+  (SELECT MAX(s.created_at) FROM login_attempts s WHERE s.email = sqlc.arg('email') AND s.succeeded),
+  'epoch'
+);
+
+-- name: GetLoginFailuresByIP :one
+SELECT COUNT(*) AS failures, COALESCE(MAX(created_at), 'epoch')::timestamp AS last_failure
+FROM login_attempts
+WHERE ip_address = sqlc.arg('ip_address')
+AND NOT succeeded
+AND created_at > sqlc.arg('since');
+
+-- name: DeleteLoginAttemptsByEmail :exec
+DELETE FROM login_attempts
+WHERE email = $1;
+
+-- name: DeleteLoginAttemptsBefore :execrows
+-- Attempts older than every throttle window are never counted again.
+DELETE FROM login_attempts
+WHERE created_at < $1;
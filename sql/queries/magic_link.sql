@@ -0,0 +1,11 @@
+-- name: CreateMagicLinkToken :exec
+INSERT INTO magic_link_tokens (token_hash, user_id, created_at, expires_at)
+VALUES (
+  $1, $2, NOW(), $3
+);
+
+-- name: ConsumeMagicLinkToken :one
+UPDATE magic_link_tokens
+SET used_at = NOW()
+WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+RETURNING user_id;
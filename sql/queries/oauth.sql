@@ -0,0 +1,31 @@
+-- name: CreateOAuthClient :one
+INSERT INTO oauth_clients (id, owner_id, name, client_secret_hash, redirect_uris, scopes, created_at, updated_at)
+VALUES (
+  gen_random_uuid(), $1, $2, $3, $4, $5, NOW(), NOW()
+)
+RETURNING *;
+
+-- name: GetOAuthClient :one
+SELECT * FROM oauth_clients
+WHERE id = $1;
+
+-- name: ListOAuthClientsByOwner :many
+SELECT * FROM oauth_clients
+WHERE owner_id = $1
+ORDER BY created_at DESC;
+
+-- name: DeleteOAuthClient :execrows
+DELETE FROM oauth_clients
+WHERE id = $1 AND owner_id = $2;
+
+-- name: CreateAuthorizationCode :exec
+INSERT INTO oauth_authorization_codes (code_hash, client_id, user_id, redirect_uri, scopes, code_challenge, created_at, expires_at)
+VALUES (
+  $1, $2, $3, $4, $5, $6, NOW(), $7
+);
+
+-- name: ConsumeAuthorizationCode :one
+UPDATE oauth_authorization_codes
+SET used_at = NOW()
+WHERE code_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+RETURNING *;
@@ -0,0 +1,106 @@
+-- name: CreateWebhookSubscription :one
+INSERT INTO webhook_subscriptions (id, client_id, url, event_types, secret, created_at, updated_at)
+VALUES (
+  gen_random_uuid(), $1, $2, $3, $4, NOW(), NOW()
+)
+RETURNING *;
+
+-- name: ListWebhookSubscriptions :many
+SELECT * FROM webhook_subscriptions
+WHERE client_id = $1
+ORDER BY created_at;
+
+-- name: GetWebhookSubscription :one
+SELECT * FROM webhook_subscriptions
+WHERE id = $1 AND client_id = $2;
+
+-- name: DeleteWebhookSubscription :execrows
+DELETE FROM webhook_subscriptions
+WHERE id = $1 AND client_id = $2;
+
+-- name: EnableWebhookSubscription :one
+UPDATE webhook_subscriptions
+SET disabled_at = NULL,
+consecutive_failures = 0,
+updated_at = NOW()
+WHERE id = $1 AND client_id = $2
+RETURNING *;
+
+-- name: EnqueueWebhookDeliveries :execrows
+-- Queues an event for every enabled subscription to its type whose client
+-- the user the event is about has granted the scope to read it.
+INSERT INTO webhook_deliveries (id, subscription_id, event_id, event_type, payload, status, next_attempt_at, created_at)
+SELECT gen_random_uuid(), s.id, sqlc.arg('event_id'), sqlc.arg('event_type'), sqlc.arg('payload'), 'pending', NOW(), NOW()
+FROM webhook_subscriptions AS s
+WHERE s.disabled_at IS NULL AND sqlc.arg('event_type')::TEXT = ANY(s.event_types)
+AND EXISTS (
+  SELECT 1 FROM refresh_tokens AS grant_token
+  WHERE grant_token.client_id = s.client_id
+  AND grant_token.user_id = sqlc.arg('user_id')
+  AND grant_token.revoked_at IS NULL
+  AND grant_token.expires_at > NOW()
+  AND sqlc.arg('scope')::TEXT = ANY(grant_token.scopes)
+);
+
+-- name: ClaimDueWebhookDeliveries :many
+-- Leases due deliveries by pushing their next attempt back, so other workers
+-- skip them while they are being sent.
+UPDATE webhook_deliveries AS d
+SET next_attempt_at = NOW() + sqlc.arg('lease_seconds')::INTEGER * INTERVAL '1 second'
+FROM webhook_subscriptions AS s
+WHERE s.id = d.subscription_id
+AND d.id IN (
+  SELECT due.id FROM webhook_deliveries AS due
+  JOIN webhook_subscriptions AS active ON active.id = due.subscription_id
+  WHERE due.status = 'pending' AND due.next_attempt_at <= NOW() AND active.disabled_at IS NULL
+  ORDER BY due.next_attempt_at
+  LIMIT sqlc.arg('batch_size')
+  FOR UPDATE OF due SKIP LOCKED
+)
+RETURNING d.id, d.subscription_id, d.event_id, d.event_type, d.payload, d.attempts, s.url, s.secret;
+
+-- name: MarkWebhookDelivered :exec
+UPDATE webhook_deliveries
+SET status = 'delivered',
+attempts = attempts + 1,
+last_attempt_at = NOW(),
+delivered_at = NOW(),
+response_status = $2,
+error = NULL
+WHERE id = $1;
+
+-- name: MarkWebhookAttemptFailed :exec
+-- Records a failed attempt. The delivery is retried at next_attempt_at, or
+-- given up on when status is 'failed'.
+UPDATE webhook_deliveries
+SET status = $2,
+attempts = attempts + 1,
+last_attempt_at = NOW(),
+next_attempt_at = $3,
+response_status = $4,
+error = $5
+WHERE id = $1;
+
+-- name: ResetWebhookFailures :exec
+UPDATE webhook_subscriptions
+SET consecutive_failures = 0
+WHERE id = $1 AND consecutive_failures > 0;
+
+-- name: RecordWebhookFailure :one
+-- Counts a failed attempt against the subscription and disables it once
+-- max_failures are reached in a row.
+UPDATE webhook_subscriptions
+SET consecutive_failures = consecutive_failures + 1,
+disabled_at = CASE
+  WHEN consecutive_failures + 1 >= sqlc.arg('max_failures')::INTEGER THEN COALESCE(disabled_at, NOW())
+  ELSE disabled_at
+END,
+updated_at = NOW()
+WHERE id = $1
+RETURNING consecutive_failures;
+
+-- name: ListWebhookDeliveries :many
+SELECT * FROM webhook_deliveries
+WHERE subscription_id = $1
+ORDER BY created_at DESC
+LIMIT $2;
@@ -0,0 +1,20 @@
+-- name: AddPasswordHistory :exec
+INSERT INTO password_history (id, user_id, hashed_password, created_at)
+VALUES (
+  gen_random_uuid(), $1, $2, NOW()
+);
+
+-- name: ListPasswordHistory :many
+SELECT hashed_password FROM password_history
+WHERE user_id = sqlc.arg('user_id')
+ORDER BY created_at DESC
+LIMIT sqlc.arg('limit');
+
+-- name: PrunePasswordHistory :exec
+DELETE FROM password_history p
+WHERE p.user_id = sqlc.arg('user_id') AND p.id NOT IN (
+  SELECT h.id FROM password_history h
+  WHERE h.user_id = sqlc.arg('user_id')
+  ORDER BY h.created_at DESC
+  LIMIT sqlc.arg('keep')
+);
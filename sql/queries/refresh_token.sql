@@ -15,3 +15,43 @@ SET revoked_at = NOW(),
 updated_at = NOW()
 WHERE token = $1
 RETURNING *;
+
+-- name: RevokeAllUserRefreshTokens :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(),
+updated_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL;
+
+-- name: CreateOAuthRefreshToken :one
+INSERT INTO refresh_tokens (created_at, updated_at, token, user_id, expires_at, session_id, client_id, scopes)
+VALUES (
+  NOW(), NOW(), $1, $2, (NOW() + INTERVAL '60 days'), $3, $4, $5
+)
+RETURNING *;
+
+-- name: GetOAuthRefreshToken :one
+SELECT * FROM refresh_tokens
+WHERE token = $1 AND client_id = $2;
+
+-- name: RotateOAuthRefreshToken :execrows
+UPDATE refresh_tokens
+SET revoked_at = NOW(),
+updated_at = NOW()
+WHERE token = $1 AND client_id = $2 AND revoked_at IS NULL;
+
+-- name: IsSessionActive :one
+SELECT EXISTS (
+  SELECT 1 FROM refresh_tokens
+  WHERE session_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+);
+
+-- name: RevokeSession :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(),
+updated_at = NOW()
+WHERE session_id = $1 AND revoked_at IS NULL;
+
+-- name: ListUserRefreshTokens :many
+SELECT * FROM refresh_tokens
+WHERE user_id = $1
+ORDER BY created_at DESC;
@@ -0,0 +1,39 @@
+-- name: GetSubscriptionForUpdate :one
+SELECT * FROM subscriptions
+WHERE user_id = $1
+FOR UPDATE;
+
+-- name: UpsertSubscription :one
+-- Stores the state after an event, unless an event newer than this one was
+-- stored in the meantime, in which case no row is returned.
+INSERT INTO subscriptions (
+  user_id, provider, plan, status, current_period_start, current_period_end,
+  cancel_at_period_end, last_event_at, created_at, updated_at
+)
+VALUES (
+  $1, $2, $3, $4, $5, $6, $7, $8, NOW(), NOW()
+)
+ON CONFLICT (user_id) DO UPDATE
+SET provider = EXCLUDED.provider,
+plan = EXCLUDED.plan,
+status = EXCLUDED.status,
+current_period_start = EXCLUDED.current_period_start,
+current_period_end = EXCLUDED.current_period_end,
+cancel_at_period_end = EXCLUDED.cancel_at_period_end,
+last_event_at = EXCLUDED.last_event_at,
+updated_at = NOW()
+WHERE subscriptions.last_event_at <= EXCLUDED.last_event_at
+RETURNING *;
+
+-- name: ListLapsedSubscriptions :many
+SELECT user_id FROM subscriptions
+WHERE status IN ('active', 'past_due') AND current_period_end <= NOW()
+ORDER BY current_period_end
+LIMIT $1;
+
+-- name: ExpireSubscription :execrows
+UPDATE subscriptions
+SET status = 'expired',
+cancel_at_period_end = false,
+updated_at = NOW()
+WHERE user_id = $1 AND status IN ('active', 'past_due') AND current_period_end <= NOW();
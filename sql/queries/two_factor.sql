@@ -0,0 +1,52 @@
+-- name: UpsertPendingTOTP :one
+INSERT INTO user_totp (user_id, secret, created_at, updated_at)
+VALUES (
+  $1, $2, NOW(), NOW()
+)
+ON CONFLICT (user_id) DO UPDATE
+SET secret = EXCLUDED.secret,
+last_used_step = 0,
+updated_at = NOW()
+WHERE user_totp.confirmed_at IS NULL
+RETURNING *;
+
+-- name: GetTOTP :one
+SELECT * FROM user_totp
+WHERE user_id = $1;
+
+-- name: ConfirmTOTP :one
+UPDATE user_totp
+SET confirmed_at = NOW(),
+last_used_step = $2,
+updated_at = NOW()
+WHERE user_id = $1 AND confirmed_at IS NULL
+RETURNING *;
+
+-- name: UseTOTPStep :execrows
+UPDATE user_totp
+SET last_used_step = $2,
+updated_at = NOW()
+WHERE user_id = $1 AND last_used_step < $2;
+
+-- name: DeleteTOTP :exec
+DELETE FROM user_totp
+WHERE user_id = $1;
+
+-- name: CreateRecoveryCode :exec
+INSERT INTO recovery_codes (id, user_id, hashed_code, created_at)
+VALUES (
+  gen_random_uuid(), $1, $2, NOW()
+);
+
+-- name: ListUnusedRecoveryCodes :many
+SELECT * FROM recovery_codes
+WHERE user_id = $1 AND used_at IS NULL;
+
+-- name: UseRecoveryCode :execrows
+UPDATE recovery_codes
+SET used_at = NOW()
+WHERE id = $1 AND used_at IS NULL;
+
+-- name: DeleteRecoveryCodes :exec
+DELETE FROM recovery_codes
+WHERE user_id = $1;
@@ -30,3 +30,48 @@ RETURNING *;
 UPDATE users SET is_chirpy_red = false 
 WHERE id = $1
 RETURNING *;
+
+-- name: SetUserRole :one
+UPDATE users SET role = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: CountUsersByRole :one
+SELECT COUNT(*) FROM users
+WHERE role = $1;
+
+-- name: UpdateUserPassword :exec
+UPDATE users SET hashed_password = $2, updated_at = NOW()
+WHERE id = $1;
+
+-- name: VerifyUserEmail :one
+UPDATE users SET email = $2, email_verified_at = NOW(), updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: ScheduleUserDeletion :one
+UPDATE users SET delete_after = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: CancelUserDeletion :exec
+UPDATE users SET delete_after = NULL, updated_at = NOW()
+WHERE id = $1;
+
+-- name: ListUsersDueForDeletion :many
+SELECT id, email FROM users
+WHERE delete_after <= NOW()
+ORDER BY delete_after
+LIMIT $1;
+
+-- name: DeleteUser :execrows
+-- Everything that references the user is removed through ON DELETE CASCADE.
+DELETE FROM users
+WHERE id = $1 AND delete_after <= NOW();
+
+-- name: IsUserActive :one
+-- Whether the user exists and is not scheduled for deletion.
+SELECT EXISTS (
+  SELECT 1 FROM users
+  WHERE id = $1 AND delete_after IS NULL
+);
@@ -0,0 +1,38 @@
+-- name: CreateWebAuthnCredential :one
+INSERT INTO webauthn_credentials (
+  id, user_id, name, credential_id, public_key, attestation_type, aaguid,
+  sign_count, transports, backup_eligible, backup_state, created_at, updated_at
+)
+VALUES (
+  gen_random_uuid(), $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NOW(), NOW()
+)
+RETURNING *;
+
+-- name: ListWebAuthnCredentials :many
+SELECT * FROM webauthn_credentials
+WHERE user_id = $1
+ORDER BY created_at;
+
+-- name: DeleteWebAuthnCredential :execrows
+DELETE FROM webauthn_credentials
+WHERE id = $1 AND user_id = $2;
+
+-- name: UpdateWebAuthnCredentialUse :exec
+UPDATE webauthn_credentials
+SET sign_count = $2, backup_state = $3, last_used_at = NOW(), updated_at = NOW()
+WHERE credential_id = $1;
+
+-- name: CreateWebAuthnSession :one
+INSERT INTO webauthn_sessions (id, user_id, ceremony, data, created_at, expires_at)
+VALUES (
+  gen_random_uuid(), $1, $2, $3, NOW(), $4
+)
+RETURNING id;
+
+-- name: ConsumeWebAuthnSession :one
+DELETE FROM webauthn_sessions
+WHERE id = $1 AND ceremony = $2 AND expires_at > NOW()
+RETURNING *;
+
+-- name: DeleteExpiredWebAuthnSessions :execrows
+DELETE FROM webauthn_sessions WHERE expires_at <= NOW();
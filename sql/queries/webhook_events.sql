@@ -0,0 +1,49 @@
+-- name: ClaimWebhookEvent :one
+-- Records a newly received event, or takes over one whose earlier delivery
+-- failed or was abandoned mid-way. Returns no rows for an event that is
+-- already processed or being processed.
+INSERT INTO webhook_events (provider, event_id, event_type, payload, status, received_at, updated_at)
+VALUES (
+  $1, $2, $3, $4, 'processing', NOW(), NOW()
+)
+ON CONFLICT (provider, event_id) DO UPDATE
+SET status = 'processing',
+attempts = webhook_events.attempts + 1,
+error = NULL,
+updated_at = NOW()
+WHERE webhook_events.status = 'failed'
+OR (webhook_events.status = 'processing' AND webhook_events.updated_at < NOW() - INTERVAL '5 minutes')
+RETURNING *;
+
+-- name: ClaimFailedWebhookEvent :one
+UPDATE webhook_events
+SET status = 'processing',
+attempts = attempts + 1,
+error = NULL,
+updated_at = NOW()
+WHERE provider = $1 AND event_id = $2 AND status = 'failed'
+RETURNING *;
+
+-- name: CompleteWebhookEvent :exec
+UPDATE webhook_events
+SET status = 'processed',
+processed_at = NOW(),
+updated_at = NOW()
+WHERE provider = $1 AND event_id = $2;
+
+-- name: FailWebhookEvent :exec
+UPDATE webhook_events
+SET status = 'failed',
+error = $3,
+updated_at = NOW()
+WHERE provider = $1 AND event_id = $2;
+
+-- name: GetWebhookEvent :one
+SELECT * FROM webhook_events
+WHERE provider = $1 AND event_id = $2;
+
+-- name: ListWebhookEventsByStatus :many
+SELECT * FROM webhook_events
+WHERE status = $1
+ORDER BY received_at DESC
+LIMIT $2;
@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE refresh_tokens
+ADD COLUMN session_id UUID DEFAULT gen_random_uuid() NOT NULL;
+
+-- +goose Down
+ALTER TABLE refresh_tokens
+DROP COLUMN session_id;
@@ -0,0 +1,23 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN email_verified_at TIMESTAMP;
+
+-- Accounts created before verification existed are trusted as they are, so
+-- turning on restrictions for unverified accounts does not lock them out.
+UPDATE users
+SET email_verified_at = created_at;
+
+CREATE TABLE email_verification_tokens (
+  token_hash TEXT PRIMARY KEY,
+  user_id UUID REFERENCES users(id) ON DELETE CASCADE NOT NULL,
+  email TEXT NOT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+  expires_at TIMESTAMP NOT NULL,
+  used_at TIMESTAMP
+);
+
+-- +goose Down
+DROP TABLE email_verification_tokens;
+
+ALTER TABLE users
+DROP COLUMN email_verified_at;
@@ -0,0 +1,14 @@
+-- +goose Up
+CREATE TABLE login_attempts (
+  id UUID PRIMARY KEY,
+  email TEXT NOT NULL,
+  ip_address TEXT NOT NULL,
+  succeeded BOOLEAN NOT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+CREATE INDEX login_attempts_email_created_at_idx ON login_attempts (email, created_at);
+CREATE INDEX login_attempts_ip_address_created_at_idx ON login_attempts (ip_address, created_at);
+
+-- +goose Down
+DROP TABLE login_attempts;
@@ -0,0 +1,12 @@
+-- +goose Up
+CREATE TABLE password_history (
+  id UUID PRIMARY KEY,
+  user_id UUID REFERENCES users(id) ON DELETE CASCADE NOT NULL,
+  hashed_password TEXT NOT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+CREATE INDEX password_history_user_id_created_at_idx ON password_history (user_id, created_at);
+
+-- +goose Down
+DROP TABLE password_history;
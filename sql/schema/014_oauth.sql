@@ -0,0 +1,40 @@
+-- +goose Up
+CREATE TABLE oauth_clients (
+  id UUID PRIMARY KEY,
+  owner_id UUID REFERENCES users(id) ON DELETE CASCADE NOT NULL,
+  name TEXT NOT NULL,
+  -- NULL for public clients, which authenticate with PKCE only.
+  client_secret_hash TEXT,
+  redirect_uris TEXT[] NOT NULL,
+  scopes TEXT[] NOT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+  updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+CREATE TABLE oauth_authorization_codes (
+  code_hash TEXT PRIMARY KEY,
+  client_id UUID REFERENCES oauth_clients(id) ON DELETE CASCADE NOT NULL,
+  user_id UUID REFERENCES users(id) ON DELETE CASCADE NOT NULL,
+  redirect_uri TEXT NOT NULL,
+  scopes TEXT[] NOT NULL,
+  code_challenge TEXT NOT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+  expires_at TIMESTAMP NOT NULL,
+  used_at TIMESTAMP
+);
+
+ALTER TABLE refresh_tokens
+ADD COLUMN client_id UUID REFERENCES oauth_clients(id) ON DELETE CASCADE;
+
+ALTER TABLE refresh_tokens
+ADD COLUMN scopes TEXT[];
+
+-- +goose Down
+ALTER TABLE refresh_tokens
+DROP COLUMN scopes;
+
+ALTER TABLE refresh_tokens
+DROP COLUMN client_id;
+
+DROP TABLE oauth_authorization_codes;
+DROP TABLE oauth_clients;
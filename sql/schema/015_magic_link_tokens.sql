@@ -0,0 +1,11 @@
+-- +goose Up
+CREATE TABLE magic_link_tokens (
+  token_hash TEXT PRIMARY KEY,
+  user_id UUID REFERENCES users(id) ON DELETE CASCADE NOT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+  expires_at TIMESTAMP NOT NULL,
+  used_at TIMESTAMP
+);
+
+-- +goose Down
+DROP TABLE magic_link_tokens;
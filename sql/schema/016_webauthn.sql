@@ -0,0 +1,34 @@
+-- +goose Up
+CREATE TABLE webauthn_credentials (
+  id UUID PRIMARY KEY,
+  user_id UUID REFERENCES users(id) ON DELETE CASCADE NOT NULL,
+  name TEXT NOT NULL,
+  credential_id BYTEA UNIQUE NOT NULL,
+  public_key BYTEA NOT NULL,
+  attestation_type TEXT NOT NULL,
+  aaguid BYTEA NOT NULL,
+  sign_count BIGINT NOT NULL,
+  transports TEXT[] NOT NULL,
+  backup_eligible BOOLEAN NOT NULL,
+  backup_state BOOLEAN NOT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+  updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+  last_used_at TIMESTAMP
+);
+
+CREATE INDEX webauthn_credentials_user_id_idx ON webauthn_credentials (user_id);
+
+-- Challenges of ceremonies in progress. Login sessions have no user until the
+-- authenticator names one.
+CREATE TABLE webauthn_sessions (
+  id UUID PRIMARY KEY,
+  user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+  ceremony TEXT NOT NULL CHECK (ceremony IN ('registration', 'login')),
+  data JSONB NOT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+  expires_at TIMESTAMP NOT NULL
+);
+
+-- +goose Down
+DROP TABLE webauthn_sessions;
+DROP TABLE webauthn_credentials;
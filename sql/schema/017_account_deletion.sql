@@ -0,0 +1,26 @@
+-- +goose Up
+-- Chirps of users that no longer exist cannot get a foreign key.
+DELETE FROM chirps
+WHERE user_id NOT IN (SELECT id FROM users);
+
+ALTER TABLE chirps
+ADD CONSTRAINT chirps_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+
+CREATE INDEX chirps_user_id_idx ON chirps (user_id);
+
+-- Set while a deletion requested by the user is in its grace period.
+ALTER TABLE users
+ADD COLUMN delete_after TIMESTAMP;
+
+CREATE INDEX users_delete_after_idx ON users (delete_after) WHERE delete_after IS NOT NULL;
+
+-- +goose Down
+DROP INDEX users_delete_after_idx;
+
+ALTER TABLE users
+DROP COLUMN delete_after;
+
+DROP INDEX chirps_user_id_idx;
+
+ALTER TABLE chirps
+DROP CONSTRAINT chirps_user_id_fkey;
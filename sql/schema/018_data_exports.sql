@@ -0,0 +1,15 @@
+-- +goose Up
+CREATE TABLE data_exports (
+  id UUID PRIMARY KEY,
+  user_id UUID REFERENCES users(id) ON DELETE CASCADE NOT NULL,
+  status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'ready', 'failed')),
+  archive BYTEA,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+  completed_at TIMESTAMP,
+  expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX data_exports_user_id_idx ON data_exports (user_id);
+
+-- +goose Down
+DROP TABLE data_exports;
@@ -0,0 +1,9 @@
+-- +goose Up
+-- When an imported chirp was originally posted. created_at stays the time it
+-- was imported.
+ALTER TABLE chirps
+ADD COLUMN imported_created_at TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE chirps
+DROP COLUMN imported_created_at;
@@ -0,0 +1,21 @@
+-- +goose Up
+-- Every webhook received from a payment provider, keyed by the provider's
+-- event ID so retried deliveries are only processed once.
+CREATE TABLE webhook_events (
+  provider TEXT NOT NULL,
+  event_id TEXT NOT NULL,
+  event_type TEXT NOT NULL,
+  payload TEXT NOT NULL,
+  status TEXT NOT NULL CHECK (status IN ('processing', 'processed', 'failed')),
+  error TEXT,
+  attempts INTEGER NOT NULL DEFAULT 1,
+  received_at TIMESTAMP NOT NULL,
+  updated_at TIMESTAMP NOT NULL,
+  processed_at TIMESTAMP,
+  PRIMARY KEY (provider, event_id)
+);
+
+CREATE INDEX webhook_events_status_idx ON webhook_events (status, received_at);
+
+-- +goose Down
+DROP TABLE webhook_events;
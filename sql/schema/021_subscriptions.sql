@@ -0,0 +1,28 @@
+-- +goose Up
+-- A user's Chirpy Red subscription. users.is_chirpy_red follows it.
+CREATE TABLE subscriptions (
+  user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+  provider TEXT NOT NULL,
+  plan TEXT NOT NULL,
+  status TEXT NOT NULL CHECK (status IN ('active', 'past_due', 'canceled', 'expired')),
+  current_period_start TIMESTAMP,
+  current_period_end TIMESTAMP,
+  cancel_at_period_end BOOLEAN NOT NULL DEFAULT false,
+  -- When the newest event applied so far happened. Older events arriving
+  -- late are ignored.
+  last_event_at TIMESTAMP NOT NULL,
+  created_at TIMESTAMP NOT NULL,
+  updated_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX subscriptions_period_end_idx ON subscriptions (current_period_end)
+WHERE status IN ('active', 'past_due');
+
+-- Upgrades so far never expire.
+INSERT INTO subscriptions (user_id, provider, plan, status, last_event_at, created_at, updated_at)
+SELECT id, 'polka', 'chirpy_red', 'active', updated_at, NOW(), NOW()
+FROM users
+WHERE is_chirpy_red;
+
+-- +goose Down
+DROP TABLE subscriptions;
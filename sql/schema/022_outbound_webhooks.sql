@@ -0,0 +1,43 @@
+-- +goose Up
+-- Where an API client wants to be told about events. The secret signs every
+-- delivery, so it is kept as is rather than hashed.
+CREATE TABLE webhook_subscriptions (
+  id UUID PRIMARY KEY,
+  client_id UUID NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+  url TEXT NOT NULL,
+  event_types TEXT[] NOT NULL,
+  secret TEXT NOT NULL,
+  -- Failed attempts in a row. Reaching the limit disables the subscription.
+  consecutive_failures INTEGER NOT NULL DEFAULT 0,
+  disabled_at TIMESTAMP,
+  created_at TIMESTAMP NOT NULL,
+  updated_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX webhook_subscriptions_client_id_idx ON webhook_subscriptions (client_id);
+
+-- The outbox: one row per event and subscription, written in the same
+-- transaction as the change it reports.
+CREATE TABLE webhook_deliveries (
+  id UUID PRIMARY KEY,
+  subscription_id UUID NOT NULL REFERENCES webhook_subscriptions(id) ON DELETE CASCADE,
+  event_id UUID NOT NULL,
+  event_type TEXT NOT NULL,
+  payload TEXT NOT NULL,
+  status TEXT NOT NULL CHECK (status IN ('pending', 'delivered', 'failed')),
+  attempts INTEGER NOT NULL DEFAULT 0,
+  next_attempt_at TIMESTAMP NOT NULL,
+  last_attempt_at TIMESTAMP,
+  response_status INTEGER,
+  error TEXT,
+  created_at TIMESTAMP NOT NULL,
+  delivered_at TIMESTAMP
+);
+
+CREATE INDEX webhook_deliveries_due_idx ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX webhook_deliveries_subscription_id_idx ON webhook_deliveries (subscription_id, created_at);
+
+-- +goose Down
+DROP TABLE webhook_deliveries;
+
+DROP TABLE webhook_subscriptions;
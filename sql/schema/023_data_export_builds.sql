@@ -0,0 +1,7 @@
+-- +goose Up
+-- When a worker claimed a pending export. A claim that is older than a build
+-- can take belongs to a worker that stopped, and the export is built again.
+ALTER TABLE data_exports ADD COLUMN started_at TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE data_exports DROP COLUMN started_at;
@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ClientIP returns the address of the client that sent r. X-Forwarded-For is
+// only honoured when trustProxy is set, since clients can put anything there.
+// Even then only its last entry is used: the trusted proxy appended it, while
+// every entry before it came from the client.
+func ClientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		if values := r.Header.Values("X-Forwarded-For"); len(values) > 0 {
+			forwarded := values[len(values)-1]
+			if i := strings.LastIndex(forwarded, ","); i >= 0 {
+				forwarded = forwarded[i+1:]
+			}
+			if forwarded = strings.TrimSpace(forwarded); forwarded != "" {
+				return forwarded
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
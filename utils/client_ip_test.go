@@ -0,0 +1,37 @@
+package utils_test
+
+import (
+	"chirpy/utils"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		forwarded  []string
+		trustProxy bool
+		want       string
+	}{
+		{name: "no proxy", want: "192.0.2.1"},
+		{name: "untrusted header", forwarded: []string{"203.0.113.7"}, want: "192.0.2.1"},
+		{name: "trusted proxy", forwarded: []string{"203.0.113.7"}, trustProxy: true, want: "203.0.113.7"},
+		{name: "client-supplied entries", forwarded: []string{"198.51.100.1, 198.51.100.2, 203.0.113.7"}, trustProxy: true, want: "203.0.113.7"},
+		{name: "several headers", forwarded: []string{"198.51.100.1", "203.0.113.7"}, trustProxy: true, want: "203.0.113.7"},
+		{name: "empty header", forwarded: []string{""}, trustProxy: true, want: "192.0.2.1"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = "192.0.2.1:1234"
+			for _, value := range tc.forwarded {
+				req.Header.Add("X-Forwarded-For", value)
+			}
+
+			if got := utils.ClientIP(req, tc.trustProxy); got != tc.want {
+				t.Fatalf("Expected %s, got %s", tc.want, got)
+			}
+		})
+	}
+}
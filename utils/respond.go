@@ -2,7 +2,7 @@ package utils
 
 import (
 	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
 )
 
@@ -12,7 +12,7 @@ func RespondJSON(w http.ResponseWriter, status int, data interface{}) {
 
 	// This line does the w.Write() internally
 	if err := json.NewEncoder(w).Encode(data); err != nil {
-		log.Printf("failed to encode response: %v", err)
+		slog.Error("failed to encode response", "error", err)
 	}
 }
 